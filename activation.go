@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+
+	"github.com/coreos/go-systemd/activation"
+)
+
+// systemdListeners returns the stream sockets passed by systemd via
+// LISTEN_FDS
+func systemdListeners() ([]net.Listener, error) {
+	ls, err := activation.Listeners()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sockets which are not stream sockets are passed as nil
+	var result []net.Listener
+	for _, l := range ls {
+		if l != nil {
+			result = append(result, l)
+		}
+	}
+	return result, nil
+}
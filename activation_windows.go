@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// systemdListeners fails, as there is no systemd on Windows
+func systemdListeners() ([]net.Listener, error) {
+	return nil, fmt.Errorf("systemd socket activation is not supported on Windows")
+}
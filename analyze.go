@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+)
+
+// AnalyzeCommand is a struct
+type AnalyzeCommand struct {
+	Namespace string `long:"namespace" description:"Namespace of the configuration file whose pipeline the files are processed with, defaults to the first one"`
+	Output    string `long:"output" default:"text" choice:"text" choice:"json" description:"Format of the report"`
+	Top       int    `long:"top" default:"10" description:"Number of routes with the most requests to report"`
+	Args      struct {
+		Files []string `positional-arg-name:"file" description:"Access log files to analyze, gzip compressed if their name ends with .gz"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// analyze processes the files of c with the pipeline of e and prints the
+// report
+func analyze(c *AnalyzeCommand, e *exporter.Exporter) error {
+	return e.Analyze(os.Stdout, c.Args.Files, c.Namespace, c.Output, c.Top)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+)
+
+// BenchCommand is a struct
+type BenchCommand struct {
+	Rate      float64 `long:"rate" description:"Lines per second to replay the file at, 0 to replay it as fast as possible"`
+	Namespace string  `long:"namespace" description:"Namespace of the configuration file whose pipeline the file is replayed through, defaults to the first one"`
+	Args      struct {
+		File string `positional-arg-name:"file" description:"Access log file to replay, gzip compressed if its name ends with .gz"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// runBench replays the file of c through the pipeline of e and prints the
+// results
+func runBench(c *BenchCommand, e *exporter.Exporter) error {
+	return e.Bench(os.Stdout, c.Args.File, c.Namespace, c.Rate)
+}
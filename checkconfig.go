@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// CheckConfigCommand is a struct
+type CheckConfigCommand struct{}
+
+// checkConfig checks cfg like a start of the exporter would, without
+// starting it, and writes the problems found to w. It reports whether cfg is
+// valid.
+func checkConfig(cfg Config, w io.Writer) bool {
+	var problems []error
+	if err := web.Validate(cfg.ListenConfig.WebConfigFile); err != nil {
+		problems = append(problems, fmt.Errorf("web configuration file: %s", err))
+	}
+
+	// Formats, buckets, labels and the configuration file are checked by
+	// creating the exporter, the metric names by registering its metrics
+	e, err := exporter.New(cfg.Config)
+	if err != nil {
+		problems = append(problems, err)
+	} else {
+		if _, err := newRegistry(cfg.ListenConfig, cfg.Labels, e.Collector()); err != nil {
+			problems = append(problems, err)
+		}
+		problems = append(problems, e.CheckInputs()...)
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(w, "FAILED:", p)
+	}
+	if len(problems) > 0 {
+		return false
+	}
+
+	fmt.Fprintln(w, "SUCCESS: configuration is valid")
+	return true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// handleUSR1 logs the status of e and the metrics gathered by g and reopens
+// the followed files on every SIGUSR1
+func handleUSR1(e *exporter.Exporter, g prometheus.Gatherer) {
+	signals := make(chan os.Signal, 1)
+	notifyUSR1(signals)
+
+	go func() {
+		for sig := range signals {
+			slog.Info("Dumping the status and reopening the files", "signal", sig)
+			logStatus(e, g)
+			e.Reopen()
+		}
+	}()
+}
+
+// logStatus logs the state of every file and the number of series of every
+// metric, like /api/v1/status serves them
+func logStatus(e *exporter.Exporter, g prometheus.Gatherer) {
+	s, err := currentStatus(e, g)
+	if err != nil {
+		slog.Error("Error while gathering the status", "err", err)
+		return
+	}
+
+	uptime := time.Duration(s.UptimeSeconds * float64(time.Second)).Round(time.Second)
+	slog.Info("Status", "version", s.Version, "revision", s.Revision, "uptime", uptime)
+
+	for _, f := range s.Files {
+		attrs := []any{
+			"namespace", f.Namespace, "file", f.File,
+			"lines_read", f.LinesRead, "parsed_ok", f.ParsedOK, "parse_errors", f.ParseError, "skipped", f.Skipped,
+		}
+		if f.Offset != nil {
+			attrs = append(attrs, "offset", *f.Offset)
+		}
+		if f.LagBytes != nil {
+			attrs = append(attrs, "lag_bytes", *f.LagBytes)
+		}
+		slog.Info("File status", attrs...)
+	}
+
+	names := make([]string, 0, len(s.Cardinality))
+	for name := range s.Cardinality {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		slog.Info("Metric series", "metric", name, "series", s.Cardinality[name])
+	}
+}
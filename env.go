@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// envPrefix is the prefix of the environment variables setting options
+const envPrefix = "NGINX_EXPORTER_"
+
+var unmarshalerType = reflect.TypeOf((*flags.Unmarshaler)(nil)).Elem()
+
+// envKey returns the environment variable setting the option with the long
+// name, e.g. NGINX_EXPORTER_WEB_LISTEN_ADDRESS for web.listen-address
+func envKey(long string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(long))
+}
+
+// setEnvKeys lets every option of the exporter, except for --version, be
+// set by its environment variable, which takes precedence over the default
+// and is overridden by the flag. Options with an environment variable of
+// their own, like --kubernetes.pod-name, keep it. The values of options
+// which may be given more than once are separated by commas. The options of
+// subcommands are flags only.
+func setEnvKeys(p *flags.Parser) error {
+	seen := make(map[string]string)
+
+	var walk func(g *flags.Group) error
+	walk = func(g *flags.Group) error {
+		for _, o := range g.Options() {
+			if o.LongName == "" || o.LongName == "version" {
+				continue
+			}
+
+			key := o.EnvDefaultKey
+			if key == "" {
+				key = envKey(o.LongName)
+			}
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("options --%s and --%s share the environment variable %s", other, o.LongName, key)
+			}
+			seen[key] = o.LongName
+			o.EnvDefaultKey = key
+
+			// Lists with their own flag format, like the comma separated
+			// ones, are passed on as a whole
+			t := reflect.TypeOf(o.Value())
+			if !reflect.PtrTo(t).Implements(unmarshalerType) && (t.Kind() == reflect.Slice || t.Kind() == reflect.Map) {
+				o.EnvDefaultDelim = ","
+			}
+		}
+
+		for _, sub := range g.Groups() {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(p.Group)
+}
+
+// explicitOptions returns the long names of the options of the exporter
+// given as flag or by their environment variable. go-flags counts an option
+// set by its default or its environment variable as set by its default.
+func explicitOptions(p *flags.Parser) map[string]bool {
+	set := make(map[string]bool)
+
+	var walk func(g *flags.Group)
+	walk = func(g *flags.Group) {
+		for _, o := range g.Options() {
+			if o.LongName == "" || !o.IsSet() {
+				continue
+			}
+
+			_, env := os.LookupEnv(o.EnvDefaultKey)
+			if !o.IsSetDefault() || (o.EnvDefaultKey != "" && env) {
+				set[o.LongName] = true
+			}
+		}
+
+		for _, sub := range g.Groups() {
+			walk(sub)
+		}
+	}
+
+	walk(p.Group)
+	return set
+}
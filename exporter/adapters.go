@@ -0,0 +1,263 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+const (
+	// apacheCombinedFormat is the combined LogFormat of Apache httpd,
+	// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+	apacheCombinedFormat = `$remote_addr $remote_ident $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+	// apacheCommonFormat is the common LogFormat of Apache httpd
+	apacheCommonFormat = `$remote_addr $remote_ident $remote_user [$time_local] "$request" $status $body_bytes_sent`
+
+	// traefikCLFFormat is the common log format of the Traefik access log
+	traefikCLFFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $traefik_requests "$router" "$upstream_addr" $traefik_duration`
+)
+
+// apacheParser parses the combined and common logs of Apache httpd
+type apacheParser struct {
+	combined, common LineParser
+}
+
+func newApacheParser(c LogConfig, format string) (LineParser, error) {
+	combined, err := newTextParser(c, apacheCombinedFormat)
+	if err != nil {
+		return nil, err
+	}
+	common, err := newTextParser(c, apacheCommonFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &apacheParser{combined: combined, common: common}, nil
+}
+
+// ParseFields parses a line of the combined or the common Apache log format.
+// A size of -, which Apache logs for responses without body, is 0.
+func (p *apacheParser) ParseFields(line string) (gonx.Fields, error) {
+	fields, err := p.combined.ParseFields(line)
+	if err != nil {
+		if fields, err = p.common.ParseFields(line); err != nil {
+			return nil, err
+		}
+	}
+
+	if fields["body_bytes_sent"] == "-" {
+		fields["body_bytes_sent"] = "0"
+	}
+	return fields, nil
+}
+
+// caddyParser parses the JSON access logs of Caddy
+type caddyParser struct{}
+
+// caddyLine is a line of the Caddy access log
+type caddyLine struct {
+	Logger   string      `json:"logger"`
+	TS       json.Number `json:"ts"`
+	Duration json.Number `json:"duration"`
+	Size     json.Number `json:"size"`
+	Status   json.Number `json:"status"`
+	Request  struct {
+		RemoteIP string              `json:"remote_ip"`
+		ClientIP string              `json:"client_ip"`
+		Proto    string              `json:"proto"`
+		Method   string              `json:"method"`
+		Host     string              `json:"host"`
+		URI      string              `json:"uri"`
+		Headers  map[string][]string `json:"headers"`
+		TLS      *struct {
+			Version json.Number `json:"version"`
+		} `json:"tls"`
+	} `json:"request"`
+}
+
+// tlsVersions maps the TLS versions logged as number by Caddy to the
+// protocol names of $ssl_protocol
+var tlsVersions = map[string]string{
+	"769": "TLSv1",
+	"770": "TLSv1.1",
+	"771": "TLSv1.2",
+	"772": "TLSv1.3",
+}
+
+// ParseFields maps the fields of a Caddy access log line to the nginx
+// variables. Lines of other loggers than the access log are skipped.
+func (p *caddyParser) ParseFields(line string) (gonx.Fields, error) {
+	var l caddyLine
+	dec := json.NewDecoder(bytes.NewBufferString(line))
+	dec.UseNumber()
+	if err := dec.Decode(&l); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(l.Logger, "http.log.access") {
+		return nil, errSkipLine
+	}
+
+	r := l.Request
+	remoteAddr := r.ClientIP
+	if remoteAddr == "" {
+		remoteAddr = r.RemoteIP
+	}
+
+	fields := gonx.Fields{
+		"remote_addr":     remoteAddr,
+		"request":         r.Method + " " + r.URI + " " + r.Proto,
+		"request_method":  r.Method,
+		"request_uri":     r.URI,
+		"server_protocol": r.Proto,
+		"host":            r.Host,
+		"status":          l.Status.String(),
+		"body_bytes_sent": l.Size.String(),
+		"request_time":    l.Duration.String(),
+		"msec":            l.TS.String(),
+	}
+	if ua := r.Headers["User-Agent"]; len(ua) > 0 {
+		fields["http_user_agent"] = ua[0]
+	}
+	if referer := r.Headers["Referer"]; len(referer) > 0 {
+		fields["http_referer"] = referer[0]
+	}
+	if r.TLS != nil {
+		fields["ssl_protocol"] = tlsVersions[r.TLS.Version.String()]
+	}
+
+	return withoutEmpty(fields), nil
+}
+
+// traefikParser parses the access logs of Traefik in the common log format
+// or as JSON
+type traefikParser struct {
+	clf LineParser
+}
+
+// traefikLine is a JSON line of the Traefik access log
+type traefikLine struct {
+	ClientHost            string      `json:"ClientHost"`
+	ClientUsername        string      `json:"ClientUsername"`
+	StartUTC              string      `json:"StartUTC"`
+	RequestMethod         string      `json:"RequestMethod"`
+	RequestPath           string      `json:"RequestPath"`
+	RequestProtocol       string      `json:"RequestProtocol"`
+	RequestHost           string      `json:"RequestHost"`
+	RequestContentSize    json.Number `json:"RequestContentSize"`
+	DownstreamStatus      json.Number `json:"DownstreamStatus"`
+	DownstreamContentSize json.Number `json:"DownstreamContentSize"`
+	Duration              json.Number `json:"Duration"`
+	OriginDuration        json.Number `json:"OriginDuration"`
+	OriginStatus          json.Number `json:"OriginStatus"`
+	RouterName            string      `json:"RouterName"`
+	ServiceURL            string      `json:"ServiceURL"`
+	TLSVersion            string      `json:"TLSVersion"`
+	TLSCipher             string      `json:"TLSCipher"`
+	UserAgent             string      `json:"request_User-Agent"`
+	Referer               string      `json:"request_Referer"`
+}
+
+func newTraefikParser(c LogConfig, format string) (LineParser, error) {
+	clf, err := newTextParser(c, traefikCLFFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &traefikParser{clf: clf}, nil
+}
+
+// ParseFields maps the fields of a Traefik access log line to the nginx
+// variables. The router is the variable router, durations are converted to
+// seconds.
+func (p *traefikParser) ParseFields(line string) (gonx.Fields, error) {
+	if strings.HasPrefix(line, "{") {
+		return p.parseJSON(line)
+	}
+
+	fields, err := p.clf.ParseFields(line)
+	if err != nil {
+		return nil, err
+	}
+
+	// The duration is logged in milliseconds like 12ms
+	if ms, err := strconv.ParseFloat(strings.TrimSuffix(fields["traefik_duration"], "ms"), 64); err == nil {
+		fields["request_time"] = strconv.FormatFloat(ms/1e3, 'f', -1, 64)
+	}
+	if upstream := fields["upstream_addr"]; upstream != "" {
+		fields["upstream_addr"] = traefikServiceAddr(upstream)
+	}
+	return fields, nil
+}
+
+// parseJSON parses a JSON line of the Traefik access log
+func (p *traefikParser) parseJSON(line string) (gonx.Fields, error) {
+	var l traefikLine
+	dec := json.NewDecoder(bytes.NewBufferString(line))
+	dec.UseNumber()
+	if err := dec.Decode(&l); err != nil {
+		return nil, err
+	}
+	if l.DownstreamStatus == "" {
+		return nil, errors.New("Traefik access log line without DownstreamStatus")
+	}
+
+	fields := gonx.Fields{
+		"remote_addr":     l.ClientHost,
+		"remote_user":     l.ClientUsername,
+		"time_iso8601":    l.StartUTC,
+		"request":         l.RequestMethod + " " + l.RequestPath + " " + l.RequestProtocol,
+		"request_method":  l.RequestMethod,
+		"request_uri":     l.RequestPath,
+		"server_protocol": l.RequestProtocol,
+		"host":            l.RequestHost,
+		"request_length":  l.RequestContentSize.String(),
+		"status":          l.DownstreamStatus.String(),
+		"body_bytes_sent": l.DownstreamContentSize.String(),
+		"router":          l.RouterName,
+		"upstream_addr":   traefikServiceAddr(l.ServiceURL),
+		"http_user_agent": l.UserAgent,
+		"http_referer":    l.Referer,
+	}
+	if l.TLSVersion != "" {
+		fields["ssl_protocol"] = "TLSv" + l.TLSVersion
+		fields["ssl_cipher"] = l.TLSCipher
+	}
+	if l.OriginStatus != "" {
+		fields["upstream_status"] = l.OriginStatus.String()
+	}
+
+	// Durations are logged in nanoseconds
+	fields = withoutEmpty(fields)
+	if ns, err := l.Duration.Int64(); err == nil {
+		fields["request_time"] = strconv.FormatFloat(time.Duration(ns).Seconds(), 'f', -1, 64)
+	}
+	if ns, err := l.OriginDuration.Int64(); err == nil {
+		fields["upstream_response_time"] = strconv.FormatFloat(time.Duration(ns).Seconds(), 'f', -1, 64)
+	}
+	return fields, nil
+}
+
+// withoutEmpty removes the fields which are missing in a line, so that they
+// are missing in its entry as well
+func withoutEmpty(fields gonx.Fields) gonx.Fields {
+	for name, value := range fields {
+		if value == "" {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+// traefikServiceAddr returns the address of the service URL of Traefik,
+// like 10.0.0.1:80 for http://10.0.0.1:80
+func traefikServiceAddr(serviceURL string) string {
+	if i := strings.Index(serviceURL, "://"); i >= 0 {
+		serviceURL = serviceURL[i+3:]
+	}
+	return strings.TrimSuffix(serviceURL, "/")
+}
@@ -0,0 +1,117 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+func TestAdapterParsers(t *testing.T) {
+	testParseFields(t, []parseTest{
+		{
+			name:   "apache combined",
+			config: LogConfig{FormatType: "apache"},
+			line:   `1.2.3.4 - frank [15/Oct/2026:10:00:00 -0700] "GET /a.gif HTTP/1.0" 304 - "https://example.com/" "Mozilla/5.0"`,
+			want: gonx.Fields{
+				"remote_addr":     "1.2.3.4",
+				"remote_ident":    "-",
+				"remote_user":     "frank",
+				"time_local":      "15/Oct/2026:10:00:00 -0700",
+				"request":         "GET /a.gif HTTP/1.0",
+				"status":          "304",
+				"body_bytes_sent": "0",
+				"http_referer":    "https://example.com/",
+				"http_user_agent": "Mozilla/5.0",
+			},
+		},
+		{
+			name:   "apache common",
+			config: LogConfig{FormatType: "apache"},
+			line:   `1.2.3.4 - - [15/Oct/2026:10:00:00 -0700] "GET / HTTP/1.1" 200 2326`,
+			want: gonx.Fields{
+				"remote_addr":     "1.2.3.4",
+				"remote_ident":    "-",
+				"remote_user":     "-",
+				"time_local":      "15/Oct/2026:10:00:00 -0700",
+				"request":         "GET / HTTP/1.1",
+				"status":          "200",
+				"body_bytes_sent": "2326",
+			},
+		},
+		{
+			name:   "caddy",
+			config: LogConfig{FormatType: "caddy"},
+			line:   `{"level":"info","ts":1760522400.123,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"10.0.0.1","client_ip":"1.2.3.4","proto":"HTTP/2.0","method":"GET","host":"example.com","uri":"/a?b=1","headers":{"User-Agent":["curl/8.0"]},"tls":{"version":772}},"duration":0.0123,"size":612,"status":200}`,
+			want: gonx.Fields{
+				"remote_addr":     "1.2.3.4",
+				"request":         "GET /a?b=1 HTTP/2.0",
+				"request_method":  "GET",
+				"request_uri":     "/a?b=1",
+				"server_protocol": "HTTP/2.0",
+				"host":            "example.com",
+				"status":          "200",
+				"body_bytes_sent": "612",
+				"request_time":    "0.0123",
+				"msec":            "1760522400.123",
+				"http_user_agent": "curl/8.0",
+				"ssl_protocol":    "TLSv1.3",
+			},
+		},
+		{
+			name:   "caddy other logger",
+			config: LogConfig{FormatType: "caddy"},
+			line:   `{"level":"info","ts":1760522400.123,"logger":"tls","msg":"certificate obtained"}`,
+			skip:   true,
+		},
+		{
+			name:   "traefik clf",
+			config: LogConfig{FormatType: "traefik"},
+			line:   `1.2.3.4 - - [15/Oct/2026:10:00:00 +0000] "GET /a HTTP/1.1" 200 612 "-" "curl/8.0" 42 "web@docker" "http://10.0.0.2:80" 12ms`,
+			want: gonx.Fields{
+				"remote_addr":      "1.2.3.4",
+				"remote_user":      "-",
+				"time_local":       "15/Oct/2026:10:00:00 +0000",
+				"request":          "GET /a HTTP/1.1",
+				"status":           "200",
+				"body_bytes_sent":  "612",
+				"http_referer":     "-",
+				"http_user_agent":  "curl/8.0",
+				"traefik_requests": "42",
+				"router":           "web@docker",
+				"upstream_addr":    "10.0.0.2:80",
+				"traefik_duration": "12ms",
+				"request_time":     "0.012",
+			},
+		},
+		{
+			name:   "traefik json",
+			config: LogConfig{FormatType: "traefik"},
+			line:   `{"ClientHost":"1.2.3.4","StartUTC":"2026-10-15T10:00:00Z","RequestMethod":"GET","RequestPath":"/a","RequestProtocol":"HTTP/1.1","RequestHost":"example.com","RequestContentSize":0,"DownstreamStatus":200,"DownstreamContentSize":612,"Duration":12000000,"OriginDuration":10000000,"OriginStatus":200,"RouterName":"web@docker","ServiceURL":"http://10.0.0.2:80","TLSVersion":"1.3","TLSCipher":"TLS_AES_128_GCM_SHA256","request_User-Agent":"curl/8.0"}`,
+			want: gonx.Fields{
+				"remote_addr":            "1.2.3.4",
+				"time_iso8601":           "2026-10-15T10:00:00Z",
+				"request":                "GET /a HTTP/1.1",
+				"request_method":         "GET",
+				"request_uri":            "/a",
+				"server_protocol":        "HTTP/1.1",
+				"host":                   "example.com",
+				"request_length":         "0",
+				"status":                 "200",
+				"body_bytes_sent":        "612",
+				"router":                 "web@docker",
+				"upstream_addr":          "10.0.0.2:80",
+				"http_user_agent":        "curl/8.0",
+				"ssl_protocol":           "TLSv1.3",
+				"ssl_cipher":             "TLS_AES_128_GCM_SHA256",
+				"upstream_status":        "200",
+				"request_time":           "0.012",
+				"upstream_response_time": "0.01",
+			},
+		},
+		{
+			name:   "traefik json without status",
+			config: LogConfig{FormatType: "traefik"},
+			line:   `{"level":"info","msg":"Configuration loaded"}`,
+		},
+	})
+}
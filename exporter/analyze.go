@@ -0,0 +1,248 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/satyrius/gonx"
+)
+
+// analysis collects the requests processed by a namespace for Analyze. It
+// is only used from the goroutine processing the lines.
+type analysis struct {
+	requests    int64
+	parseErrors int64
+	bytes       float64
+	statuses    map[string]int64
+	methods     map[string]int64
+	routes      map[string]int64
+	durations   []float64
+	first, last time.Time
+}
+
+func newAnalysis() *analysis {
+	return &analysis{
+		statuses: make(map[string]int64),
+		methods:  make(map[string]int64),
+		routes:   make(map[string]int64),
+	}
+}
+
+// add counts the request of entry
+func (a *analysis) add(ns *namespace, entry *gonx.Entry) {
+	if a == nil {
+		return
+	}
+
+	a.requests++
+	a.statuses[ns.fieldValue(entry, "status")]++
+	a.methods[ns.fieldValue(entry, "method")]++
+	a.routes[ns.fieldValue(entry, "path")]++
+
+	if bytes, err := entry.FloatField("body_bytes_sent"); err == nil {
+		a.bytes += bytes
+	}
+	if duration, err := entry.FloatField("request_time"); err == nil {
+		a.durations = append(a.durations, duration)
+	}
+
+	if t, ok := entryTime(entry); ok {
+		if a.first.IsZero() || t.Before(a.first) {
+			a.first = t
+		}
+		if t.After(a.last) {
+			a.last = t
+		}
+	}
+}
+
+// parseError counts a line which could not be parsed
+func (a *analysis) parseError() {
+	if a != nil {
+		a.parseErrors++
+	}
+}
+
+// analysisReport is the report written by Analyze
+type analysisReport struct {
+	Files       []string         `json:"files"`
+	From        *time.Time       `json:"from,omitempty"`
+	To          *time.Time       `json:"to,omitempty"`
+	Requests    int64            `json:"requests"`
+	ParseErrors int64            `json:"parse_errors"`
+	Bytes       float64          `json:"bytes"`
+	Statuses    map[string]int64 `json:"statuses"`
+	Methods     map[string]int64 `json:"methods"`
+	TopRoutes   []routeCount     `json:"top_routes"`
+	Latency     *latencyReport   `json:"latency_seconds,omitempty"`
+}
+
+// routeCount is the number of requests of a route
+type routeCount struct {
+	Route    string `json:"route"`
+	Requests int64  `json:"requests"`
+}
+
+// latencyReport holds percentiles of $request_time
+type latencyReport struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// report returns the report of a with the top routes by requests
+func (a *analysis) report(files []string, top int) analysisReport {
+	r := analysisReport{
+		Files:       files,
+		Requests:    a.requests,
+		ParseErrors: a.parseErrors,
+		Bytes:       a.bytes,
+		Statuses:    a.statuses,
+		Methods:     a.methods,
+		TopRoutes:   []routeCount{},
+	}
+
+	if !a.first.IsZero() {
+		r.From, r.To = &a.first, &a.last
+	}
+
+	for route, n := range a.routes {
+		r.TopRoutes = append(r.TopRoutes, routeCount{Route: route, Requests: n})
+	}
+	sort.Slice(r.TopRoutes, func(i, j int) bool {
+		if r.TopRoutes[i].Requests != r.TopRoutes[j].Requests {
+			return r.TopRoutes[i].Requests > r.TopRoutes[j].Requests
+		}
+		return r.TopRoutes[i].Route < r.TopRoutes[j].Route
+	})
+	if len(r.TopRoutes) > top {
+		r.TopRoutes = r.TopRoutes[:top]
+	}
+
+	if len(a.durations) > 0 {
+		sort.Float64s(a.durations)
+		r.Latency = &latencyReport{
+			P50: percentile(a.durations, 0.5),
+			P90: percentile(a.durations, 0.9),
+			P99: percentile(a.durations, 0.99),
+			Max: a.durations[len(a.durations)-1],
+		}
+	}
+	return r
+}
+
+// percentile returns the q-th percentile of the sorted values with the
+// nearest rank method
+func percentile(sorted []float64, q float64) float64 {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Analyze processes files, which are decompressed if their name ends with
+// .gz, with the pipeline of namespace, or the first namespace if it is
+// empty, and writes a report of their requests to w. The report lists the
+// requests by status and method, the top routes by requests, the
+// percentiles of $request_time and the bytes sent. format is text or json.
+// The metrics of the namespace are updated with the lines of files.
+func (e *Exporter) Analyze(w io.Writer, files []string, namespace, format string, top int) error {
+	ns, err := e.namespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	ns.analysis = newAnalysis()
+	for _, file := range files {
+		if err := analyzeFile(ns, file); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	r := ns.analysis.report(files, top)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "", "text":
+		writeAnalysisReport(w, r)
+		return nil
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+}
+
+// analyzeFile processes the lines of file with the pipeline of ns
+func analyzeFile(ns *namespace, file string) error {
+	r, err := tail.OpenRotated(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	readErr := make(chan error, 1)
+	t := tail.NewReaderFollower(r)
+	t.OnError(func(err error) {
+		readErr <- err
+	})
+
+	fields, _ := ns.config.Kubernetes.fileFields(file)
+	processLogFile(ns, file, t, fields, false)
+
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// writeAnalysisReport writes r as text to w
+func writeAnalysisReport(w io.Writer, r analysisReport) {
+	fmt.Fprintf(w, "files           %d\n", len(r.Files))
+	if r.From != nil {
+		fmt.Fprintf(w, "from            %s\n", r.From.Format(time.RFC3339))
+		fmt.Fprintf(w, "to              %s\n", r.To.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "requests        %d\n", r.Requests)
+	fmt.Fprintf(w, "parse errors    %d\n", r.ParseErrors)
+	fmt.Fprintf(w, "bytes           %.0f\n", r.Bytes)
+
+	writeCounts(w, "status", r.Statuses)
+	writeCounts(w, "method", r.Methods)
+
+	fmt.Fprintln(w, "\ntop routes")
+	for _, rc := range r.TopRoutes {
+		fmt.Fprintf(w, "  %-40s %d\n", rc.Route, rc.Requests)
+	}
+
+	if r.Latency != nil {
+		fmt.Fprintln(w, "\nlatency")
+		fmt.Fprintf(w, "  p50           %gs\n", r.Latency.P50)
+		fmt.Fprintf(w, "  p90           %gs\n", r.Latency.P90)
+		fmt.Fprintf(w, "  p99           %gs\n", r.Latency.P99)
+		fmt.Fprintf(w, "  max           %gs\n", r.Latency.Max)
+	}
+}
+
+// writeCounts writes the requests by value of a field sorted by value
+func writeCounts(w io.Writer, title string, counts map[string]int64) {
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	fmt.Fprintf(w, "\n%s\n", title)
+	for _, value := range values {
+		fmt.Fprintf(w, "  %-13s %d\n", value, counts[value])
+	}
+}
@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// anonymizedFields are the log variables holding client addresses
+var anonymizedFields = []string{"remote_addr", "realip_remote_addr", "http_x_real_ip", "http_x_forwarded_for"}
+
+// addressCandidate matches everything in a log line which might be an IPv4
+// or IPv6 address
+var addressCandidate = regexp.MustCompile(`[0-9A-Fa-f:.]*[:.][0-9A-Fa-f:.]+`)
+
+// AnonymizeConfig is a struct
+type AnonymizeConfig struct {
+	Mode       string `long:"anonymize-ip" choice:"none" choice:"truncate" choice:"hmac" default:"none" description:"Anonymize client addresses before they are used in labels or logged, truncate zeroes the host part and hmac replaces them with a keyed hash"`
+	IPv4Prefix int    `long:"anonymize-ip.ipv4-prefix" default:"24" description:"Number of bits of IPv4 addresses kept by --anonymize-ip truncate"`
+	IPv6Prefix int    `long:"anonymize-ip.ipv6-prefix" default:"64" description:"Number of bits of IPv6 addresses kept by --anonymize-ip truncate"`
+	HMACKey    string `long:"anonymize-ip.hmac-key" description:"Secret key used by --anonymize-ip hmac"`
+}
+
+// anonymizer replaces client addresses by anonymized values
+type anonymizer struct {
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+	key      []byte
+}
+
+// newAnonymizer creates the anonymizer for c. It returns nil if addresses are
+// not anonymized.
+func newAnonymizer(c AnonymizeConfig) (*anonymizer, error) {
+	switch c.Mode {
+	case "", "none":
+		return nil, nil
+	case "truncate":
+		if c.IPv4Prefix < 0 || c.IPv4Prefix > 32 {
+			return nil, fmt.Errorf("invalid IPv4 prefix length %d", c.IPv4Prefix)
+		}
+		if c.IPv6Prefix < 0 || c.IPv6Prefix > 128 {
+			return nil, fmt.Errorf("invalid IPv6 prefix length %d", c.IPv6Prefix)
+		}
+		return &anonymizer{
+			ipv4Mask: net.CIDRMask(c.IPv4Prefix, 32),
+			ipv6Mask: net.CIDRMask(c.IPv6Prefix, 128),
+		}, nil
+	case "hmac":
+		if c.HMACKey == "" {
+			return nil, fmt.Errorf("--anonymize-ip hmac requires --anonymize-ip.hmac-key")
+		}
+		return &anonymizer{key: []byte(c.HMACKey)}, nil
+	default:
+		return nil, fmt.Errorf("unknown anonymization mode '%s'", c.Mode)
+	}
+}
+
+// address returns the anonymized form of the address s, or s itself if it is
+// no address
+func (a *anonymizer) address(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+
+	if a.key != nil {
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write(ip)
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(a.ipv4Mask).String()
+	}
+	return ip.Mask(a.ipv6Mask).String()
+}
+
+// anonymize replaces the client addresses of entry
+func (a *anonymizer) anonymize(entry *gonx.Entry) {
+	if a == nil {
+		return
+	}
+
+	for _, field := range anonymizedFields {
+		value, err := entry.Field(field)
+		if err != nil {
+			continue
+		}
+
+		hops := strings.Split(value, ",")
+		for i, hop := range hops {
+			hops[i] = a.address(strings.TrimSpace(hop))
+		}
+		entry.SetField(field, strings.Join(hops, ", "))
+	}
+}
+
+// text replaces all addresses in a log line so that it can be logged
+func (a *anonymizer) text(line string) string {
+	if a == nil {
+		return line
+	}
+	return addressCandidate.ReplaceAllStringFunc(line, a.address)
+}
@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+func TestAnonymizer(t *testing.T) {
+	truncate, err := newAnonymizer(AnonymizeConfig{Mode: "truncate", IPv4Prefix: 24, IPv6Prefix: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmac, err := newAnonymizer(AnonymizeConfig{Mode: "hmac", HMACKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := newAnonymizer(AnonymizeConfig{Mode: "hmac", HMACKey: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"192.0.2.123", "192.0.2.0"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::"},
+		{"::ffff:192.0.2.123", "192.0.2.0"},
+		{"unix:", "unix:"},
+		{"-", "-"},
+	}
+	for _, test := range tests {
+		if got := truncate.address(test.address); got != test.want {
+			t.Errorf("truncated %s to %s, want %s", test.address, got, test.want)
+		}
+	}
+
+	hashed := hmac.address("192.0.2.123")
+	if len(hashed) != 16 || hashed != hmac.address("192.0.2.123") {
+		t.Errorf("hashed 192.0.2.123 to %s, which is no stable 16 digit hash", hashed)
+	}
+	if hashed == hmac.address("192.0.2.124") || hashed == otherKey.address("192.0.2.123") {
+		t.Error("different addresses or keys hashed to the same value")
+	}
+
+	entry := gonx.NewEntry(gonx.Fields{
+		"remote_addr":          "192.0.2.123",
+		"http_x_forwarded_for": "198.51.100.7, 2001:db8::1",
+		"request":              "GET /192.0.2.123 HTTP/1.1",
+	})
+	truncate.anonymize(entry)
+	for field, want := range map[string]string{
+		"remote_addr":          "192.0.2.0",
+		"http_x_forwarded_for": "198.51.100.0, 2001:db8::",
+		"request":              "GET /192.0.2.123 HTTP/1.1",
+	} {
+		if got, _ := entry.Field(field); got != want {
+			t.Errorf("anonymized %s to %s, want %s", field, got, want)
+		}
+	}
+
+	line := `192.0.2.123 - - "GET / HTTP/1.1" 200 "2001:db8:1:2:3:4:5:6" 1.5`
+	want := `192.0.2.0 - - "GET / HTTP/1.1" 200 "2001:db8:1:2::" 1.5`
+	if got := truncate.text(line); got != want {
+		t.Errorf("anonymized line to %s, want %s", got, want)
+	}
+
+	var none *anonymizer
+	if got := none.text(line); got != line {
+		t.Errorf("line changed to %s without anonymization", got)
+	}
+}
+
+func TestNewAnonymizer(t *testing.T) {
+	tests := []struct {
+		config AnonymizeConfig
+		valid  bool
+	}{
+		{AnonymizeConfig{Mode: "none"}, true},
+		{AnonymizeConfig{Mode: "truncate", IPv4Prefix: 33, IPv6Prefix: 64}, false},
+		{AnonymizeConfig{Mode: "truncate", IPv4Prefix: 24, IPv6Prefix: 129}, false},
+		{AnonymizeConfig{Mode: "hmac"}, false},
+		{AnonymizeConfig{Mode: "unknown"}, false},
+	}
+
+	for _, test := range tests {
+		if _, err := newAnonymizer(test.config); (err == nil) != test.valid {
+			t.Errorf("%+v: error %v", test.config, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package exporter
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/satyrius/gonx"
+)
+
+// Apdex zones of a request, which label http_apdex_requests_total
+const (
+	apdexSatisfied  = "satisfied"
+	apdexTolerating = "tolerating"
+	apdexFrustrated = "frustrated"
+)
+
+// apdexThresholds returns the response times up to which requests are
+// satisfied and tolerating. The tolerating threshold defaults to four times
+// the target.
+func (c MetricsConfig) apdexThresholds() (float64, float64) {
+	if c.ApdexTolerating > 0 {
+		return c.ApdexTarget, c.ApdexTolerating
+	}
+	return c.ApdexTarget, 4 * c.ApdexTarget
+}
+
+// observeApdex counts the request of entry in its Apdex zone, which is
+// determined by $request_time. Server errors are frustrated regardless of
+// their response time.
+func observeApdex(ns *namespace, entry *gonx.Entry, labelValues []string) {
+	if ns.metrics.apdexRequests == nil {
+		return
+	}
+
+	responseTime, err := entry.FloatField("request_time")
+	if err != nil {
+		return
+	}
+
+	satisfied, tolerating := ns.metricsConfig.apdexThresholds()
+	status, _ := entry.Field("status")
+
+	zone := apdexFrustrated
+	switch {
+	case statusClass(status) == "5xx":
+	case responseTime <= satisfied:
+		zone = apdexSatisfied
+	case responseTime <= tolerating:
+		zone = apdexTolerating
+	}
+
+	ns.metrics.apdexRequests.add(append(append([]string{}, labelValues...), zone), 1)
+}
+
+// apdexScore reports the Apdex score of every label set of the requests
+// counted by http_apdex_requests_total. It implements prometheus.Collector.
+type apdexScore struct {
+	desc     *prometheus.Desc
+	labels   []string
+	requests *prometheus.CounterVec
+}
+
+// newApdexScore creates the score named name of the requests by zone, which
+// have the given labels and zone
+func newApdexScore(namespace, name string, labels []string, requests *prometheus.CounterVec) *apdexScore {
+	return &apdexScore{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", name),
+			"Apdex score of the requests since the start of the exporter, the share of satisfied requests plus half the share of tolerating requests",
+			labels, nil,
+		),
+		labels:   labels,
+		requests: requests,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (a *apdexScore) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.desc
+}
+
+// Collect implements prometheus.Collector. The score is computed from the
+// current series of the requests, so it follows their expiry and series
+// limit.
+func (a *apdexScore) Collect(ch chan<- prometheus.Metric) {
+	type zones struct {
+		values                            []string
+		satisfied, tolerating, frustrated float64
+	}
+	scores := make(map[string]*zones)
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		a.requests.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+
+		// The labels of pb are sorted by name
+		labels := make(map[string]string, len(pb.Label))
+		for _, l := range pb.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		values := make([]string, len(a.labels))
+		for i, name := range a.labels {
+			values[i] = labels[name]
+		}
+
+		key := strings.Join(values, "\xff")
+		z, ok := scores[key]
+		if !ok {
+			z = &zones{values: values}
+			scores[key] = z
+		}
+
+		switch labels["zone"] {
+		case apdexSatisfied:
+			z.satisfied += pb.GetCounter().GetValue()
+		case apdexTolerating:
+			z.tolerating += pb.GetCounter().GetValue()
+		case apdexFrustrated:
+			z.frustrated += pb.GetCounter().GetValue()
+		}
+	}
+
+	for _, z := range scores {
+		total := z.satisfied + z.tolerating + z.frustrated
+		if total == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(a.desc, prometheus.GaugeValue, (z.satisfied+z.tolerating/2)/total, z.values...)
+	}
+}
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/satyrius/gonx"
+)
+
+// autoFormat is the format which detects the format of the log lines
+const autoFormat = "auto"
+
+// autoReportLines is the number of lines matching no format after which
+// the failed detection is logged as error
+const autoReportLines = 10
+
+// autoCandidate is a format tried by the format detection
+type autoCandidate struct {
+	name   string
+	parser LineParser
+	// accepts tells whether a line may be of the format at all, which keeps
+	// formats accepting almost any line from being detected by accident
+	accepts func(line string) bool
+}
+
+// autoParser detects the format of the log lines. The first line matching
+// one of the candidate formats decides the format of all lines. Lines
+// before are parse errors.
+type autoParser struct {
+	mu         sync.RWMutex
+	candidates []autoCandidate
+	detected   LineParser
+	failed     int
+}
+
+// newAutoParser creates the parser detecting the formats of the presets,
+// the default format, JSON and LTSV. Text formats are parsed by the
+// configured parser.
+func newAutoParser(c LogConfig) (LineParser, error) {
+	formats := []struct{ name, format string }{
+		{"default", combinedFormat + ` "$http_x_forwarded_for" $request_time`},
+		{"combined_plus_time", formatPresets["combined_plus_time"]},
+		{"combined", formatPresets["combined"]},
+		{"common", formatPresets["common"]},
+	}
+
+	p := &autoParser{}
+	for _, f := range formats {
+		parser, err := newTextParser(c, f.format)
+		if err != nil {
+			return nil, err
+		}
+		p.candidates = append(p.candidates, autoCandidate{name: f.name, parser: parser})
+	}
+	p.candidates = append(p.candidates,
+		autoCandidate{name: "json", parser: &jsonParser{fields: c.JSONFields}, accepts: func(line string) bool {
+			return strings.HasPrefix(line, "{")
+		}},
+		autoCandidate{name: "ltsv", parser: &ltsvParser{fields: c.JSONFields}, accepts: func(line string) bool {
+			return strings.Contains(line, "\t")
+		}},
+	)
+	return p, nil
+}
+
+// ParseFields parses line with the detected format, or detects it if no line
+// has matched a format yet
+func (p *autoParser) ParseFields(line string) (gonx.Fields, error) {
+	p.mu.RLock()
+	detected := p.detected
+	p.mu.RUnlock()
+	if detected != nil {
+		return detected.ParseFields(line)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.detected != nil {
+		return p.detected.ParseFields(line)
+	}
+
+	names := make([]string, len(p.candidates))
+	for i, c := range p.candidates {
+		names[i] = c.name
+		if c.accepts != nil && !c.accepts(line) {
+			continue
+		}
+		if fields, err := c.parser.ParseFields(line); err == nil {
+			slog.Info("Detected the log format", "format", c.name)
+			p.detected = c.parser
+			return fields, nil
+		}
+	}
+
+	p.failed++
+	if p.failed == autoReportLines {
+		slog.Error("Could not detect the log format, set it with --format or --format-type", "lines", p.failed, "tried", strings.Join(names, ", "), "line", line)
+	}
+	return nil, fmt.Errorf("line matches none of the formats %s", strings.Join(names, ", "))
+}
@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+func TestAutoParser(t *testing.T) {
+	defaultLine := combinedLine + ` "-" 0.012`
+	defaultFields := gonx.Fields{"http_x_forwarded_for": "-", "request_time": "0.012"}
+	for name, value := range combinedFields {
+		defaultFields[name] = value
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		// want are the fields of the lines, nil for lines failing
+		want []gonx.Fields
+	}{
+		{
+			name:  "default",
+			lines: []string{defaultLine, combinedLine},
+			want:  []gonx.Fields{defaultFields, nil},
+		},
+		{
+			name:  "combined after an unknown line",
+			lines: []string{"starting", combinedLine, defaultLine},
+			want:  []gonx.Fields{nil, combinedFields, nil},
+		},
+		{
+			name:  "json",
+			lines: []string{`{"status":"200"}`, "status:200\tsize:12"},
+			want:  []gonx.Fields{{"status": "200"}, nil},
+		},
+		{
+			name:  "ltsv",
+			lines: []string{"status:200\tsize:12", "status:404"},
+			want:  []gonx.Fields{{"status": "200", "body_bytes_sent": "12"}, {"status": "404"}},
+		},
+		{
+			// A line without tabs is no LTSV line, though it would parse
+			name:  "no ltsv without tabs",
+			lines: []string{"status:200"},
+			want:  []gonx.Fields{nil},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := newParser(LogConfig{}, autoFormat, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, line := range test.lines {
+			fields, err := p.ParseFields(line)
+			want := test.want[i]
+			switch {
+			case want == nil && err == nil:
+				t.Errorf("%s: line %d parsed as %v", test.name, i+1, fields)
+			case want != nil && err != nil:
+				t.Errorf("%s: line %d: %s", test.name, i+1, err)
+			case want != nil && !reflect.DeepEqual(fields, want):
+				t.Errorf("%s: line %d: fields %v, want %v", test.name, i+1, fields, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package exporter
+
+import (
+	"log/slog"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+)
+
+// backfill replays the rotated files of the log file of ns from the oldest
+// to the newest. Nothing is replayed if the log file has a saved position,
+// as its rotated files have been read by an earlier run then. It returns
+// false if there was nothing to replay.
+func backfill(ns *namespace, fields map[string]string) bool {
+	if _, ok := ns.positions.Get(ns.config.FileName); ok {
+		return false
+	}
+
+	files, err := tail.RotatedFiles(ns.config.FileName, ns.config.BackfillMaxAge)
+	if err != nil {
+		slog.Error("Error while looking for rotated files", "file", ns.config.FileName, "err", err)
+		return false
+	}
+	if len(files) == 0 {
+		return false
+	}
+
+	// The position of the log file is saved before replaying, so that a
+	// restart during the backfill does not replay the rotated files again.
+	// The lines not replayed yet are lost then rather than counted twice.
+	if err := ns.positions.Begin(ns.config.FileName); err != nil {
+		slog.Error("Error while saving the position of the log file, not replaying its rotated files", "file", ns.config.FileName, "err", err)
+		return false
+	}
+
+	for _, name := range files {
+		r, err := tail.OpenRotated(name)
+		if err != nil {
+			slog.Error("Error while replaying file", "file", name, "err", err)
+			continue
+		}
+
+		slog.Info("Replaying rotated file", "file", name)
+
+		t := tail.NewReaderFollower(r)
+		name := name
+		t.OnError(func(err error) {
+			slog.Error("Error while replaying file", "file", name, "err", err)
+		})
+
+		processLogFile(ns, name, t, fields, false)
+		t.Stop()
+		r.Close()
+	}
+
+	return true
+}
+
+// followLogFile follows the log file of ns, after replaying its rotated
+// files if backfilling is enabled
+func followLogFile(ns *namespace, fields map[string]string) {
+	config := ns.followerConfig()
+	if ns.config.Backfill && backfill(ns, fields) {
+		// The current file has not been read either
+		config.FromBeginning = true
+	}
+
+	t, err := tail.NewFollower(ns.config.FileName, config)
+	if err != nil {
+		ns.fail(err)
+		return
+	}
+
+	t.OnError(ns.fail)
+
+	ns.telemetry.tailLags.add(ns.config.Name, ns.config.FileName, t)
+	defer ns.telemetry.tailLags.remove(t)
+
+	ns.telemetry.pipelines.add(ns.config.Name, ns.config.FileName, t)
+	processInput(ns, ns.config.FileName, t, fields)
+}
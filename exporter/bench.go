@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+)
+
+// stageTimings accumulates the time spent in the stages of the pipeline.
+// A nil stageTimings does not measure anything.
+type stageTimings struct {
+	lines   int64
+	parse   int64
+	process int64
+}
+
+// start returns the start time of a stage
+func (s *stageTimings) start() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// parsed adds elapsed to the parse stage
+func (s *stageTimings) parsed(elapsed time.Duration) {
+	if s != nil {
+		atomic.AddInt64(&s.parse, int64(elapsed))
+	}
+}
+
+// processed adds the time since start to the process stage and counts the
+// line
+func (s *stageTimings) processed(start time.Time) {
+	if s != nil {
+		atomic.AddInt64(&s.process, int64(time.Since(start)))
+		atomic.AddInt64(&s.lines, 1)
+	}
+}
+
+// Bench replays file through the pipeline of namespace, or the first
+// namespace if it is empty, at rate lines per second or as fast as possible
+// if rate is 0. It writes the throughput, allocations and stage timings to
+// w. The metrics of the namespace are updated with the lines of file.
+func (e *Exporter) Bench(w io.Writer, file, namespace string, rate float64) error {
+	ns, err := e.namespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	r, err := tail.OpenRotated(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	readErr := make(chan error, 1)
+	var t tail.Follower = tail.NewReaderFollower(r)
+	t.OnError(func(err error) {
+		readErr <- err
+	})
+	if rate > 0 {
+		t = tail.NewPacedFollower(t, rate)
+	}
+
+	ns.timings = &stageTimings{}
+	fields, _ := ns.config.Kubernetes.fileFields(file)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	processLogFile(ns, file, t, fields, false)
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	select {
+	case err := <-readErr:
+		return err
+	default:
+	}
+
+	lines := ns.timings.lines
+	if lines == 0 {
+		return fmt.Errorf("file '%s' has no lines", file)
+	}
+
+	perLine := func(total int64) time.Duration {
+		return time.Duration(total / lines)
+	}
+
+	fmt.Fprintf(w, "lines           %d\n", lines)
+	fmt.Fprintf(w, "duration        %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "lines/sec       %.0f\n", float64(lines)/elapsed.Seconds())
+	fmt.Fprintf(w, "allocs/line     %.1f\n", float64(after.Mallocs-before.Mallocs)/float64(lines))
+	fmt.Fprintf(w, "bytes/line      %.0f\n", float64(after.TotalAlloc-before.TotalAlloc)/float64(lines))
+	fmt.Fprintf(w, "parse/line      %s\n", perLine(ns.timings.parse))
+	fmt.Fprintf(w, "process/line    %s\n", perLine(ns.timings.process))
+	return nil
+}
+
+// namespace returns the namespace called name, or the first namespace if
+// name is empty
+func (e *Exporter) namespace(name string) (*namespace, error) {
+	if name == "" {
+		return e.namespaces[0], nil
+	}
+	for _, ns := range e.namespaces {
+		if ns.config.Name == name {
+			return ns, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown namespace '%s'", name)
+}
@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/satyrius/gonx"
+)
+
+// genericCrawler is the crawler label of bots which match the generic
+// signature but none of the known crawlers
+const genericCrawler = "other"
+
+// botSignature matches the user agent of a crawler
+type botSignature struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// knownCrawlers are the built-in signatures of common crawlers
+var knownCrawlers = []botSignature{
+	{"Googlebot", regexp.MustCompile(`Googlebot|Google-InspectionTool|AdsBot-Google|Mediapartners-Google`)},
+	{"bingbot", regexp.MustCompile(`bingbot|BingPreview|adidxbot`)},
+	{"YandexBot", regexp.MustCompile(`YandexBot|YandexImages|YandexMobileBot`)},
+	{"Baiduspider", regexp.MustCompile(`Baiduspider`)},
+	{"DuckDuckBot", regexp.MustCompile(`DuckDuckBot`)},
+	{"Applebot", regexp.MustCompile(`Applebot`)},
+	{"Slurp", regexp.MustCompile(`Yahoo! Slurp`)},
+	{"facebookexternalhit", regexp.MustCompile(`facebookexternalhit|meta-externalagent`)},
+	{"Twitterbot", regexp.MustCompile(`Twitterbot`)},
+	{"LinkedInBot", regexp.MustCompile(`LinkedInBot`)},
+	{"AhrefsBot", regexp.MustCompile(`AhrefsBot`)},
+	{"SemrushBot", regexp.MustCompile(`SemrushBot`)},
+	{"MJ12bot", regexp.MustCompile(`MJ12bot`)},
+	{"PetalBot", regexp.MustCompile(`PetalBot`)},
+	{"GPTBot", regexp.MustCompile(`GPTBot|ChatGPT-User`)},
+	{"CCBot", regexp.MustCompile(`CCBot`)},
+}
+
+// genericBot matches user agents which identify themselves as some kind of
+// bot without being a known crawler
+var genericBot = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|scrape|fetcher|python-requests|curl/|wget/|go-http-client`)
+
+// botClassifier tells crawlers apart from organic traffic by user agent
+type botClassifier struct {
+	signatures []botSignature
+}
+
+// newBotClassifier creates a classifier which checks the user supplied
+// patterns, given as a map of crawler names to regular expressions, before
+// the known crawlers
+func newBotClassifier(patterns map[string]string) (*botClassifier, error) {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := &botClassifier{}
+	for _, name := range names {
+		re, err := regexp.Compile(patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot pattern for '%s': %s", name, err)
+		}
+		c.signatures = append(c.signatures, botSignature{name: name, re: re})
+	}
+	c.signatures = append(c.signatures, knownCrawlers...)
+
+	return c, nil
+}
+
+// crawler returns the name of the crawler sending userAgent, genericCrawler
+// for unknown bots or an empty string if userAgent is no bot
+func (c *botClassifier) crawler(userAgent string) string {
+	for _, s := range c.signatures {
+		if s.re.MatchString(userAgent) {
+			return s.name
+		}
+	}
+	if genericBot.MatchString(userAgent) {
+		return genericCrawler
+	}
+	return ""
+}
+
+// entryCrawler returns the crawler which sent the request of entry
+func (ns *namespace) entryCrawler(entry *gonx.Entry) string {
+	userAgent, err := entry.Field("http_user_agent")
+	if err != nil || ns.bots == nil {
+		return ""
+	}
+	return ns.bots.crawler(userAgent)
+}
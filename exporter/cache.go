@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// cacheHitStatuses are the values of $upstream_cache_status for responses
+// served from the cache
+var cacheHitStatuses = map[string]bool{
+	"HIT":         true,
+	"STALE":       true,
+	"UPDATING":    true,
+	"REVALIDATED": true,
+}
+
+// cacheStats keeps track of cache lookups to compute the cache hit ratio
+type cacheStats struct {
+	lookups uint64
+	hits    uint64
+}
+
+// ratio returns the share of cache lookups which were served from the cache
+func (s *cacheStats) ratio() float64 {
+	lookups := atomic.LoadUint64(&s.lookups)
+	if lookups == 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&s.hits)) / float64(lookups)
+}
+
+// newCacheHitRatio creates a gauge reporting the cache hit ratio of stats
+func newCacheHitRatio(namespace, name string, stats *cacheStats) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      "Share of requests with a cache lookup which were served from the cache",
+	}, stats.ratio)
+}
+
+// observeCacheStatus counts the $upstream_cache_status of entry
+func observeCacheStatus(m *Metrics, entry *gonx.Entry, labelValues []string) {
+	status, err := entry.Field("upstream_cache_status")
+	if err != nil || status == "" || status == "-" {
+		return
+	}
+	status = strings.ToUpper(status)
+
+	m.cacheRequests.add(append(append([]string{}, labelValues...), status), 1)
+
+	atomic.AddUint64(&m.cacheStats.lookups, 1)
+	if cacheHitStatuses[status] {
+		atomic.AddUint64(&m.cacheStats.hits, 1)
+	}
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+)
+
+// CheckInputs checks that the log files of all namespaces can be read and
+// returns a problem for every file which cannot. The files matching a glob
+// pattern are checked as well, a pattern matching no file is no problem as
+// the files may be created later. Other inputs are not checked.
+func (e *Exporter) CheckInputs() []error {
+	var problems []error
+	for _, ns := range e.namespaces {
+		var files []string
+		if ns.config.ErrorLogFile != "" {
+			files = append(files, ns.config.ErrorLogFile)
+		}
+
+		switch {
+		case ns.input() != ns.config.FileName || ns.config.FileName == stdinFileName:
+			// Stdin and inputs other than files
+		case tail.HasMeta(ns.config.FileName):
+			matches, err := filepath.Glob(ns.config.FileName)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("namespace '%s': invalid glob pattern '%s': %s", ns.config.Name, ns.config.FileName, err))
+			}
+			files = append(files, matches...)
+		default:
+			files = append(files, ns.config.FileName)
+		}
+
+		for _, name := range files {
+			f, err := os.Open(name)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("namespace '%s': %s", ns.config.Name, err))
+				continue
+			}
+			f.Close()
+		}
+	}
+	return problems
+}
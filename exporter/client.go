@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// clientIP returns the address of the client of entry, taken from
+// $remote_addr or, if forwardedFor is true, the first hop of
+// $http_x_forwarded_for. It returns nil if there is no valid address.
+func clientIP(entry *gonx.Entry, forwardedFor bool) net.IP {
+	if forwardedFor {
+		if value, err := entry.Field("http_x_forwarded_for"); err == nil {
+			hop := strings.TrimSpace(strings.Split(value, ",")[0])
+			if ip := net.ParseIP(hop); ip != nil {
+				return ip
+			}
+		}
+	}
+
+	addr, err := entry.Field("remote_addr")
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(addr)
+}
+
+// observeGeo counts a request by location and autonomous system of the
+// client address ip
+func observeGeo(ns *namespace, ip net.IP) {
+	if ip == nil || (ns.geoip == nil && ns.asn == nil) {
+		return
+	}
+
+	if ns.asn != nil {
+		asn, org := ns.asn.ASN(ip)
+
+		allowlist := ns.metricsConfig.GeoIP.ASNAllowlist
+		switch {
+		case asn == 0:
+			ns.metrics.asnRequests.add([]string{"", ""}, 1)
+		case len(allowlist) > 0 && !allowlist[asn]:
+			ns.metrics.asnRequests.add([]string{overflowValue, overflowValue}, 1)
+		default:
+			ns.metrics.asnRequests.add([]string{strconv.FormatUint(uint64(asn), 10), org}, 1)
+		}
+	}
+
+	if ns.geoip == nil {
+		return
+	}
+
+	country, city := ns.geoip.Location(ip, ns.metricsConfig.GeoIP.City)
+	if ns.metricsConfig.GeoIP.City {
+		ns.metrics.geoRequests.add([]string{country, city}, 1)
+	} else {
+		ns.metrics.geoRequests.add([]string{country}, 1)
+	}
+}
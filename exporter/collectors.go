@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectorSet is the Registerer the metrics of an Exporter are registered
+// with. It does not expose them itself but is the Collector returned by
+// Exporter.Collector, so the caller decides which registry they end up in.
+type collectorSet struct {
+	mu         sync.Mutex
+	collectors []prometheus.Collector
+}
+
+func (s *collectorSet) Register(c prometheus.Collector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.collectors = append(s.collectors, c)
+	return nil
+}
+
+func (s *collectorSet) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		s.Register(c)
+	}
+}
+
+func (s *collectorSet) Unregister(c prometheus.Collector) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, registered := range s.collectors {
+		if registered == c {
+			s.collectors = append(s.collectors[:i], s.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *collectorSet) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range s.list() {
+		c.Describe(ch)
+	}
+}
+
+func (s *collectorSet) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range s.list() {
+		c.Collect(ch)
+	}
+}
+
+func (s *collectorSet) list() []prometheus.Collector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]prometheus.Collector{}, s.collectors...)
+}
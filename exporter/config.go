@@ -0,0 +1,290 @@
+package exporter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/denniswinter/nginx-log-exporter/relabel"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultNamespace is the metric namespace used when no configuration file
+// and no namespace is given
+const defaultNamespace = "nginx"
+
+// FileConfig is the structure of the configuration file
+type FileConfig struct {
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+	Groups     []GroupConfig     `yaml:"groups"`
+}
+
+// NamespaceConfig describes log files whose metrics are emitted under a
+// common namespace
+type NamespaceConfig struct {
+	Name             string `yaml:"name"`
+	Group            string `yaml:"group"`
+	LogConfig        `yaml:",inline"`
+	RelabelConfigs   []*relabel.Config `yaml:"relabel_configs"`
+	Routes           []RouteConfig     `yaml:"routes"`
+	LabelExpressions []LabelExpression `yaml:"label_expressions"`
+	SLOs             []SLOConfig       `yaml:"slos"`
+}
+
+// loadFileConfig reads and validates the configuration file at filename.
+// Settings missing for a namespace are taken from defaults, the settings of
+// the options in set, which were given explicitly, are always taken from
+// defaults.
+func loadFileConfig(filename string, defaults LogConfig, set map[string]bool) (*FileConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var fc FileConfig
+	if err := yaml.UnmarshalStrict(content, &fc); err != nil {
+		return nil, fmt.Errorf("could not parse configuration file '%s': %s", filename, err)
+	}
+
+	if len(fc.Namespaces) == 0 {
+		return nil, fmt.Errorf("configuration file '%s' does not define any namespaces", filename)
+	}
+
+	// The settings given in the file, so that false is kept as well
+	var given struct {
+		Namespaces []map[string]interface{} `yaml:"namespaces"`
+	}
+	if err := yaml.Unmarshal(content, &given); err != nil {
+		return nil, fmt.Errorf("could not parse configuration file '%s': %s", filename, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range fc.Namespaces {
+		ns := &fc.Namespaces[i]
+		keys := given.Namespaces[i]
+
+		if ns.Name == "" {
+			return nil, fmt.Errorf("namespace #%d has no name", i+1)
+		}
+		// The name prefixes the metrics of the namespace
+		if !labelNameRE.MatchString(ns.Name) {
+			return nil, fmt.Errorf("invalid namespace name '%s'", ns.Name)
+		}
+		if seen[ns.Name] {
+			return nil, fmt.Errorf("namespace '%s' is defined more than once", ns.Name)
+		}
+		seen[ns.Name] = true
+
+		overrideSettings(reflect.ValueOf(&ns.LogConfig).Elem(), reflect.ValueOf(defaults), set)
+		if set["format-preset"] && !set["format"] {
+			// The preset only applies without a format
+			ns.Format = ""
+		}
+
+		if ns.FileName == "" && ns.SyslogListen == "" && ns.ForwardListen == "" && !ns.Journald.Enabled && len(ns.Kafka.Brokers) == 0 {
+			return nil, fmt.Errorf("namespace '%s' has neither filename, syslog_listen, forward_listen, journald nor kafka", ns.Name)
+		}
+		if ns.ForwardMessageKey == "" {
+			ns.ForwardMessageKey = defaults.ForwardMessageKey
+		}
+		if len(ns.Kafka.Brokers) > 0 && ns.Kafka.GroupID == "" {
+			ns.Kafka.GroupID = defaults.Kafka.GroupID
+		}
+		if ns.Format == "" && ns.Preset == "" {
+			ns.Format = defaults.Format
+		}
+		if len(ns.FallbackFormats) == 0 {
+			ns.FallbackFormats = defaults.FallbackFormats
+		}
+		if ns.FormatType == "" {
+			ns.FormatType = defaults.FormatType
+		}
+		if ns.Parser == "" {
+			ns.Parser = defaults.Parser
+		}
+		if ns.Envelope == "" {
+			ns.Envelope = defaults.Envelope
+		}
+		if ns.ExemplarField == "" {
+			ns.ExemplarField = defaults.ExemplarField
+		}
+		if _, ok := keys["from_beginning"]; !ok {
+			ns.FromBeginning = defaults.FromBeginning
+		}
+		if ns.ParseWorkers == 0 {
+			ns.ParseWorkers = defaults.ParseWorkers
+		}
+		if ns.ParseQueueSize == 0 {
+			ns.ParseQueueSize = defaults.ParseQueueSize
+		}
+		if _, ok := keys["drop_lines"]; !ok {
+			ns.DropLines = defaults.DropLines
+		}
+		if ns.IgnoreOlder == 0 {
+			ns.IgnoreOlder = defaults.IgnoreOlder
+		}
+		if _, ok := keys["backfill"]; !ok {
+			ns.Backfill = defaults.Backfill
+		}
+		if _, ok := keys["backfill_max_age"]; !ok {
+			ns.BackfillMaxAge = defaults.BackfillMaxAge
+		}
+		if _, ok := keys["disable_path_normalization"]; !ok {
+			ns.DisablePathNormalization = defaults.DisablePathNormalization
+		}
+		if len(ns.MetricLabels) == 0 {
+			ns.MetricLabels = defaults.MetricLabels
+		}
+		if len(ns.Methods) == 0 {
+			ns.Methods = defaults.Methods
+		}
+		if len(ns.KeepStatuses) == 0 {
+			ns.KeepStatuses = defaults.KeepStatuses
+		}
+		if len(ns.MetricRenames) == 0 {
+			ns.MetricRenames = defaults.MetricRenames
+		}
+		if ns.Filter.empty() {
+			ns.Filter = defaults.Filter
+		}
+		if _, ok := keys["kubernetes"]; !ok {
+			ns.Kubernetes = defaults.Kubernetes
+		}
+	}
+
+	if err := validateGroups(fc.Groups, fc.Namespaces); err != nil {
+		return nil, err
+	}
+	return &fc, nil
+}
+
+// overrideSettings sets the fields of the struct ns whose options are in set
+// to their values in defaults. Fields of nested structs without an option of
+// their own, like the Kafka settings, are overridden one by one.
+func overrideSettings(ns, defaults reflect.Value, set map[string]bool) {
+	for i := 0; i < ns.NumField(); i++ {
+		field := ns.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if long := field.Tag.Get("long"); long != "" {
+			if set[long] {
+				ns.Field(i).Set(defaults.Field(i))
+			}
+		} else if field.Type.Kind() == reflect.Struct {
+			overrideSettings(ns.Field(i), defaults.Field(i), set)
+		}
+	}
+}
+
+// namespaceConfigs returns the namespaces to run, either from the
+// configuration file or a single namespace built from the command line, and
+// the groups of the namespaces. The format of every namespace is resolved
+// from its preset and overrides.
+func namespaceConfigs(cfg Config) ([]NamespaceConfig, []GroupConfig, error) {
+	name := cfg.MetricsConfig.Namespace
+	if name == "" {
+		name = defaultNamespace
+	}
+	namespaces := []NamespaceConfig{{Name: name, LogConfig: cfg.LogConfig}}
+	var groups []GroupConfig
+
+	if cfg.ConfigFile != "" {
+		fc, err := loadFileConfig(cfg.ConfigFile, cfg.LogConfig, cfg.SetOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		namespaces = fc.Namespaces
+		groups = fc.Groups
+	}
+
+	stdin := false
+	for i := range namespaces {
+		ns := &namespaces[i]
+
+		if ns.FileName == stdinFileName && ns.SyslogListen == "" {
+			if stdin {
+				return nil, nil, fmt.Errorf("namespace '%s': only one namespace can read from stdin", ns.Name)
+			}
+			stdin = true
+		}
+
+		if ns.ParseWorkers < 1 {
+			return nil, nil, fmt.Errorf("namespace '%s': parse_workers must be at least 1", ns.Name)
+		}
+		if ns.ParseQueueSize < 0 {
+			return nil, nil, fmt.Errorf("namespace '%s': parse_queue_size must not be negative", ns.Name)
+		}
+		// Only a saved position keeps a restart from replaying the rotated
+		// files again
+		if ns.Backfill && cfg.Positions.File == "" {
+			return nil, nil, fmt.Errorf("namespace '%s': backfill requires --positions.file", ns.Name)
+		}
+
+		set := cfg.FormatSet
+		if cfg.ConfigFile != "" {
+			set = ns.Format != ""
+		}
+
+		format, err := resolveFormat(ns.LogConfig, set)
+		if err != nil {
+			return nil, nil, fmt.Errorf("namespace '%s': %s", ns.Name, err)
+		}
+		ns.Format = format
+
+		fallbacks := make([]string, len(ns.FallbackFormats))
+		for i, f := range ns.FallbackFormats {
+			if preset, ok := formatPresets[f]; ok {
+				f = preset
+			}
+			fallbacks[i] = f
+		}
+		ns.FallbackFormats = fallbacks
+
+		if err := ns.MetricLabels.validate(); err != nil {
+			return nil, nil, fmt.Errorf("namespace '%s': %s", ns.Name, err)
+		}
+
+		for from, to := range ns.MetricRenames {
+			if !metricNameRE.MatchString(to) {
+				return nil, nil, fmt.Errorf("namespace '%s': invalid name '%s' to rename metric '%s' to", ns.Name, to, from)
+			}
+		}
+
+		for _, r := range ns.Routes {
+			if err := r.validate(); err != nil {
+				return nil, nil, fmt.Errorf("namespace '%s': %s", ns.Name, err)
+			}
+		}
+
+		for _, le := range ns.LabelExpressions {
+			if !labelNameRE.MatchString(le.Name) {
+				return nil, nil, fmt.Errorf("namespace '%s': invalid label name '%s'", ns.Name, le.Name)
+			}
+			if le.Expr.empty() {
+				return nil, nil, fmt.Errorf("namespace '%s': label '%s' has no expression", ns.Name, le.Name)
+			}
+		}
+
+		slos := make(map[string]bool)
+		for _, slo := range ns.SLOs {
+			if err := slo.validate(); err != nil {
+				return nil, nil, fmt.Errorf("namespace '%s': %s", ns.Name, err)
+			}
+			if slos[slo.Name] {
+				return nil, nil, fmt.Errorf("namespace '%s': SLO '%s' is defined more than once", ns.Name, slo.Name)
+			}
+			slos[slo.Name] = true
+		}
+
+		for _, target := range relabel.Targets(ns.RelabelConfigs) {
+			if !labelNameRE.MatchString(target) {
+				return nil, nil, fmt.Errorf("namespace '%s': invalid target label '%s'", ns.Name, target)
+			}
+		}
+	}
+
+	return namespaces, groupConfigs(namespaces, groups), nil
+}
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+// recentEntry is a parsed entry kept for /debug/entries
+type recentEntry struct {
+	time   time.Time
+	fields gonx.Fields
+	reused *scanEntry
+}
+
+// recentEntries keeps the most recent entries of a namespace. Entries are
+// kept as they are and only converted when requested, as this is done for
+// every line. Reused entries are released once they are replaced.
+type recentEntries struct {
+	mu      sync.Mutex
+	limit   int
+	entries []recentEntry
+	next    int
+}
+
+func newRecentEntries(limit int) *recentEntries {
+	return &recentEntries{limit: limit}
+}
+
+// record adds the fields map of an entry, which must not be modified
+// afterwards. reused is the scanner entry holding fields, if any, which is
+// released by r.
+func (r *recentEntries) record(fields gonx.Fields, reused *scanEntry) {
+	if r == nil || r.limit <= 0 {
+		reused.release()
+		return
+	}
+
+	e := recentEntry{time: time.Now(), fields: fields, reused: reused}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entries) < r.limit {
+		r.entries = append(r.entries, e)
+	} else {
+		r.entries[r.next].reused.release()
+		r.entries[r.next] = e
+	}
+	r.next = (r.next + 1) % r.limit
+}
+
+// debugEntry is a parsed entry as served by /debug/entries
+type debugEntry struct {
+	Time   time.Time         `json:"time"`
+	Fields map[string]string `json:"fields"`
+}
+
+// recent returns the kept entries from the oldest to the newest
+func (r *recentEntries) recent() []debugEntry {
+	if r == nil {
+		return []debugEntry{}
+	}
+
+	// Entries are converted under the lock, as reused ones are cleared once
+	// they are replaced
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]debugEntry, 0, len(r.entries))
+	for _, e := range append(append([]recentEntry{}, r.entries[r.next:]...), r.entries[:r.next]...) {
+		result = append(result, debugEntry{Time: e.time, Fields: maps.Clone(e.fields)})
+	}
+	return result
+}
+
+// EntriesHandler serves the recent entries and parse errors of all
+// namespaces as JSON object keyed by namespace
+func (e *Exporter) EntriesHandler() http.Handler {
+	namespaces := e.namespaces
+	type namespaceEntries struct {
+		Entries     []debugEntry `json:"entries"`
+		ParseErrors []parseError `json:"parse_errors"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := make(map[string]namespaceEntries, len(namespaces))
+		for _, ns := range namespaces {
+			result[ns.config.Name] = namespaceEntries{
+				Entries:     ns.recentEntries.recent(),
+				ParseErrors: ns.parseErrors.recent(),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,117 @@
+package exporter
+
+import (
+	"encoding/json"
+	"strings"
+
+	hpcloud "github.com/hpcloud/tail"
+)
+
+// lineJoiner joins the records of a log line that its envelope split into
+// several records, which happens to lines longer than 16KB with Docker and
+// CRI runtimes. A joiner keeps the records of a single file.
+type lineJoiner interface {
+	// join returns the whole log line once its last record is passed, ok
+	// is false while records of the line are missing
+	join(record string) (line string, ok bool)
+}
+
+// newLineJoiner returns the joiner of the records of envelope, nil for
+// envelopes which do not split lines
+func newLineJoiner(envelope string) lineJoiner {
+	switch envelope {
+	case "docker":
+		return &dockerJoiner{partial: make(map[string]string)}
+	case "cri":
+		return &criJoiner{partial: make(map[string]string)}
+	default:
+		return nil
+	}
+}
+
+// joinLines passes the lines of in joined by j on to the returned channel,
+// which is closed once in is closed
+func joinLines(in chan *hpcloud.Line, j lineJoiner) chan *hpcloud.Line {
+	out := make(chan *hpcloud.Line)
+	go func() {
+		defer close(out)
+		for line := range in {
+			text, ok := j.join(line.Text)
+			if !ok {
+				continue
+			}
+			if text != line.Text {
+				line = &hpcloud.Line{Text: text, Time: line.Time, Err: line.Err}
+			}
+			out <- line
+		}
+	}()
+	return out
+}
+
+// dockerJoiner joins the records of the Docker json-file log, of which only
+// the last record of a line ends with a newline. partial maps the streams to
+// the beginnings of their lines.
+type dockerJoiner struct {
+	partial map[string]string
+}
+
+func (j *dockerJoiner) join(record string) (string, bool) {
+	var l dockerLine
+	if err := json.Unmarshal([]byte(record), &l); err != nil {
+		// Left to the parser to report
+		return record, true
+	}
+
+	begin, split := j.partial[l.Stream]
+	if !strings.HasSuffix(l.Log, "\n") {
+		j.partial[l.Stream] = begin + l.Log
+		return "", false
+	}
+	if !split {
+		return record, true
+	}
+
+	delete(j.partial, l.Stream)
+	l.Log = begin + l.Log
+	b, err := json.Marshal(l)
+	if err != nil {
+		return record, true
+	}
+	return string(b), true
+}
+
+// criJoiner joins the records of CRI container logs, which are tagged P
+// while the line goes on in the next record and F for its last record.
+// partial maps the streams to the beginnings of their lines.
+type criJoiner struct {
+	partial map[string]string
+}
+
+func (j *criJoiner) join(record string) (string, bool) {
+	parts := strings.SplitN(record, " ", 4)
+	if len(parts) != 4 {
+		// Left to the parser to report
+		return record, true
+	}
+
+	stream := parts[1]
+	begin, split := j.partial[stream]
+	if criPartial(parts[2]) {
+		j.partial[stream] = begin + parts[3]
+		return "", false
+	}
+	if !split {
+		return record, true
+	}
+
+	delete(j.partial, stream)
+	return strings.Join(parts[:3], " ") + " " + begin + parts[3], true
+}
+
+// criPartial tells whether the tag of a CRI log line marks a partial line,
+// the flags of the tag are separated by colons
+func criPartial(tag string) bool {
+	flag, _, _ := strings.Cut(tag, ":")
+	return flag == "P"
+}
@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineJoiner(t *testing.T) {
+	tests := []struct {
+		envelope string
+		records  []string
+		want     []string
+	}{
+		{
+			envelope: "docker",
+			records: []string{
+				`{"log":"GET /a\n","stream":"stdout","time":"2026-10-15T10:00:00Z"}`,
+				`{"log":"GET /b","stream":"stdout","time":"2026-10-15T10:00:01Z"}`,
+				`{"log":"error\n","stream":"stderr","time":"2026-10-15T10:00:01Z"}`,
+				`{"log":"?x=1","stream":"stdout","time":"2026-10-15T10:00:01Z"}`,
+				`{"log":"\u0026y=2\n","stream":"stdout","time":"2026-10-15T10:00:01Z"}`,
+				`invalid`,
+			},
+			want: []string{
+				`{"log":"GET /a\n","stream":"stdout","time":"2026-10-15T10:00:00Z"}`,
+				`{"log":"error\n","stream":"stderr","time":"2026-10-15T10:00:01Z"}`,
+				`{"log":"GET /b?x=1\u0026y=2\n","stream":"stdout","time":"2026-10-15T10:00:01Z"}`,
+				`invalid`,
+			},
+		},
+		{
+			envelope: "cri",
+			records: []string{
+				"2026-10-15T10:00:00Z stdout F GET /a",
+				"2026-10-15T10:00:01Z stdout P GET /b",
+				"2026-10-15T10:00:01Z stderr F error",
+				"2026-10-15T10:00:01Z stdout P ?x=1",
+				"2026-10-15T10:00:01Z stdout F &y=2",
+				"invalid",
+			},
+			want: []string{
+				"2026-10-15T10:00:00Z stdout F GET /a",
+				"2026-10-15T10:00:01Z stderr F error",
+				"2026-10-15T10:00:01Z stdout F GET /b?x=1&y=2",
+				"invalid",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		j := newLineJoiner(test.envelope)
+		var got []string
+		for _, record := range test.records {
+			if line, ok := j.join(record); ok {
+				got = append(got, line)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: joined %q, want %q", test.envelope, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errorLogLevels are the severity levels of the nginx error log
+var errorLogLevels = []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}
+
+// errorLogLine matches a message of the nginx error log, e.g.
+// 2024/01/02 15:04:05 [error] 1234#1234: *56 upstream timed out ...
+var errorLogLine = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} \[([a-z]+)\] \d+#\d+: (?:\*\d+ )?(.*)$`)
+
+// errorClass is a common error log message recognized by a substring
+type errorClass struct {
+	name    string
+	pattern string
+}
+
+// errorClasses are the error log messages counted by class
+var errorClasses = []errorClass{
+	{"upstream_timed_out", "upstream timed out"},
+	{"connection_refused", "Connection refused"},
+	{"connection_reset", "Connection reset by peer"},
+	{"no_live_upstreams", "no live upstreams"},
+	{"upstream_prematurely_closed", "upstream prematurely closed connection"},
+	{"limit_req", "limiting requests"},
+	{"limit_conn", "limiting connections"},
+	{"client_body_too_large", "client intended to send too large body"},
+	{"ssl_handshake_failed", "SSL_do_handshake() failed"},
+	{"file_not_found", "(2: No such file or directory)"},
+	{"permission_denied", "(13: Permission denied)"},
+	{"worker_connections_exceeded", "worker_connections are not enough"},
+}
+
+// errorLogMetrics are the metrics of the error log of a namespace
+type errorLogMetrics struct {
+	messages *prometheus.CounterVec
+	classes  *prometheus.CounterVec
+}
+
+// newErrorLogMetrics creates the error log metrics of namespace and
+// registers them with reg. All levels and classes are initialized, so that their rates
+// are available before the first message.
+func newErrorLogMetrics(namespace string, reg prometheus.Registerer) *errorLogMetrics {
+	m := &errorLogMetrics{
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "error_log_messages_total",
+			Help:      "Amount of error log messages by level",
+		}, []string{"level"}),
+		classes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "error_log_class_messages_total",
+			Help:      "Amount of error log messages of common classes like upstream timeouts or limited requests",
+		}, []string{"class"}),
+	}
+	reg.MustRegister(m.messages, m.classes)
+
+	for _, level := range errorLogLevels {
+		m.messages.WithLabelValues(level)
+	}
+	for _, c := range errorClasses {
+		m.classes.WithLabelValues(c.name)
+	}
+
+	return m
+}
+
+// parseErrorLogLine returns the level and message of an error log line. It
+// returns false for lines which do not start a message, e.g. continuation
+// lines of multi-line messages.
+func parseErrorLogLine(line string) (string, string, bool) {
+	m := errorLogLine.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// observe counts the error log line
+func (m *errorLogMetrics) observe(line string) {
+	level, msg, ok := parseErrorLogLine(line)
+	if !ok {
+		return
+	}
+
+	m.messages.WithLabelValues(level).Inc()
+
+	for _, c := range errorClasses {
+		if strings.Contains(msg, c.pattern) {
+			m.classes.WithLabelValues(c.name).Inc()
+			return
+		}
+	}
+}
+
+// startErrorLog starts following the error log of ns
+func startErrorLog(ns *namespace) error {
+	t, err := tail.NewFollower(ns.config.ErrorLogFile, ns.followerConfig())
+	if err != nil {
+		return err
+	}
+
+	t.OnError(func(err error) {
+		slog.Error("Error while following error log", "file", ns.config.ErrorLogFile, "err", err)
+		ns.health.fail(ns.config.ErrorLogFile, err)
+	})
+
+	ns.telemetry.tailLags.add(ns.config.Name, ns.config.ErrorLogFile, t)
+
+	if !ns.inputs.add(t) {
+		t.Stop()
+		return nil
+	}
+
+	go func() {
+		defer ns.inputs.done(t)
+
+		for line := range t.Lines() {
+			ns.errorLog.observe(line.Text)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,37 @@
+package exporter
+
+import (
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// traceparentRE matches a W3C traceparent header and captures the trace id
+var traceparentRE = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// traceIDRE matches plain trace ids as logged with e.g. $request_id or
+// $otel_trace_id
+var traceIDRE = regexp.MustCompile(`^[0-9a-fA-F]{16,64}$`)
+
+// entryExemplar returns the exemplar labels for observations of entry, taken
+// from the trace id logged in field. It returns nil if there is none.
+func entryExemplar(entry *gonx.Entry, field string) prometheus.Labels {
+	if field == "" {
+		return nil
+	}
+
+	value, err := entry.Field(field)
+	if err != nil {
+		return nil
+	}
+
+	if m := traceparentRE.FindStringSubmatch(value); m != nil {
+		return prometheus.Labels{"trace_id": m[1]}
+	}
+	if traceIDRE.MatchString(value) {
+		return prometheus.Labels{"trace_id": value}
+	}
+
+	return nil
+}
@@ -0,0 +1,336 @@
+// Package exporter derives Prometheus metrics from nginx access logs. It is
+// the pipeline of nginx-log-exporter, which can be embedded by other
+// services to expose the metrics of their access logs in their own registry:
+//
+//	e, err := exporter.New(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	registry.MustRegister(e.Collector())
+//	go e.Run(ctx)
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config is a struct
+type Config struct {
+	ConfigFile      string        `long:"config.file" description:"Path to a YAML configuration file defining namespaces"`
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" default:"10s" description:"Time to wait on SIGTERM or SIGINT for the lines already read to be processed and the HTTP server to finish its requests"`
+	DebugEntries    int           `long:"web.debug-entries" default:"20" description:"Number of recent entries and parse errors per namespace served by /debug/entries, 0 keeps no entries and the default number of parse errors"`
+	LogConfig       LogConfig
+	MetricsConfig   MetricsConfig
+	Anonymize       AnonymizeConfig
+	Positions       PositionsConfig
+	Tail            TailConfig
+	StatsD          StatsDConfig
+	Loki            LokiConfig
+
+	// FormatSet tells whether LogConfig.Format was set explicitly, which
+	// takes precedence over LogConfig.Preset then
+	FormatSet bool `no-flag:"true"`
+
+	// SetOptions are the long names of the options given explicitly as
+	// flag or environment variable, which override the settings of the
+	// namespaces of the configuration file
+	SetOptions map[string]bool `no-flag:"true"`
+}
+
+// Exporter follows the inputs of the configured namespaces and updates
+// their metrics with every line
+type Exporter struct {
+	config     Config
+	namespaces []*namespace
+	positions  *tail.Positions
+	collectors *collectorSet
+	telemetry  *telemetry
+	inputs     *inputSet
+	groups     []GroupConfig
+	errors     chan error
+
+	// telemetryCollectors are the self-telemetry metrics within collectors
+	telemetryCollectors *collectorSet
+}
+
+// New creates an Exporter and the metrics of its namespaces without starting
+// it
+func New(c Config) (*Exporter, error) {
+	if err := c.MetricsConfig.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
+		config:              c,
+		collectors:          &collectorSet{},
+		inputs:              newInputSet(),
+		errors:              make(chan error, 1),
+		telemetryCollectors: &collectorSet{},
+	}
+	e.collectors.MustRegister(e.telemetryCollectors)
+	e.telemetry = newTelemetry(e.telemetryCollectors, c.Tail.StallTimeout)
+
+	if c.Positions.File != "" {
+		positions, err := tail.OpenPositions(c.Positions.File)
+		if err != nil {
+			return nil, err
+		}
+		e.positions = positions
+	}
+
+	if err := e.newNamespaces(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Collector returns the collector of all metrics of e
+func (e *Exporter) Collector() prometheus.Collector {
+	return e.collectors
+}
+
+// NamespaceStatus is the configuration of a namespace as shown on the
+// landing page and served by /api/v1/status
+type NamespaceStatus struct {
+	Name   string `json:"name"`
+	Group  string `json:"group,omitempty"`
+	Input  string `json:"input"`
+	Format string `json:"format"`
+}
+
+// Namespaces returns the configuration of all namespaces of e
+func (e *Exporter) Namespaces() []NamespaceStatus {
+	result := make([]NamespaceStatus, 0, len(e.namespaces))
+	for _, ns := range e.namespaces {
+		result = append(result, NamespaceStatus{
+			Name:   ns.config.Name,
+			Group:  ns.config.Group,
+			Input:  ns.input(),
+			Format: ns.config.Format,
+		})
+	}
+	return result
+}
+
+// Positions returns the positions of the followed files, which is nil
+// without a positions file
+func (e *Exporter) Positions() *tail.Positions {
+	return e.positions
+}
+
+// FileOffset is the current read offset of a followed file
+type FileOffset struct {
+	Namespace string
+	File      string
+	Offset    int64
+}
+
+// Offsets returns the current read offsets of all followed regular files
+func (e *Exporter) Offsets() []FileOffset {
+	return e.telemetry.tailLags.offsets()
+}
+
+// Reopen reopens all followed files, continuing at their current offset
+// unless they have been replaced
+func (e *Exporter) Reopen() {
+	e.inputs.reopen()
+}
+
+// Run starts following the inputs of all namespaces and processes their
+// lines until ctx is done or an input fails. It then stops the inputs, waits
+// up to the shutdown timeout for the lines already read to be processed and
+// saves the positions.
+func (e *Exporter) Run(ctx context.Context) error {
+	tail.SetPollInterval(e.config.Tail.PollInterval)
+
+	// The positions are saved a last time once the inputs are stopped, so
+	// the sync does not end with ctx
+	stopSync := func() {}
+	if e.positions != nil {
+		syncCtx, cancel := context.WithCancel(context.Background())
+		synced := make(chan struct{})
+		go func() {
+			defer close(synced)
+			e.positions.SyncEvery(syncCtx, e.config.Positions.SyncPeriod, func(err error) {
+				slog.Error("Error while saving positions file", "file", e.config.Positions.File, "err", err)
+			})
+		}()
+		stopSync = func() {
+			cancel()
+			<-synced
+		}
+	}
+
+	// sinks receive every line and are flushed on shutdown
+	var sinks []func(context.Context) error
+	if e.config.StatsD.Address != "" {
+		client, err := newStatsDClient(e.config.StatsD)
+		if err != nil {
+			return err
+		}
+		for _, ns := range e.namespaces {
+			ns.statsd = client
+		}
+		sinks = append(sinks, client.stop)
+	}
+	if e.config.Loki.URL != "" {
+		client := newLokiClient(e.config.Loki)
+		for _, ns := range e.namespaces {
+			ns.loki = client
+		}
+		sinks = append(sinks, client.stop)
+	}
+
+	for _, ns := range e.namespaces {
+		if e.config.MetricsConfig.TTL > 0 {
+			go ns.metrics.expireSeries(ctx, e.config.MetricsConfig.TTL)
+		}
+
+		if err := startNamespace(ns); err != nil {
+			e.stop(sinks, stopSync)
+			return fmt.Errorf("namespace '%s': %s", ns.config.Name, err)
+		}
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-e.errors:
+	}
+
+	e.stop(sinks, stopSync)
+	return err
+}
+
+// stop stops all inputs, waits for the lines already read to be processed,
+// stops the sync of the positions, which saves them, and flushes sinks
+func (e *Exporter) stop(sinks []func(context.Context) error, stopSync func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.inputs.stop(ctx); err != nil {
+		slog.Error("Error while waiting for the remaining lines to be processed", "err", err)
+	}
+
+	stopSync()
+
+	for _, stop := range sinks {
+		if err := stop(ctx); err != nil {
+			slog.Error("Error while flushing lines", "err", err)
+		}
+	}
+}
+
+// fail stops Run with err of an input
+func (e *Exporter) fail(err error) {
+	select {
+	case e.errors <- err:
+	default:
+	}
+}
+
+// PositionsConfig is a struct
+type PositionsConfig struct {
+	File       string        `long:"positions.file" description:"File to persist the read offsets of all followed files to, so that a restart resumes every file where the last run stopped, e.g. /var/lib/nginx-log-exporter/positions.yaml"`
+	SyncPeriod time.Duration `long:"positions.sync-period" default:"10s" description:"Interval in which the positions file is written"`
+}
+
+// TailConfig is a struct
+type TailConfig struct {
+	Poll         bool          `long:"tail.poll" description:"Poll the log files for changes instead of using inotify, which does not work on NFS, some Docker volume drivers and FUSE filesystems"`
+	PollInterval time.Duration `long:"tail.poll-interval" default:"1s" description:"Interval in which the log files are polled for changes"`
+	StallTimeout time.Duration `long:"tail.stall-timeout" default:"1m" description:"Time a log file may have unread bytes without being read before nginx_exporter_pipeline_up reports it as down, 0 disables the check"`
+}
+
+// LogConfig is a struct
+type LogConfig struct {
+	FileName                 string            `yaml:"filename" short:"f" long:"filename" default:"/var/log/nginx/access.log" description:"Path to logfile to parse, may be a glob pattern like /var/log/nginx/*.access.log or - to read from stdin"`
+	Format                   string            `yaml:"format" long:"format" default:"$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\" $request_time" description:"NGINX access_log format, or auto to detect common formats from the first lines"`
+	Preset                   string            `yaml:"format_preset" long:"format-preset" description:"Use a predefined access_log format instead of --format (common, combined, combined_plus_time)"`
+	FallbackFormats          []string          `yaml:"fallback_formats" long:"fallback-format" description:"Format or preset name to parse lines not matching --format with, may be given more than once to try several formats in the given order"`
+	FormatOverrides          map[string]string `yaml:"format_overrides" long:"format-override" description:"Replace a single variable of the format, e.g. remote_addr:$http_x_forwarded_for"`
+	FormatType               string            `yaml:"format_type" long:"format-type" default:"text" choice:"text" choice:"json" choice:"ltsv" choice:"apache" choice:"caddy" choice:"traefik" description:"Type of the access log, text for log_format lines, json for log_format escape=json, ltsv for Labeled Tab-separated Values, or apache, caddy or traefik for the access logs of these servers"`
+	Parser                   string            `yaml:"parser" long:"parser" default:"regex" choice:"regex" choice:"scanner" description:"Parser of text log lines, regex matches a regular expression built from the format and scanner scans the lines for the literals of the format, which is considerably faster"`
+	Envelope                 string            `yaml:"envelope" long:"envelope" default:"none" choice:"none" choice:"docker" choice:"cri" description:"Envelope wrapping every log line, docker for the json-file logs of Docker containers and cri for the container logs of containerd and CRI-O"`
+	JSONFields               map[string]string `yaml:"json_fields" long:"json-field" description:"Map a JSON key or LTSV label to a variable name, e.g. duration:request_time"`
+	ExemplarField            string            `yaml:"exemplar_field" long:"exemplar-field" default:"http_traceparent" description:"Log variable holding a traceparent header or trace id to attach as exemplar to the latency histograms"`
+	DisablePathNormalization bool              `yaml:"disable_path_normalization" long:"disable-path-normalization" description:"Do not replace ids, UUIDs and hex tokens in the path label of requests not matching any route"`
+	SyslogListen             string            `yaml:"syslog_listen" long:"input.syslog.listen" description:"Receive the log lines as syslog messages via UDP and TCP on this address, e.g. 0.0.0.0:5140, instead of reading a file"`
+	ForwardListen            string            `yaml:"forward_listen" long:"input.forward.listen" description:"Receive the log lines via the Fluentd forward protocol on this address, e.g. 0.0.0.0:24224, instead of reading a file"`
+	ForwardMessageKey        string            `yaml:"forward_message_key" long:"input.forward.message-key" default:"log" description:"Record field holding the log line, records without it are parsed as JSON objects"`
+	Journald                 JournaldConfig    `yaml:"journald"`
+	Kubernetes               KubernetesConfig  `yaml:"kubernetes"`
+	Kafka                    KafkaConfig       `yaml:"kafka"`
+	MetricLabels             labelNames        `yaml:"metric_labels" long:"metric-labels" default:"status,method" description:"Comma separated list of log variables to use as metric labels, method is derived from $request"`
+	Methods                  stringList        `yaml:"methods" long:"methods" default:"GET,HEAD,POST,PUT,DELETE,CONNECT,OPTIONS,TRACE,PATCH" description:"Comma separated list of request methods to label by, all other methods are labeled OTHER"`
+	KeepStatuses             stringList        `yaml:"keep_statuses" long:"keep-statuses" description:"Comma separated list of statuses or status classes to label individually, e.g. 200,301,404,499,5xx, all other statuses are folded into their class like 4xx. All statuses are kept if empty"`
+	MetricRenames            map[string]string `yaml:"metric_renames" long:"metric-rename" description:"Export a metric under another name, given without namespace, e.g. http_response_count_total:http_requests_total"`
+	Filter                   FilterConfig      `yaml:"filter"`
+	ParseWorkers             int               `yaml:"parse_workers" long:"parse-workers" default:"1" description:"Number of goroutines parsing the lines of a log file in parallel, the metrics are updated by a single goroutine"`
+	ParseQueueSize           int               `yaml:"parse_queue_size" long:"parse-queue.size" description:"Number of parsed lines of a log file buffered for the metric updates, defaults to the number of parse workers"`
+	DropLines                bool              `yaml:"drop_lines" long:"parse-queue.drop" description:"Drop lines while the parse workers of a log file cannot keep up instead of blocking the tailer, counting them in nginx_exporter_lines_dropped_total"`
+	FromBeginning            bool              `yaml:"from_beginning" long:"from-beginning" description:"Read log files without a saved position from their beginning instead of only following the lines appended from now on"`
+	IgnoreOlder              time.Duration     `yaml:"ignore_older" long:"ignore-older" description:"Skip lines whose $time_iso8601, $time_local or $msec is older than this age, e.g. 5m, 0 to count all lines"`
+	Backfill                 bool              `yaml:"backfill" long:"backfill" description:"Replay the rotated files of the log file, e.g. access.log.1 and access.log.2.gz, from the oldest to the newest before following it, requires --positions.file"`
+	BackfillMaxAge           time.Duration     `yaml:"backfill_max_age" long:"backfill.max-age" default:"24h" description:"Skip rotated files last modified longer ago than this age when backfilling, 0 to replay all"`
+	ErrorLogFile             string            `yaml:"error_log_file" long:"error-log-file" description:"Path to the nginx error log to count the messages of by level and class, e.g. /var/log/nginx/error.log"`
+}
+
+// JournaldConfig is a struct
+type JournaldConfig struct {
+	Enabled    bool   `yaml:"enabled" long:"input.journald" description:"Read the log lines from the systemd journal instead of a file, requires a build with -tags journald"`
+	Unit       string `yaml:"unit" long:"input.journald.unit" description:"Only read journal entries of this systemd unit, e.g. nginx.service"`
+	Identifier string `yaml:"identifier" long:"input.journald.identifier" description:"Only read journal entries with this SYSLOG_IDENTIFIER, e.g. nginx"`
+	CursorFile string `yaml:"cursor_file" long:"input.journald.cursor-file" description:"File to persist the position in the journal to, so that a restart continues where the last run stopped"`
+}
+
+// journalConfig returns the journal matches and cursor file of c
+func (c JournaldConfig) journalConfig() tail.JournalConfig {
+	jc := tail.JournalConfig{CursorFile: c.CursorFile}
+	if c.Unit != "" {
+		jc.Matches = append(jc.Matches, "_SYSTEMD_UNIT="+c.Unit)
+	}
+	if c.Identifier != "" {
+		jc.Matches = append(jc.Matches, "SYSLOG_IDENTIFIER="+c.Identifier)
+	}
+	return jc
+}
+
+// KafkaConfig is a struct
+type KafkaConfig struct {
+	Brokers       stringList `yaml:"brokers" long:"input.kafka.brokers" description:"Comma separated list of Kafka brokers to consume the log lines from instead of reading a file, e.g. kafka-1:9092,kafka-2:9092"`
+	Topic         string     `yaml:"topic" long:"input.kafka.topic" description:"Kafka topic holding the log lines"`
+	GroupID       string     `yaml:"group_id" long:"input.kafka.group-id" default:"nginx-log-exporter" description:"Kafka consumer group whose offsets are committed"`
+	TLS           bool       `yaml:"tls" long:"input.kafka.tls" description:"Connect to the Kafka brokers via TLS"`
+	CAFile        string     `yaml:"ca_file" long:"input.kafka.tls.ca-file" description:"CA certificates to verify the Kafka brokers with"`
+	CertFile      string     `yaml:"cert_file" long:"input.kafka.tls.cert-file" description:"Client certificate to authenticate with at the Kafka brokers"`
+	KeyFile       string     `yaml:"key_file" long:"input.kafka.tls.key-file" description:"Key of the client certificate"`
+	SASLMechanism string     `yaml:"sasl_mechanism" long:"input.kafka.sasl.mechanism" choice:"plain" choice:"scram-sha-256" choice:"scram-sha-512" description:"SASL mechanism to authenticate with at the Kafka brokers"`
+	Username      string     `yaml:"username" long:"input.kafka.sasl.username" description:"SASL user name"`
+	Password      string     `yaml:"password" long:"input.kafka.sasl.password" description:"SASL password"`
+}
+
+// kafkaConfig returns the consumer configuration of c
+func (c KafkaConfig) kafkaConfig() tail.KafkaConfig {
+	return tail.KafkaConfig{
+		Brokers:       c.Brokers,
+		Topic:         c.Topic,
+		GroupID:       c.GroupID,
+		TLS:           c.TLS,
+		CAFile:        c.CAFile,
+		CertFile:      c.CertFile,
+		KeyFile:       c.KeyFile,
+		SASLMechanism: c.SASLMechanism,
+		Username:      c.Username,
+		Password:      c.Password,
+	}
+}
+
+// stdinFileName is the file name which reads the log lines from stdin
+const stdinFileName = "-"
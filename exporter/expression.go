@@ -0,0 +1,218 @@
+package exporter
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// expression is an expression of the expr language, see
+// https://expr-lang.org, which is evaluated against the variables of a log
+// line. Only the variables referenced by the expression are looked up, those
+// holding decimal numbers are numbers, all others strings.
+type expression struct {
+	source    string
+	program   *vm.Program
+	variables []string
+}
+
+// identifiers collects the names of all variables of an expression
+type identifiers map[string]bool
+
+// Visit implements ast.Visitor
+func (ids identifiers) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.IdentifierNode); ok {
+		ids[n.Value] = true
+	}
+}
+
+// compileExpression compiles source. If boolean is true, the expression must
+// evaluate to true or false.
+func compileExpression(source string, boolean bool) (expression, error) {
+	options := []expr.Option{expr.Env(map[string]interface{}{}), expr.AllowUndefinedVariables()}
+	if boolean {
+		options = append(options, expr.AsBool())
+	}
+
+	program, err := expr.Compile(source, options...)
+	if err != nil {
+		return expression{}, fmt.Errorf("invalid expression '%s': %s", source, err)
+	}
+
+	ids := make(identifiers)
+	node := program.Node()
+	ast.Walk(&node, ids)
+
+	variables := make([]string, 0, len(ids))
+	for name := range ids {
+		variables = append(variables, name)
+	}
+	sort.Strings(variables)
+
+	return expression{source: source, program: program, variables: variables}, nil
+}
+
+// conditionExpression is an expression which evaluates to true or false
+type conditionExpression struct {
+	expression
+}
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (e *conditionExpression) UnmarshalFlag(value string) error {
+	compiled, err := compileExpression(value, true)
+	if err != nil {
+		return err
+	}
+	e.expression = compiled
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (e conditionExpression) MarshalFlag() (string, error) {
+	return e.source, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (e *conditionExpression) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return e.UnmarshalFlag(s)
+}
+
+// valueExpression is an expression whose result is used as label value
+type valueExpression struct {
+	expression
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (e *valueExpression) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	compiled, err := compileExpression(s, false)
+	if err != nil {
+		return err
+	}
+	e.expression = compiled
+	return nil
+}
+
+// LabelExpression derives the label Name from the result of an expression
+type LabelExpression struct {
+	Name string          `yaml:"name"`
+	Expr valueExpression `yaml:"expr"`
+}
+
+// empty reports whether no expression is set
+func (e expression) empty() bool {
+	return e.program == nil
+}
+
+// eval evaluates the expression for entry. Variables are resolved like
+// labels, except for path which is the request path without normalization.
+func (e expression) eval(ns *namespace, entry *gonx.Entry) (interface{}, error) {
+	env := make(map[string]interface{}, len(e.variables))
+	for _, name := range e.variables {
+		var value string
+		if name == "path" {
+			value = requestPath(entry)
+		} else {
+			value = ns.fieldValue(entry, name)
+		}
+
+		env[name] = value
+		if decimalNumber(value) {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				env[name] = f
+			}
+		}
+	}
+
+	return expr.Run(e.program, env)
+}
+
+// decimalNumber reports whether s is a decimal number like 200, -1 or 0.012.
+// Values like NaN, Inf or 1e3, which ParseFloat accepts as well, are no
+// numbers in a log line.
+func decimalNumber(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+
+	digits, dot := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digits++
+		case s[i] == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// expressionErrors counts the errors of evaluating expressions, of which
+// only the first one of every expression is logged above debug level, as an
+// expression failing for one line usually fails for many
+type expressionErrors struct {
+	counter *prometheus.CounterVec
+	logged  sync.Map
+}
+
+// failed counts that the expression source of namespace failed with err
+func (e *expressionErrors) failed(namespace, source string, err error) {
+	e.counter.WithLabelValues(namespace, source).Inc()
+
+	if _, logged := e.logged.LoadOrStore(namespace+"\x00"+source, true); logged {
+		slog.Debug("Error while evaluating expression", "namespace", namespace, "expr", source, "err", err)
+		return
+	}
+	slog.Warn("Error while evaluating expression, further errors are counted in nginx_exporter_expression_errors_total", "namespace", namespace, "expr", source, "err", err)
+}
+
+// match reports whether the condition is true for entry. Failing conditions
+// are counted and treated as false.
+func (e conditionExpression) match(ns *namespace, entry *gonx.Entry) bool {
+	result, err := e.eval(ns, entry)
+	if err != nil {
+		ns.telemetry.exprErrors.failed(ns.config.Name, e.source, err)
+		return false
+	}
+
+	matched, _ := result.(bool)
+	return matched
+}
+
+// value returns the result of the expression for entry as string
+func (e valueExpression) value(ns *namespace, entry *gonx.Entry) string {
+	result, err := e.eval(ns, entry)
+	if err != nil {
+		ns.telemetry.exprErrors.failed(ns.config.Name, e.source, err)
+		return ""
+	}
+
+	switch v := result.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecimalNumber(t *testing.T) {
+	tests := map[string]bool{
+		"200":      true,
+		"0.012":    true,
+		"-1":       true,
+		"+1.5":     true,
+		".5":       true,
+		"5.":       true,
+		"":         false,
+		"-":        false,
+		".":        false,
+		"1.2.3":    false,
+		"NaN":      false,
+		"Inf":      false,
+		"-inf":     false,
+		"infinity": false,
+		"1e3":      false,
+		"0x10":     false,
+		"1_000":    false,
+		"0.1, 0.2": false,
+	}
+
+	for value, want := range tests {
+		if got := decimalNumber(value); got != want {
+			t.Errorf("decimalNumber(%q) = %t, want %t", value, got, want)
+		}
+	}
+}
+
+func TestCompileExpression(t *testing.T) {
+	tests := []struct {
+		source    string
+		boolean   bool
+		variables []string
+		err       bool
+	}{
+		{source: `status >= 500 && path startsWith "/api"`, boolean: true, variables: []string{"path", "status"}},
+		{source: `request_time > 1 ? "slow" : "fast"`, variables: []string{"request_time"}},
+		{source: `len(http_user_agent) > 100`, boolean: true, variables: []string{"http_user_agent"}},
+		{source: `"constant"`, variables: []string{}},
+		{source: `status >=`, boolean: true, err: true},
+		{source: `"no bool"`, boolean: true, err: true},
+	}
+
+	for _, test := range tests {
+		e, err := compileExpression(test.source, test.boolean)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v, want error %t", test.source, err, test.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(e.variables, test.variables) {
+			t.Errorf("%s: variables %v, want %v", test.source, e.variables, test.variables)
+		}
+	}
+}
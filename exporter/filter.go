@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/denniswinter/nginx-log-exporter/relabel"
+	"github.com/satyrius/gonx"
+)
+
+// FilterConfig describes which lines are skipped before they are counted in
+// any metric. A line is skipped if it matches any exclude filter, or if
+// include filters are set and it does not match all of them. Expressions are
+// conditions of the expr language.
+type FilterConfig struct {
+	IncludeStatus    stringList          `yaml:"include_status" long:"filter.include-status" description:"Comma separated list of statuses or status classes like 5xx to count exclusively"`
+	ExcludeStatus    stringList          `yaml:"exclude_status" long:"filter.exclude-status" description:"Comma separated list of statuses or status classes like 3xx to skip"`
+	IncludePath      relabel.Regexp      `yaml:"include_path" long:"filter.include-path" description:"Only count requests whose path matches this anchored regular expression"`
+	ExcludePath      relabel.Regexp      `yaml:"exclude_path" long:"filter.exclude-path" description:"Skip requests whose path matches this anchored regular expression, e.g. /healthz"`
+	IncludeClients   networks            `yaml:"include_clients" long:"filter.include-clients" description:"Comma separated list of addresses or CIDR ranges of $remote_addr to count exclusively"`
+	ExcludeClients   networks            `yaml:"exclude_clients" long:"filter.exclude-clients" description:"Comma separated list of addresses or CIDR ranges of $remote_addr to skip, e.g. 10.0.0.0/8"`
+	IncludeUserAgent relabel.Regexp      `yaml:"include_user_agent" long:"filter.include-user-agent" description:"Only count requests whose $http_user_agent matches this anchored regular expression"`
+	ExcludeUserAgent relabel.Regexp      `yaml:"exclude_user_agent" long:"filter.exclude-user-agent" description:"Skip requests whose $http_user_agent matches this anchored regular expression, e.g. ELB-HealthChecker/.*"`
+	IncludeExpr      conditionExpression `yaml:"include_expr" long:"filter.include-expr" description:"Only count requests for which this expression is true, e.g. status >= 500 && path startsWith \"/api\""`
+	ExcludeExpr      conditionExpression `yaml:"exclude_expr" long:"filter.exclude-expr" description:"Skip requests for which this expression is true"`
+}
+
+// stringList is a list of strings which is given as a comma separated flag
+// value
+type stringList []string
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (l *stringList) UnmarshalFlag(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (l stringList) MarshalFlag() (string, error) {
+	return strings.Join(l, ","), nil
+}
+
+// networks is a list of IP networks which is given as a comma separated flag
+// value of addresses and CIDR ranges
+type networks []*net.IPNet
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (n *networks) UnmarshalFlag(value string) error {
+	*n = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		network, err := parseNetwork(s)
+		if err != nil {
+			return err
+		}
+		*n = append(*n, network)
+	}
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (n networks) MarshalFlag() (string, error) {
+	s := make([]string, len(n))
+	for i, network := range n {
+		s[i] = network.String()
+	}
+	return strings.Join(s, ","), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (n *networks) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*n = nil
+	for _, s := range list {
+		network, err := parseNetwork(s)
+		if err != nil {
+			return err
+		}
+		*n = append(*n, network)
+	}
+	return nil
+}
+
+// parseNetwork parses a CIDR range or a single address
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address '%s'", s)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR range '%s'", s)
+	}
+	return network, nil
+}
+
+// contains reports whether ip is part of any of the networks
+func (n networks) contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// empty reports whether no filter is configured
+func (c FilterConfig) empty() bool {
+	return len(c.IncludeStatus) == 0 && len(c.ExcludeStatus) == 0 &&
+		c.IncludePath.Regexp == nil && c.ExcludePath.Regexp == nil &&
+		len(c.IncludeClients) == 0 && len(c.ExcludeClients) == 0 &&
+		c.IncludeUserAgent.Regexp == nil && c.ExcludeUserAgent.Regexp == nil &&
+		c.IncludeExpr.empty() && c.ExcludeExpr.empty()
+}
+
+// matchStatus reports whether status is one of the given statuses or status
+// classes
+func matchStatus(statuses stringList, status string) bool {
+	class := statusClass(status)
+	for _, s := range statuses {
+		if s == status || (class != "" && strings.EqualFold(s, class)) {
+			return true
+		}
+	}
+	return false
+}
+
+// skip reports whether entry is filtered out by the filters of ns
+func (ns *namespace) skip(entry *gonx.Entry) bool {
+	c := ns.config.Filter
+
+	if len(c.IncludeStatus) > 0 || len(c.ExcludeStatus) > 0 {
+		status, _ := entry.Field("status")
+		if len(c.IncludeStatus) > 0 && !matchStatus(c.IncludeStatus, status) {
+			return true
+		}
+		if matchStatus(c.ExcludeStatus, status) {
+			return true
+		}
+	}
+
+	if c.IncludePath.Regexp != nil || c.ExcludePath.Regexp != nil {
+		path := requestPath(entry)
+		if c.IncludePath.Regexp != nil && !c.IncludePath.MatchString(path) {
+			return true
+		}
+		if c.ExcludePath.Regexp != nil && c.ExcludePath.MatchString(path) {
+			return true
+		}
+	}
+
+	if len(c.IncludeClients) > 0 || len(c.ExcludeClients) > 0 {
+		ip := clientIP(entry, false)
+		if len(c.IncludeClients) > 0 && (ip == nil || !c.IncludeClients.contains(ip)) {
+			return true
+		}
+		if ip != nil && c.ExcludeClients.contains(ip) {
+			return true
+		}
+	}
+
+	if c.IncludeUserAgent.Regexp != nil || c.ExcludeUserAgent.Regexp != nil {
+		userAgent, _ := entry.Field("http_user_agent")
+		if c.IncludeUserAgent.Regexp != nil && !c.IncludeUserAgent.MatchString(userAgent) {
+			return true
+		}
+		if c.ExcludeUserAgent.Regexp != nil && c.ExcludeUserAgent.MatchString(userAgent) {
+			return true
+		}
+	}
+
+	if !c.IncludeExpr.empty() && !c.IncludeExpr.match(ns, entry) {
+		return true
+	}
+	if !c.ExcludeExpr.empty() && c.ExcludeExpr.match(ns, entry) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyrius/gonx"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFilterSkip(t *testing.T) {
+	tests := []struct {
+		filter string
+		// skipped are the statuses of the lines skipped
+		skipped []string
+	}{
+		{
+			filter:  `{}`,
+			skipped: nil,
+		},
+		{
+			filter:  `{include_status: [5xx, "404"]}`,
+			skipped: []string{"200", "301", "403"},
+		},
+		{
+			filter:  `{exclude_status: [3xx]}`,
+			skipped: []string{"301"},
+		},
+		{
+			filter:  `{exclude_path: /healthz}`,
+			skipped: []string{"200"},
+		},
+		{
+			filter:  `{include_path: /api/.*}`,
+			skipped: []string{"200", "301", "404"},
+		},
+		{
+			filter:  `{exclude_clients: [10.0.0.0/8, "::1"]}`,
+			skipped: []string{"301", "500"},
+		},
+		{
+			filter:  `{include_clients: [192.0.2.1]}`,
+			skipped: []string{"200", "301", "404", "500"},
+		},
+		{
+			filter:  `{exclude_user_agent: ELB-HealthChecker/.*}`,
+			skipped: []string{"200"},
+		},
+		{
+			filter:  `{include_user_agent: curl/.*}`,
+			skipped: []string{"200", "301", "500"},
+		},
+		{
+			filter:  `{include_expr: 'status >= 400 && path startsWith "/api"'}`,
+			skipped: []string{"200", "301", "404"},
+		},
+		{
+			filter:  `{exclude_expr: 'request_time > 1'}`,
+			skipped: []string{"500"},
+		},
+		{
+			filter:  `{exclude_status: [404], exclude_path: /healthz}`,
+			skipped: []string{"200", "404"},
+		},
+	}
+
+	entries := []gonx.Fields{
+		{"status": "200", "request": "GET /healthz HTTP/1.1", "remote_addr": "192.0.2.7", "http_user_agent": "ELB-HealthChecker/2.0", "request_time": "0.001"},
+		{"status": "301", "request": "GET /old HTTP/1.1", "remote_addr": "10.1.2.3", "http_user_agent": "Mozilla/5.0", "request_time": "0.002"},
+		{"status": "403", "request": "GET /api/admin HTTP/1.1", "remote_addr": "192.0.2.1", "http_user_agent": "curl/8.0", "request_time": "0.003"},
+		{"status": "404", "request": "GET /missing HTTP/1.1", "remote_addr": "192.0.2.8", "http_user_agent": "curl/8.0", "request_time": "0.004"},
+		{"status": "500", "request": "POST /api/orders HTTP/1.1", "remote_addr": "::1", "http_user_agent": "Mozilla/5.0", "request_time": "2.5"},
+	}
+
+	for _, test := range tests {
+		var nc NamespaceConfig
+		if err := yaml.Unmarshal([]byte("filter: "+test.filter), &nc); err != nil {
+			t.Fatalf("%s: %s", test.filter, err)
+		}
+		ns := &namespace{config: nc}
+
+		var skipped []string
+		for _, fields := range entries {
+			if ns.skip(gonx.NewEntry(fields)) {
+				skipped = append(skipped, fields["status"])
+			}
+		}
+		if !reflect.DeepEqual(skipped, test.skipped) {
+			t.Errorf("%s: skipped %q, want %q", test.filter, skipped, test.skipped)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	commonFormat   = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+	combinedFormat = commonFormat + ` "$http_referer" "$http_user_agent"`
+)
+
+// formatPresets maps preset names to their nginx log_format definition
+var formatPresets = map[string]string{
+	"common":             commonFormat,
+	"combined":           combinedFormat,
+	"combined_plus_time": combinedFormat + ` $request_time`,
+}
+
+var formatVariable = regexp.MustCompile(`\$\w+`)
+
+// presetNames returns the sorted names of all known format presets
+func presetNames() []string {
+	names := make([]string, 0, len(formatPresets))
+	for name := range formatPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveFormat returns the log format to use for c. An explicitly given
+// format takes precedence over a preset, overrides replace individual
+// variables of the resulting format.
+func resolveFormat(c LogConfig, formatSet bool) (string, error) {
+	format := c.Format
+
+	if c.Preset != "" && !formatSet {
+		preset, ok := formatPresets[c.Preset]
+		if !ok {
+			return "", fmt.Errorf("unknown format preset '%s', valid presets are: %s", c.Preset, strings.Join(presetNames(), ", "))
+		}
+		format = preset
+	}
+
+	if len(c.FormatOverrides) == 0 {
+		return format, nil
+	}
+
+	return formatVariable.ReplaceAllStringFunc(format, func(v string) string {
+		if replacement, ok := c.FormatOverrides[v[1:]]; ok {
+			return replacement
+		}
+		return v
+	}), nil
+}
@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+func TestFormatPresets(t *testing.T) {
+	withTime := gonx.Fields{"request_time": "0.012"}
+	for name, value := range combinedFields {
+		withTime[name] = value
+	}
+
+	testParseFields(t, []parseTest{
+		{
+			name:   "common",
+			config: LogConfig{Preset: "common"},
+			line:   `1.2.3.4 - - [15/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 304 0`,
+			want: gonx.Fields{
+				"remote_addr":     "1.2.3.4",
+				"remote_user":     "-",
+				"time_local":      "15/Oct/2026:10:00:00 +0000",
+				"request":         "GET / HTTP/1.1",
+				"status":          "304",
+				"body_bytes_sent": "0",
+			},
+		},
+		{
+			name:   "combined",
+			config: LogConfig{Preset: "combined"},
+			line:   combinedLine,
+			want:   combinedFields,
+		},
+		{
+			name:   "combined with the scanner",
+			config: LogConfig{Preset: "combined", Parser: "scanner"},
+			line:   combinedLine,
+			want:   combinedFields,
+		},
+		{
+			name:   "combined_plus_time",
+			config: LogConfig{Preset: "combined_plus_time"},
+			line:   combinedLine + " 0.012",
+			want:   withTime,
+		},
+		{
+			name:   "combined_plus_time without time",
+			config: LogConfig{Preset: "combined_plus_time"},
+			line:   combinedLine,
+		},
+		{
+			name:   "override",
+			config: LogConfig{Preset: "common", FormatOverrides: map[string]string{"remote_addr": "$http_x_forwarded_for"}},
+			line:   `5.6.7.8 - - [15/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 12`,
+			want: gonx.Fields{
+				"http_x_forwarded_for": "5.6.7.8",
+				"remote_user":          "-",
+				"time_local":           "15/Oct/2026:10:00:00 +0000",
+				"request":              "GET / HTTP/1.1",
+				"status":               "200",
+				"body_bytes_sent":      "12",
+			},
+		},
+	})
+
+	if _, err := resolveFormat(LogConfig{Preset: "unknown"}, false); err == nil {
+		t.Error("unknown preset resolved")
+	}
+	format, err := resolveFormat(LogConfig{Preset: "common", Format: "$status"}, true)
+	if err != nil || format != "$status" {
+		t.Errorf("explicit format resolved to %q, error %v", format, err)
+	}
+}
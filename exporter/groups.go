@@ -0,0 +1,195 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// groupNameRE matches the names of groups, which are the last segment of
+// the path their metrics are exposed on
+var groupNameRE = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// GroupConfig describes a group of namespaces, whose metrics are exposed on
+// a path of their own. BasicAuthUsers maps the users allowed to scrape them
+// to the bcrypt hashes of their passwords, like basic_auth_users of the web
+// configuration file.
+type GroupConfig struct {
+	Name           string            `yaml:"name"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+// validateGroups checks the groups of the configuration file and that the
+// groups of namespaces have legal names
+func validateGroups(groups []GroupConfig, namespaces []NamespaceConfig) error {
+	used := make(map[string]bool)
+	for _, ns := range namespaces {
+		if ns.Group == "" {
+			continue
+		}
+		if !groupNameRE.MatchString(ns.Group) {
+			return fmt.Errorf("namespace '%s': invalid group name '%s', which may only contain letters, digits, _ and -", ns.Name, ns.Group)
+		}
+		used[ns.Group] = true
+	}
+
+	seen := make(map[string]bool)
+	for i, g := range groups {
+		if g.Name == "" {
+			return fmt.Errorf("group #%d has no name", i+1)
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("group '%s' is defined more than once", g.Name)
+		}
+		seen[g.Name] = true
+
+		if !used[g.Name] {
+			return fmt.Errorf("group '%s' has no namespaces", g.Name)
+		}
+		for user, hash := range g.BasicAuthUsers {
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return fmt.Errorf("group '%s': password of user '%s' is no bcrypt hash: %s", g.Name, user, err)
+			}
+		}
+	}
+	return nil
+}
+
+// groupConfigs returns the groups of namespaces in the order of their first
+// namespace, with the settings of the groups of the configuration file
+func groupConfigs(namespaces []NamespaceConfig, groups []GroupConfig) []GroupConfig {
+	declared := make(map[string]GroupConfig, len(groups))
+	for _, g := range groups {
+		declared[g.Name] = g
+	}
+
+	var result []GroupConfig
+	seen := make(map[string]bool)
+	for _, ns := range namespaces {
+		if ns.Group == "" || seen[ns.Group] {
+			continue
+		}
+		seen[ns.Group] = true
+
+		g, ok := declared[ns.Group]
+		if !ok {
+			g = GroupConfig{Name: ns.Group}
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
+// groupCollector collects the metrics of the namespaces of a group and
+// their self-telemetry. With exclude it collects the metrics of all other
+// namespaces instead, and the self-telemetry series of no namespace. It
+// implements prometheus.Collector.
+type groupCollector struct {
+	namespaces map[string]bool
+	exclude    bool
+	collectors []prometheus.Collector
+	telemetry  prometheus.Collector
+}
+
+// Describe implements prometheus.Collector
+func (g *groupCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range g.collectors {
+		c.Describe(ch)
+	}
+	g.telemetry.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. Only the self-telemetry series
+// selected by their namespace label are collected.
+func (g *groupCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range g.collectors {
+		c.Collect(ch)
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		g.telemetry.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		if g.selected(m) {
+			ch <- m
+		}
+	}
+}
+
+// selected tells whether the self-telemetry series m is collected
+func (g *groupCollector) selected(m prometheus.Metric) bool {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		return false
+	}
+	for _, l := range pb.Label {
+		if l.GetName() == "namespace" {
+			return g.namespaces[l.GetValue()] != g.exclude
+		}
+	}
+	return g.exclude
+}
+
+// Groups returns the groups of namespaces of e, whose metrics are exposed
+// on their own paths
+func (e *Exporter) Groups() []GroupConfig {
+	return e.groups
+}
+
+// GroupCollector returns the collector of the metrics of the namespaces of
+// group, including their self-telemetry
+func (e *Exporter) GroupCollector(group string) prometheus.Collector {
+	g := &groupCollector{
+		namespaces: make(map[string]bool),
+		telemetry:  e.telemetryCollectors,
+	}
+	for _, ns := range e.namespaces {
+		if ns.config.Group == group {
+			g.namespaces[ns.config.Name] = true
+			g.collectors = append(g.collectors, ns.collectors)
+		}
+	}
+	return g
+}
+
+// UnrestrictedCollector returns the collector of all metrics of e but those
+// of the namespaces of groups restricted to their own users, which are only
+// exposed on the paths of their groups
+func (e *Exporter) UnrestrictedCollector() prometheus.Collector {
+	restricted := e.restrictedGroups()
+	g := &groupCollector{
+		namespaces: make(map[string]bool),
+		exclude:    true,
+		telemetry:  e.telemetryCollectors,
+	}
+	for _, ns := range e.namespaces {
+		if restricted[ns.config.Group] {
+			g.namespaces[ns.config.Name] = true
+		} else {
+			g.collectors = append(g.collectors, ns.collectors)
+		}
+	}
+	return g
+}
+
+// Restricted tells whether e has groups restricted to their own users
+func (e *Exporter) Restricted() bool {
+	return len(e.restrictedGroups()) > 0
+}
+
+// restrictedGroups returns the names of the groups with users of their own
+func (e *Exporter) restrictedGroups() map[string]bool {
+	restricted := make(map[string]bool)
+	for _, g := range e.groups {
+		if len(g.BasicAuthUsers) > 0 {
+			restricted[g.Name] = true
+		}
+	}
+	return restricted
+}
@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inputHealth tracks whether the input of a namespace is attached, has
+// processed a line and which of its followers failed
+type inputHealth struct {
+	// attached is the time in Unix nanoseconds the input was attached at,
+	// 0 as long as it is not attached
+	attached  int64
+	processed uint32
+
+	mu       sync.Mutex
+	failures map[string]error
+}
+
+func newInputHealth() *inputHealth {
+	return &inputHealth{failures: make(map[string]error)}
+}
+
+// attach marks the input as attached, only the first call is recorded
+func (h *inputHealth) attach() {
+	atomic.CompareAndSwapInt64(&h.attached, 0, time.Now().UnixNano())
+}
+
+// lineProcessed marks that the input has processed a line
+func (h *inputHealth) lineProcessed() {
+	if atomic.LoadUint32(&h.processed) == 0 {
+		atomic.StoreUint32(&h.processed, 1)
+	}
+}
+
+// fail records that the follower of input stopped with err
+func (h *inputHealth) fail(input string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures[input] = err
+}
+
+// forget removes the failure of input, which is no longer followed
+func (h *inputHealth) forget(input string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.failures, input)
+}
+
+// problems returns the failures of the input
+func (h *inputHealth) problems() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var problems []string
+	for input, err := range h.failures {
+		problems = append(problems, fmt.Sprintf("%s: %s", input, err))
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// ready reports whether the input is attached and has processed a line or
+// was attached longer than timeout ago
+func (h *inputHealth) ready(timeout time.Duration) (bool, string) {
+	attached := atomic.LoadInt64(&h.attached)
+	if attached == 0 {
+		return false, "input not attached"
+	}
+	if atomic.LoadUint32(&h.processed) == 0 && time.Since(time.Unix(0, attached)) < timeout {
+		return false, "waiting for the first line"
+	}
+	return true, ""
+}
+
+// HealthyHandler reports the exporter as unhealthy as soon as the follower
+// of an input failed
+func (e *Exporter) HealthyHandler() http.Handler {
+	namespaces := e.namespaces
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var problems []string
+		for _, ns := range namespaces {
+			for _, p := range ns.health.problems() {
+				problems = append(problems, fmt.Sprintf("namespace '%s': %s", ns.config.Name, p))
+			}
+		}
+
+		writeHealth(w, problems, "Healthy")
+	})
+}
+
+// ReadyHandler reports the exporter as ready once the inputs of all
+// namespaces are attached and have processed a line or timeout has passed
+func (e *Exporter) ReadyHandler(timeout time.Duration) http.Handler {
+	namespaces := e.namespaces
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var problems []string
+		for _, ns := range namespaces {
+			if ok, reason := ns.health.ready(timeout); !ok {
+				problems = append(problems, fmt.Sprintf("namespace '%s': %s", ns.config.Name, reason))
+			}
+		}
+
+		writeHealth(w, problems, "Ready")
+	})
+}
+
+func writeHealth(w http.ResponseWriter, problems []string, ok string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(problems, "\n"))
+		return
+	}
+	fmt.Fprintln(w, ok)
+}
@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/denniswinter/nginx-log-exporter/relabel"
+)
+
+// kubernetesLabels are the labels added to all metrics in Kubernetes mode
+var kubernetesLabels = []string{"pod", "namespace", "container"}
+
+// containerLogName matches the names of the container log files below
+// /var/log/containers, which are <pod>_<namespace>_<container>-<id>.log
+var containerLogName = regexp.MustCompile(`^([^_]+)_([^_]+)_(.+)-[0-9a-f]{64}\.log$`)
+
+// KubernetesConfig is a struct
+type KubernetesConfig struct {
+	Enabled       bool           `yaml:"enabled" long:"kubernetes" description:"Add the pod, namespace and container labels, taken from the names of the log files below /var/log/containers or the downward API"`
+	Pod           relabel.Regexp `yaml:"pod" long:"kubernetes.pod" description:"Only follow the container logs of pods whose name matches this anchored regular expression"`
+	Namespace     relabel.Regexp `yaml:"namespace" long:"kubernetes.namespace" description:"Only follow the container logs of namespaces matching this anchored regular expression"`
+	Container     relabel.Regexp `yaml:"container" long:"kubernetes.container" description:"Only follow the logs of containers whose name matches this anchored regular expression, e.g. nginx"`
+	PodName       string         `yaml:"pod_name" long:"kubernetes.pod-name" env:"POD_NAME" description:"Name of the pod for log files not below /var/log/containers, e.g. from the downward API when running as sidecar"`
+	PodNamespace  string         `yaml:"pod_namespace" long:"kubernetes.pod-namespace" env:"POD_NAMESPACE" description:"Namespace of the pod for log files not below /var/log/containers"`
+	ContainerName string         `yaml:"container_name" long:"kubernetes.container-name" env:"CONTAINER_NAME" description:"Name of the container for log files not below /var/log/containers"`
+}
+
+// fileFields returns the pod, namespace and container of the log file
+// filename as entry fields. It returns false if the file does not match the
+// selectors of c.
+func (c KubernetesConfig) fileFields(filename string) (map[string]string, bool) {
+	if !c.Enabled {
+		return nil, true
+	}
+
+	pod, namespace, container := c.PodName, c.PodNamespace, c.ContainerName
+	if m := containerLogName.FindStringSubmatch(filepath.Base(filename)); m != nil {
+		pod, namespace, container = m[1], m[2], m[3]
+	}
+
+	for _, s := range []struct {
+		re    relabel.Regexp
+		value string
+	}{{c.Pod, pod}, {c.Namespace, namespace}, {c.Container, container}} {
+		if s.re.Regexp != nil && !s.re.MatchString(s.value) {
+			return nil, false
+		}
+	}
+
+	return map[string]string{
+		"pod":       pod,
+		"namespace": namespace,
+		"container": container,
+	}, true
+}
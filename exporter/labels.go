@@ -0,0 +1,271 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/denniswinter/nginx-log-exporter/relabel"
+	"github.com/satyrius/gonx"
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// labelNames is a list of label names which is given as a comma separated
+// flag value
+type labelNames []string
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (l *labelNames) UnmarshalFlag(value string) error {
+	*l = nil
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (l labelNames) MarshalFlag() (string, error) {
+	return strings.Join(l, ","), nil
+}
+
+// validate checks that every name is a legal and unique label name
+func (l labelNames) validate() error {
+	seen := make(map[string]bool, len(l))
+	for _, name := range l {
+		if !labelNameRE.MatchString(name) {
+			return fmt.Errorf("invalid label name '%s'", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("label '%s' is given more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// labelValue returns the value of the label name for entry, which is either
+// derived by a label expression or taken from fieldValue. The status is
+// aggregated according to the statuses to keep, while expressions see the
+// status as it is.
+func (ns *namespace) labelValue(entry *gonx.Entry, name string) string {
+	for _, le := range ns.config.LabelExpressions {
+		if le.Name == name {
+			return le.Expr.value(ns, entry)
+		}
+	}
+
+	value := ns.fieldValue(entry, name)
+	if name == "status" {
+		return aggregateStatus(value, ns.config.KeepStatuses)
+	}
+	return value
+}
+
+// fieldValue returns the value of the label name for entry. Labels are named
+// after the log variable they are taken from, except for method which is the
+// request method taken from $request_method or the first part of $request
+// and labeled OTHER unless it is one of the configured methods, path which is
+// the request path mapped to its route, status_class which is the class of
+// $status like 2xx, vhost which is the virtual host taken from $host,
+// $server_name or $http_host and http_version which is the protocol version
+// taken from $server_protocol or the last part of $request. bot is
+// true or false depending on whether $http_user_agent belongs to a crawler
+// and crawler is the name of that crawler.
+func (ns *namespace) fieldValue(entry *gonx.Entry, name string) string {
+	switch name {
+	case "bot":
+		return strconv.FormatBool(ns.entryCrawler(entry) != "")
+	case "crawler":
+		return ns.entryCrawler(entry)
+	case "http_version":
+		return httpVersion(entry)
+	case "vhost":
+		return virtualHost(entry)
+	case "status_class":
+		status, _ := entry.Field("status")
+		return statusClass(status)
+	case "path":
+		return route(ns.config.Routes, requestPath(entry), !ns.config.DisablePathNormalization)
+	case "method":
+		return normalizeMethod(requestMethod(entry), ns.config.Methods)
+	}
+
+	value, _ := entry.Field(name)
+	return value
+}
+
+// metricLabels returns the label names of metrics for nc, which are the
+// configured labels followed by path if routes are configured, the labels of
+// Kubernetes mode, the labels derived by expressions and the targets of
+// relabeling rules
+func metricLabels(nc NamespaceConfig) []string {
+	names := append([]string{}, nc.MetricLabels...)
+
+	var targets []string
+	if nc.Kubernetes.Enabled {
+		targets = append(targets, kubernetesLabels...)
+	}
+	if len(nc.Routes) > 0 {
+		targets = append(targets, "path")
+	}
+	for _, le := range nc.LabelExpressions {
+		targets = append(targets, le.Name)
+	}
+	targets = append(targets, relabel.Targets(nc.RelabelConfigs)...)
+
+	for _, target := range targets {
+		found := false
+		for _, name := range names {
+			if name == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, target)
+		}
+	}
+	return names
+}
+
+// entryLabelValues returns the values of all metric labels of ns for entry
+// in order. It returns false if the entry was dropped by a relabeling rule.
+func entryLabelValues(ns *namespace, entry *gonx.Entry) ([]string, bool) {
+	values := make([]string, len(ns.labels))
+
+	if len(ns.config.RelabelConfigs) == 0 {
+		for i, name := range ns.labels {
+			values[i] = ns.labelValue(entry, name)
+		}
+		return values, true
+	}
+
+	labels := make(relabel.Labels, len(ns.labels))
+	for _, name := range ns.labels {
+		labels[name] = ns.labelValue(entry, name)
+	}
+
+	lookup := func(name string) string {
+		return ns.labelValue(entry, name)
+	}
+	if !relabel.Process(labels, ns.config.RelabelConfigs, lookup) {
+		return nil, false
+	}
+
+	for i, name := range ns.labels {
+		values[i] = labels[name]
+	}
+	return values, true
+}
+
+// aggregateStatus returns status if it matches one of the statuses or status
+// classes of keep and its class like 4xx otherwise. Statuses without a valid
+// class are other. Without keep every status is kept.
+func aggregateStatus(status string, keep stringList) string {
+	if len(keep) == 0 || matchStatus(keep, status) {
+		return status
+	}
+	if class := statusClass(status); class != "" {
+		return class
+	}
+	return "other"
+}
+
+// statusClass returns the class of an HTTP status code like 2xx, or an empty
+// string if status is not a valid status code
+func statusClass(status string) string {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return ""
+	}
+	return status[:1] + "xx"
+}
+
+// virtualHost returns the lowercased host name of the virtual host which
+// served entry without port
+func virtualHost(entry *gonx.Entry) string {
+	for _, field := range []string{"host", "server_name", "http_host"} {
+		host, err := entry.Field(field)
+		if err != nil || host == "" || host == "-" {
+			continue
+		}
+
+		if i := strings.LastIndex(host, ":"); i >= 0 && !strings.HasSuffix(host, "]") {
+			host = host[:i]
+		}
+		return strings.ToLower(strings.Trim(host, "[]"))
+	}
+	return ""
+}
+
+// otherMethod is the method label of requests whose method is not one of
+// the configured methods, e.g. garbage sent by scanners
+const otherMethod = "OTHER"
+
+// requestMethod returns the request method of entry taken from
+// $request_method or the first part of $request
+func requestMethod(entry *gonx.Entry) string {
+	if method, err := entry.Field("request_method"); err == nil {
+		return method
+	}
+	if request, err := entry.Field("request"); err == nil {
+		if chunks := strings.Fields(request); len(chunks) > 0 {
+			return chunks[0]
+		}
+	}
+	return ""
+}
+
+// normalizeMethod returns method in upper case if it is one of methods and
+// OTHER otherwise, e.g. for the method - of a $request logged as -. Without
+// methods every method but an empty one is kept as it is.
+func normalizeMethod(method string, methods stringList) string {
+	if len(methods) == 0 {
+		if method == "" {
+			return otherMethod
+		}
+		return method
+	}
+
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return strings.ToUpper(method)
+		}
+	}
+	return otherMethod
+}
+
+// httpVersions maps the protocols logged by nginx to the http_version label
+var httpVersions = map[string]string{
+	"HTTP/0.9": "HTTP/0.9",
+	"HTTP/1.0": "HTTP/1.0",
+	"HTTP/1.1": "HTTP/1.1",
+	"HTTP/2.0": "HTTP/2",
+	"HTTP/2":   "HTTP/2",
+	"HTTP/3.0": "HTTP/3",
+	"HTTP/3":   "HTTP/3",
+}
+
+// httpVersion returns the HTTP protocol version of the request of entry
+func httpVersion(entry *gonx.Entry) string {
+	protocol, err := entry.Field("server_protocol")
+	if err != nil {
+		request, err := entry.Field("request")
+		if err != nil {
+			return ""
+		}
+
+		chunks := strings.Fields(request)
+		if len(chunks) < 3 {
+			return ""
+		}
+		protocol = chunks[len(chunks)-1]
+	}
+
+	return httpVersions[strings.ToUpper(protocol)]
+}
@@ -0,0 +1,76 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyrius/gonx"
+	"gopkg.in/yaml.v2"
+)
+
+func TestEntryLabelValuesRelabeled(t *testing.T) {
+	tests := []struct {
+		config string
+		want   []string
+	}{
+		{
+			config: `
+name: app
+metric_labels: [method]
+routes:
+  - match: /api/.*
+    name: api
+`,
+			want: []string{"GET", "api"},
+		},
+		{
+			config: `
+name: app
+metric_labels: [method]
+routes:
+  - match: /api/.*
+    name: api
+relabel_configs:
+  - source_labels: [method]
+    target_label: verb
+`,
+			want: []string{"GET", "api", "GET"},
+		},
+		{
+			config: `
+name: app
+metric_labels: [method]
+label_expressions:
+  - name: slow
+    expr: 'request_time > 1 ? "yes" : "no"'
+relabel_configs:
+  - source_labels: [slow]
+    target_label: latency
+    replacement: slow-$1
+`,
+			want: []string{"GET", "yes", "slow-yes"},
+		},
+	}
+
+	entry := gonx.NewEntry(gonx.Fields{
+		"request":      "GET /api/users HTTP/1.1",
+		"request_time": "1.5",
+	})
+
+	for _, test := range tests {
+		var nc NamespaceConfig
+		if err := yaml.Unmarshal([]byte(test.config), &nc); err != nil {
+			t.Fatal(err)
+		}
+		ns := &namespace{config: nc, labels: metricLabels(nc)}
+
+		got, ok := entryLabelValues(ns, entry)
+		if !ok {
+			t.Errorf("%s: entry dropped", test.config)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: label values %q, want %q", test.config, got, test.want)
+		}
+	}
+}
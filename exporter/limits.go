@@ -0,0 +1,26 @@
+package exporter
+
+import (
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// observeLimitStatus counts the $limit_req_status and $limit_conn_status of
+// entry, which nginx only sets for requests to locations with limit_req or
+// limit_conn, e.g. PASSED, DELAYED or REJECTED
+func observeLimitStatus(m *Metrics, entry *gonx.Entry, labelValues []string) {
+	for _, l := range []struct {
+		field  string
+		metric *counterMetric
+	}{
+		{"limit_req_status", m.limitReqRequests},
+		{"limit_conn_status", m.limitConnRequests},
+	} {
+		status, err := entry.Field(l.field)
+		if err != nil || status == "" || status == "-" {
+			continue
+		}
+		l.metric.add(append(append([]string{}, labelValues...), strings.ToUpper(status)), 1)
+	}
+}
@@ -0,0 +1,198 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+// LokiConfig is a struct
+type LokiConfig struct {
+	URL           string            `long:"loki.url" description:"Push URL of Loki to forward the log lines to, e.g. http://loki:3100/loki/api/v1/push"`
+	Format        string            `long:"loki.format" default:"raw" choice:"raw" choice:"json" description:"Forward the line as it is or the parsed fields as JSON object"`
+	Labels        map[string]string `long:"loki.label" description:"Stream label of the forwarded lines, e.g. job:nginx"`
+	LabelFields   labelNames        `long:"loki.label-fields" description:"Comma separated list of log variables to add as stream labels, e.g. status, every label value creates a stream of its own"`
+	TenantID      string            `long:"loki.tenant-id" description:"Tenant to push the lines as, sent as X-Scope-OrgID header"`
+	BatchSize     int               `long:"loki.batch-size" default:"1000" description:"Maximum number of lines per push"`
+	FlushInterval time.Duration     `long:"loki.flush-interval" default:"1s" description:"Maximum time a line is buffered before it is pushed"`
+	Timeout       time.Duration     `long:"loki.timeout" default:"10s" description:"Timeout of a single push"`
+}
+
+// lokiStream is a stream of the Loki push API
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiClient buffers lines per stream and pushes them to Loki in batches
+type lokiClient struct {
+	config LokiConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	streams map[string]*lokiStream
+	lines   int
+
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newLokiClient(c LokiConfig) *lokiClient {
+	l := &lokiClient{
+		config:  c,
+		client:  &http.Client{Timeout: c.Timeout},
+		streams: make(map[string]*lokiStream),
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	slog.Info("Forwarding lines to Loki", "url", c.URL, "format", c.Format)
+	go l.run()
+
+	return l
+}
+
+func (l *lokiClient) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		case <-l.flush:
+		}
+
+		if err := l.push(context.Background()); err != nil {
+			slog.Error("Error while pushing lines to Loki", "url", l.config.URL, "err", err)
+		}
+	}
+}
+
+// stop pushes the buffered lines and stops
+func (l *lokiClient) stop(ctx context.Context) error {
+	close(l.done)
+	<-l.stopped
+	return l.push(ctx)
+}
+
+// forward buffers the line of entry of ns, fields is the fields map of
+// entry. line and entry must already be anonymized.
+func (l *lokiClient) forward(ns *namespace, line string, entry *gonx.Entry, fields gonx.Fields) {
+	if l == nil {
+		return
+	}
+
+	labels := map[string]string{"namespace": ns.config.Name}
+	for name, value := range l.config.Labels {
+		labels[name] = value
+	}
+	for _, name := range l.config.LabelFields {
+		labels[name] = ns.labelValue(entry, name)
+	}
+
+	if l.config.Format == "json" {
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return
+		}
+		line = string(b)
+	}
+
+	ts, ok := entryTime(entry)
+	if !ok {
+		ts = time.Now()
+	}
+
+	key := streamKey(labels)
+
+	l.mu.Lock()
+	s, ok := l.streams[key]
+	if !ok {
+		s = &lokiStream{Stream: labels}
+		l.streams[key] = s
+	}
+	s.Values = append(s.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), line})
+	l.lines++
+	full := l.lines >= l.config.BatchSize
+	l.mu.Unlock()
+
+	if full {
+		select {
+		case l.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// push sends the buffered lines. Lines are dropped if Loki rejects them, as
+// they have been counted in the metrics already.
+func (l *lokiClient) push(ctx context.Context) error {
+	l.mu.Lock()
+	if l.lines == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	streams := make([]*lokiStream, 0, len(l.streams))
+	for _, s := range l.streams {
+		streams = append(streams, s)
+	}
+	l.streams = make(map[string]*lokiStream)
+	l.lines = 0
+	l.mu.Unlock()
+
+	body, err := json.Marshal(map[string]interface{}{"streams": streams})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nginx-log-exporter")
+	if l.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.config.TenantID)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// streamKey identifies the stream with labels
+func streamKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"\x00"+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x01")
+}
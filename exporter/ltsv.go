@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// ltsvLabels maps the labels recommended by ltsv.org to the nginx variables
+// feeding the metrics
+var ltsvLabels = map[string]string{
+	"host":         "remote_addr",
+	"user":         "remote_user",
+	"time":         "time_local",
+	"req":          "request",
+	"method":       "request_method",
+	"uri":          "request_uri",
+	"protocol":     "server_protocol",
+	"status":       "status",
+	"size":         "body_bytes_sent",
+	"reqsize":      "request_length",
+	"referer":      "http_referer",
+	"ua":           "http_user_agent",
+	"vhost":        "host",
+	"reqtime":      "request_time",
+	"apptime":      "upstream_response_time",
+	"forwardedfor": "http_x_forwarded_for",
+	"cache":        "upstream_cache_status",
+}
+
+// ltsvLabelRE matches the labels allowed by the LTSV specification
+var ltsvLabelRE = regexp.MustCompile(`^[0-9A-Za-z_.-]+$`)
+
+// ltsvParser parses log lines in Labeled Tab-separated Values format, see
+// http://ltsv.org, like time:[10/Oct/2000:13:55:36 -0700]<TAB>status:200
+type ltsvParser struct {
+	fields map[string]string
+}
+
+// ParseFields extracts all labeled values of line as entry fields. Labels
+// are renamed according to the configured field mapping, or else to the
+// nginx variable of a recommended label like reqtime for request_time. The
+// brackets of a bracketed time are removed, so that it parses as
+// $time_local.
+func (p *ltsvParser) ParseFields(line string) (gonx.Fields, error) {
+	fields := make(gonx.Fields)
+	for _, pair := range strings.Split(line, "\t") {
+		i := strings.IndexByte(pair, ':')
+		if i <= 0 || !ltsvLabelRE.MatchString(pair[:i]) {
+			return nil, fmt.Errorf("invalid LTSV field '%s'", pair)
+		}
+		label, value := pair[:i], pair[i+1:]
+
+		name, ok := p.fields[label]
+		if !ok {
+			if name, ok = ltsvLabels[label]; !ok {
+				name = label
+			}
+		}
+		if name == "time_local" {
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		}
+		fields[name] = value
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+func TestLTSVParser(t *testing.T) {
+	testParseFields(t, []parseTest{
+		{
+			name:   "ltsv",
+			config: LogConfig{FormatType: "ltsv"},
+			line:   "host:1.2.3.4\ttime:[15/Oct/2026:10:00:00 +0000]\treq:GET /a HTTP/1.1\tstatus:200\tsize:612\treqtime:0.012\tupstream_addr:10.0.0.2:80",
+			want: gonx.Fields{
+				"remote_addr":     "1.2.3.4",
+				"time_local":      "15/Oct/2026:10:00:00 +0000",
+				"request":         "GET /a HTTP/1.1",
+				"status":          "200",
+				"body_bytes_sent": "612",
+				"request_time":    "0.012",
+				"upstream_addr":   "10.0.0.2:80",
+			},
+		},
+		{
+			name:   "ltsv with field mapping",
+			config: LogConfig{FormatType: "ltsv", JSONFields: map[string]string{"host": "host", "duration": "request_time"}},
+			line:   "host:example.com\tduration:0.5\tempty:",
+			want: gonx.Fields{
+				"host":         "example.com",
+				"request_time": "0.5",
+				"empty":        "",
+			},
+		},
+		{
+			name:   "invalid label",
+			config: LogConfig{FormatType: "ltsv"},
+			line:   "status:200\tno label",
+		},
+	})
+}
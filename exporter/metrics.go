@@ -0,0 +1,560 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is a struct containing pointers
+type Metrics struct {
+	countTotal          *counterMetric
+	bytesTotal          *counterMetric
+	upstreamSeconds     *observerMetric
+	upstreamSecondsHist *observerMetric
+	upstreamBytes       *counterMetric
+	upstreamRetries     *counterMetric
+	upstreamResponses   *counterMetric
+	upstreamMismatches  *counterMetric
+
+	upstreamConnectSeconds     *observerMetric
+	upstreamConnectSecondsHist *observerMetric
+	upstreamHeaderSeconds      *observerMetric
+	upstreamHeaderSecondsHist  *observerMetric
+
+	responseSeconds     *observerMetric
+	responseSecondsHist *observerMetric
+	responseBytes       *counterMetric
+	cacheRequests       *counterMetric
+	cacheStats          *cacheStats
+	limitReqRequests    *counterMetric
+	limitConnRequests   *counterMetric
+	tlsRequests         *counterMetric
+	tlsSessions         *counterMetric
+	requestBytes        *counterMetric
+	requestBytesHist    *observerMetric
+	responseBytesHist   *observerMetric
+	gzipRatio           *observerMetric
+	uncompressed        *counterMetric
+	geoRequests         *counterMetric
+	asnRequests         *counterMetric
+	userAgentRequests   *counterMetric
+	refererRequests     *counterMetric
+	refererDomains      *refererDomains
+	apdexRequests       *counterMetric
+	uniqueClients       *uniqueClients
+	topPaths            *topPaths
+	lastRequest         *newestTimestamp
+	parseErrorsTotal    prometheus.Counter
+
+	// expirable holds all metrics whose series expire after the TTL
+	expirable []expirable
+}
+
+// expirable is implemented by metrics whose series can expire
+type expirable interface {
+	expire(now time.Time)
+}
+
+// MetricsConfig is a struct
+type MetricsConfig struct {
+	Buckets              floatList         `long:"histogram-buckets" description:"Comma separated list of buckets for all histograms, defaults to the Prometheus default buckets"`
+	ResponseTimeBuckets  floatList         `long:"histogram-buckets.response-time" description:"Buckets for http_response_time_seconds_hist, overrides --histogram-buckets"`
+	UpstreamTimeBuckets  floatList         `long:"histogram-buckets.upstream-time" description:"Buckets for http_upstream_time_seconds_hist, overrides --histogram-buckets"`
+	RequestSizeHist      bool              `long:"request-size-histogram" description:"Export a histogram of request sizes taken from $request_length"`
+	RequestSizeBuckets   floatList         `long:"histogram-buckets.request-size" default:"100,1000,10000,100000,1000000,10000000" description:"Buckets for http_request_size_bytes"`
+	ResponseSizeHist     bool              `long:"response-size-histogram" description:"Export a histogram of response sizes taken from $body_bytes_sent"`
+	ResponseSizeBuckets  floatList         `long:"histogram-buckets.response-size" default:"100,1000,10000,100000,1000000,10000000,100000000" description:"Buckets for http_response_size_bytes"`
+	Objectives           objectives        `long:"summary-objectives" default:"0.5:0.05,0.9:0.01,0.99:0.001" description:"Comma separated list of quantile:error pairs exported by the summaries"`
+	DisableSummaries     bool              `long:"disable-summaries" description:"Do not export the latency summaries, only the histograms"`
+	EnableMetrics        stringList        `long:"metrics.enable" description:"Comma separated list of metrics to export, leaving out all others. Metrics are given by their name without namespace or a glob pattern like http_upstream_*"`
+	DisableMetrics       stringList        `long:"metrics.disable" description:"Comma separated list of metrics not to export, given by their name without namespace or a glob pattern like http_upstream_*"`
+	NativeHistograms     bool              `long:"native-histograms" description:"Additionally expose the latency histograms as native histograms"`
+	NativeBucketFactor   float64           `long:"native-histograms.bucket-factor" default:"1.1" description:"Growth factor between two consecutive native histogram buckets, must be greater than 1"`
+	NativeMaxBuckets     uint32            `long:"native-histograms.max-buckets" default:"160" description:"Maximum number of native histogram buckets per series, 0 for no limit"`
+	TTL                  time.Duration     `long:"metrics.ttl" description:"Remove series which have not been observed for this duration, e.g. 24h, 0 to keep them forever"`
+	UpstreamAddrLabel    bool              `long:"upstream-addr-label" description:"Add the upstream_addr label with the address of the upstream server to the upstream metrics"`
+	UpstreamPerAttempt   bool              `long:"upstream-per-attempt" description:"Observe the upstream time of every upstream attempt of a request instead of their sum"`
+	TLSSessionProtocol   bool              `long:"tls-sessions.protocol-label" description:"Add the protocol label with $ssl_protocol to http_tls_sessions_total"`
+	UserAgentMetrics     bool              `long:"user-agent-metrics" description:"Count requests by browser, operating system and device type parsed from $http_user_agent"`
+	BotPatterns          map[string]string `long:"bot-pattern" description:"Classify user agents matching a regular expression as crawler, e.g. MyMonitor:^my-monitor/, checked before the built-in crawlers"`
+	ApdexTarget          float64           `long:"apdex-target" description:"Response time in seconds up to which requests are satisfied, enables the Apdex metrics"`
+	ApdexTolerating      float64           `long:"apdex-tolerating" description:"Response time in seconds up to which requests are tolerating, defaults to 4 times --apdex-target"`
+	RefererMetrics       bool              `long:"referer-metrics" description:"Count requests by the registrable domain of $http_referer"`
+	RefererTop           int               `long:"referer-metrics.top" default:"20" description:"Number of referrer domains with the most recent requests to label individually, the others are labeled other"`
+	RefererInternal      stringList        `long:"referer-metrics.internal-domains" description:"Comma separated list of registrable domains whose referrers are labeled internal in addition to the domain of the requested host"`
+	UniqueClients        bool              `long:"unique-clients" description:"Export an estimate of the number of distinct client addresses"`
+	UniqueClientsWindows durationList      `long:"unique-clients.windows" default:"1h,1d" description:"Comma separated list of windows to estimate the distinct clients for, windows start at multiples of their length in UTC"`
+	TopPaths             int               `long:"top-paths" description:"Export the recent requests, bytes and time per second of this many paths with the most of them, without a path label on the other metrics, 0 to disable"`
+	TopPathsDecay        time.Duration     `long:"top-paths.decay" default:"5m" description:"Time constant in which requests lose their weight for the top paths, which is roughly the window they cover"`
+	Namespace            string            `long:"metrics.namespace" default:"nginx" description:"Namespace prefixing the names of the metrics when no configuration file is given, otherwise the name of each namespace is used"`
+	Subsystem            string            `long:"metrics.subsystem" description:"Subsystem added to the names of the metrics after the namespace, e.g. edge for nginx_edge_http_response_count_total"`
+	GeoIP                GeoIPConfig
+	SampleRate           int `long:"sample-rate" default:"1" description:"Only observe every Nth line in the latency and size histograms and summaries, multiplying their counts and sums by N when they are exposed, while the counters still count every line"`
+	SeriesLimit          int `long:"series-limit" description:"Maximum number of series per metric, further label combinations are folded into a series with all labels set to other, 0 for no limit"`
+}
+
+// GeoIPConfig is a struct
+type GeoIPConfig struct {
+	Database       string        `long:"geoip.database" description:"Path to a GeoIP2 or GeoLite2 country or city database, enables the requests by geo metric"`
+	City           bool          `long:"geoip.city" description:"Add the city label to the requests by geo metric, requires a city database"`
+	ForwardedFor   bool          `long:"geoip.use-forwarded-for" description:"Look up the first hop of $http_x_forwarded_for instead of $remote_addr"`
+	ASNDatabase    string        `long:"geoip.asn-database" description:"Path to a GeoLite2 ASN database, enables the requests by ASN metric"`
+	ASNAllowlist   asnSet        `long:"geoip.asn-allowlist" description:"Comma separated list of ASNs to label individually, requests from other ASNs are labeled other. All ASNs are labeled individually if empty"`
+	ReloadInterval time.Duration `long:"geoip.reload-interval" default:"24h" description:"Interval in which the database file is reloaded to pick up updates"`
+}
+
+// asnSet is a set of autonomous system numbers which is given as a comma
+// separated flag value
+type asnSet map[uint]bool
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (a *asnSet) UnmarshalFlag(value string) error {
+	*a = make(asnSet)
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimPrefix(strings.TrimSpace(s), "AS"); s == "" {
+			continue
+		}
+
+		asn, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ASN '%s'", s)
+		}
+		(*a)[uint(asn)] = true
+	}
+	return nil
+}
+
+// floatList is a list of floats which is given as a comma separated flag
+// value
+type floatList []float64
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (l *floatList) UnmarshalFlag(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number '%s'", s)
+		}
+		*l = append(*l, f)
+	}
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (l floatList) MarshalFlag() (string, error) {
+	s := make([]string, len(l))
+	for i, f := range l {
+		s[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strings.Join(s, ","), nil
+}
+
+// objectives maps summary quantiles to their allowed absolute error, it is
+// given as a comma separated list of quantile:error pairs
+type objectives map[float64]float64
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (o *objectives) UnmarshalFlag(value string) error {
+	*o = make(objectives)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid objective '%s', expected quantile:error", pair)
+		}
+
+		q, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil || q < 0 || q > 1 {
+			return fmt.Errorf("invalid quantile '%s'", parts[0])
+		}
+
+		e, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || e < 0 || e > 1 {
+			return fmt.Errorf("invalid error '%s'", parts[1])
+		}
+
+		(*o)[q] = e
+	}
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (o objectives) MarshalFlag() (string, error) {
+	quantiles := make([]float64, 0, len(o))
+	for q := range o {
+		quantiles = append(quantiles, q)
+	}
+	sort.Float64s(quantiles)
+
+	pairs := make([]string, len(quantiles))
+	for i, q := range quantiles {
+		pairs[i] = strconv.FormatFloat(q, 'g', -1, 64) + ":" + strconv.FormatFloat(o[q], 'g', -1, 64)
+	}
+	return strings.Join(pairs, ","), nil
+}
+
+// validateBuckets checks that buckets are given in strictly increasing order
+func validateBuckets(buckets floatList) error {
+	if !sort.Float64sAreSorted(buckets) {
+		return fmt.Errorf("histogram buckets %v are not sorted", buckets)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] == buckets[i-1] {
+			return fmt.Errorf("histogram bucket %v is given more than once", buckets[i])
+		}
+	}
+	return nil
+}
+
+// buckets returns the first non-empty list of buckets, or nil to use the
+// Prometheus default buckets
+func buckets(lists ...floatList) []float64 {
+	for _, l := range lists {
+		if len(l) > 0 {
+			return l
+		}
+	}
+	return nil
+}
+
+// latencyHistogramOpts returns the options shared by the latency histograms
+func (c MetricsConfig) latencyHistogramOpts(namespace string) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Namespace: namespace,
+	}
+
+	if c.NativeHistograms {
+		opts.NativeHistogramBucketFactor = c.NativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = c.NativeMaxBuckets
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+
+	return opts
+}
+
+// prefix returns the prefix of the metric names of namespace, which is the
+// namespace followed by the subsystem if there is one
+func (c MetricsConfig) prefix(namespace string) string {
+	if c.Subsystem == "" {
+		return namespace
+	}
+	return namespace + "_" + c.Subsystem
+}
+
+// enabled reports whether the metric name, without namespace, is exported
+func (c MetricsConfig) enabled(name string) bool {
+	for _, pattern := range c.DisableMetrics {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+
+	if len(c.EnableMetrics) == 0 {
+		return true
+	}
+	for _, pattern := range c.EnableMetrics {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the metrics configuration
+func (c MetricsConfig) validate() error {
+	if c.Namespace != "" && !labelNameRE.MatchString(c.Namespace) {
+		return fmt.Errorf("invalid namespace '%s'", c.Namespace)
+	}
+	if c.Subsystem != "" && !labelNameRE.MatchString(c.Subsystem) {
+		return fmt.Errorf("invalid subsystem '%s'", c.Subsystem)
+	}
+
+	for _, pattern := range append(append(stringList{}, c.EnableMetrics...), c.DisableMetrics...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid metric pattern '%s'", pattern)
+		}
+	}
+
+	if c.NativeHistograms && c.NativeBucketFactor <= 1 {
+		return fmt.Errorf("native histogram bucket factor must be greater than 1, got %v", c.NativeBucketFactor)
+	}
+
+	if c.ApdexTarget < 0 {
+		return fmt.Errorf("Apdex target must not be negative, got %v", c.ApdexTarget)
+	}
+	if c.ApdexTolerating != 0 && c.ApdexTolerating < c.ApdexTarget {
+		return fmt.Errorf("Apdex tolerating threshold %v must not be less than the target %v", c.ApdexTolerating, c.ApdexTarget)
+	}
+
+	if c.RefererMetrics && c.RefererTop < 1 {
+		return fmt.Errorf("number of referrer domains must be at least 1, got %d", c.RefererTop)
+	}
+
+	if c.TopPaths < 0 {
+		return fmt.Errorf("number of top paths must not be negative, got %d", c.TopPaths)
+	}
+	if c.TopPaths > 0 && c.TopPathsDecay <= 0 {
+		return fmt.Errorf("top paths decay must be positive, got %s", c.TopPathsDecay)
+	}
+
+	if c.SampleRate < 1 {
+		return fmt.Errorf("sample rate must be at least 1, got %d", c.SampleRate)
+	}
+
+	for _, b := range []floatList{c.Buckets, c.ResponseTimeBuckets, c.UpstreamTimeBuckets, c.RequestSizeBuckets, c.ResponseSizeBuckets} {
+		if err := validateBuckets(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Init Initializes a metrics struct, whose metrics are registered with reg.
+// Observations exceeding the series limit are counted by limitHits. Metrics
+// are selected by their own name and exported under the name given by
+// renames, if any.
+func (m *Metrics) Init(namespace string, labels []string, cfg MetricsConfig, renames map[string]string, reg prometheus.Registerer, limitHits *prometheus.CounterVec) {
+	// The subsystem is part of the metric names only, the series limit hits
+	// are labeled with the namespace
+	prefix := cfg.prefix(namespace)
+
+	upstreamLabels := labels
+	if cfg.UpstreamAddrLabel {
+		upstreamLabels = append(append([]string{}, labels...), "upstream_addr")
+	}
+
+	renamed := make(map[string]bool)
+	rename := func(name string) string {
+		if to, ok := renames[name]; ok {
+			renamed[name] = true
+			return to
+		}
+		return name
+	}
+	defer func() {
+		for from := range renames {
+			if !renamed[from] {
+				slog.Warn("Metric to rename is not exported", "namespace", namespace, "metric", from)
+			}
+		}
+	}()
+
+	tracker := func(name string) *seriesTracker {
+		return newSeriesTracker(cfg.SeriesLimit, cfg.TTL, limitHits.WithLabelValues(namespace, name))
+	}
+
+	// Disabled metrics are nil, which makes observing them a no-op
+	counter := func(name, help string, labels []string) *counterMetric {
+		if !cfg.enabled(name) {
+			return nil
+		}
+		name = rename(name)
+
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      name,
+			Help:      help,
+		}, labels)
+		reg.MustRegister(vec)
+
+		c := newCounterMetric(vec, tracker(name))
+		m.expirable = append(m.expirable, c)
+		return c
+	}
+
+	histogram := func(name, help string, labels []string, buckets []float64) *observerMetric {
+		if !cfg.enabled(name) {
+			return nil
+		}
+		name = rename(name)
+
+		opts := cfg.latencyHistogramOpts(prefix)
+		opts.Name = name
+		opts.Help = help
+		opts.Buckets = buckets
+
+		vec := prometheus.NewHistogramVec(opts, labels)
+		// Only every SampleRate-th line is observed
+		reg.MustRegister(weighted(vec, cfg.SampleRate))
+
+		o := newObserverMetric(vec, tracker(name))
+		m.expirable = append(m.expirable, o)
+		return o
+	}
+
+	valueHistogram := func(name, help string, buckets []float64) *observerMetric {
+		if !cfg.enabled(name) {
+			return nil
+		}
+		name = rename(name)
+
+		vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      name,
+			Help:      help,
+			Buckets:   buckets,
+		}, labels)
+		// Only every SampleRate-th line is observed
+		reg.MustRegister(weighted(vec, cfg.SampleRate))
+
+		o := newObserverMetric(vec, tracker(name))
+		m.expirable = append(m.expirable, o)
+		return o
+	}
+
+	summary := func(name, help string, labels []string) *observerMetric {
+		if cfg.DisableSummaries || !cfg.enabled(name) {
+			return nil
+		}
+		name = rename(name)
+
+		vec := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:  prefix,
+			Name:       name,
+			Help:       help,
+			Objectives: cfg.Objectives,
+		}, labels)
+		// Only every SampleRate-th line is observed
+		reg.MustRegister(weighted(vec, cfg.SampleRate))
+
+		o := newObserverMetric(vec, tracker(name))
+		m.expirable = append(m.expirable, o)
+		return o
+	}
+
+	m.countTotal = counter("http_response_count_total", "Amount of processes HTTP requests", labels)
+	m.bytesTotal = counter("http_response_bytes_total", "Total amount of transferred bytes", labels)
+
+	m.upstreamSeconds = summary("http_upstream_time_seconds", "Time needed by upstream servers to handle requests", upstreamLabels)
+	m.upstreamSecondsHist = histogram("http_upstream_time_seconds_hist", "Time needed by upstream servers to handle requests", upstreamLabels, buckets(cfg.UpstreamTimeBuckets, cfg.Buckets))
+	m.upstreamBytes = counter("http_upstream_bytes", "Amount of upstream bytes send", upstreamLabels)
+	m.upstreamConnectSeconds = summary("http_upstream_connect_time_seconds", "Time needed to establish connections to upstream servers", upstreamLabels)
+	m.upstreamConnectSecondsHist = histogram("http_upstream_connect_time_seconds_hist", "Time needed to establish connections to upstream servers", upstreamLabels, buckets(cfg.UpstreamTimeBuckets, cfg.Buckets))
+	m.upstreamHeaderSeconds = summary("http_upstream_header_time_seconds", "Time needed by upstream servers to send the response header", upstreamLabels)
+	m.upstreamHeaderSecondsHist = histogram("http_upstream_header_time_seconds_hist", "Time needed by upstream servers to send the response header", upstreamLabels, buckets(cfg.UpstreamTimeBuckets, cfg.Buckets))
+	m.upstreamRetries = counter("http_upstream_retries_total", "Number of upstream attempts made in addition to the first one", labels)
+	m.upstreamResponses = counter("http_upstream_responses_total", "Amount of responses of upstream servers by $upstream_status, counting every upstream attempt", append(append([]string{}, upstreamLabels...), "upstream_status"))
+	m.upstreamMismatches = counter("http_upstream_status_mismatch_total", "Amount of requests whose $status differs from the $upstream_status of the final upstream attempt, e.g. because error_page replaced it", labels)
+
+	m.responseSeconds = summary("http_response_time_seconds", "Time needed by nginx to handle requests", labels)
+	m.responseSecondsHist = histogram("http_response_time_seconds_hist", "Time needed by nginx to handle requests", labels, buckets(cfg.ResponseTimeBuckets, cfg.Buckets))
+	m.responseBytes = counter("http_response_bytes", "Amount of response bytes send", labels)
+
+	m.cacheRequests = counter("http_cache_requests_total", "Amount of requests by $upstream_cache_status", append(append([]string{}, labels...), "cache_status"))
+	m.cacheStats = &cacheStats{}
+	if cfg.enabled("http_cache_hit_ratio") {
+		reg.MustRegister(newCacheHitRatio(prefix, rename("http_cache_hit_ratio"), m.cacheStats))
+	}
+
+	m.limitReqRequests = counter("http_limit_req_requests_total", "Amount of requests to locations limited by limit_req by $limit_req_status", append(append([]string{}, labels...), "limit_req_status"))
+	m.limitConnRequests = counter("http_limit_conn_requests_total", "Amount of requests to locations limited by limit_conn by $limit_conn_status", append(append([]string{}, labels...), "limit_conn_status"))
+
+	m.tlsRequests = counter("http_tls_requests_total", "Amount of requests made over TLS by protocol and cipher", []string{"protocol", "cipher"})
+	tlsSessionLabels := []string{"reused"}
+	if cfg.TLSSessionProtocol {
+		tlsSessionLabels = append(tlsSessionLabels, "protocol")
+	}
+	m.tlsSessions = counter("http_tls_sessions_total", "Amount of requests made over TLS by whether their session was reused from $ssl_session_reused, i.e. without a full handshake", tlsSessionLabels)
+
+	m.requestBytes = counter("http_request_bytes_total", "Total amount of received request bytes", labels)
+	if cfg.RequestSizeHist {
+		m.requestBytesHist = valueHistogram("http_request_size_bytes", "Size of requests including request line, header and body", cfg.RequestSizeBuckets)
+	}
+	if cfg.ResponseSizeHist {
+		m.responseBytesHist = valueHistogram("http_response_size_bytes", "Size of response bodies sent to the client", cfg.ResponseSizeBuckets)
+	}
+
+	m.gzipRatio = valueHistogram("http_gzip_ratio", "Compression ratio of gzip compressed responses", []float64{1, 1.5, 2, 3, 4, 5, 6, 8, 10, 15})
+	m.uncompressed = counter("http_uncompressed_responses_total", "Amount of responses which were not gzip compressed", labels)
+
+	if cfg.GeoIP.Database != "" {
+		geoLabels := []string{"country"}
+		if cfg.GeoIP.City {
+			geoLabels = append(geoLabels, "city")
+		}
+		m.geoRequests = counter("http_requests_by_geo_total", "Amount of requests by location of the client", geoLabels)
+	}
+
+	if cfg.GeoIP.ASNDatabase != "" {
+		m.asnRequests = counter("http_requests_by_asn_total", "Amount of requests by autonomous system of the client", []string{"asn", "organization"})
+	}
+
+	if cfg.UserAgentMetrics {
+		m.userAgentRequests = counter("http_requests_by_user_agent_total", "Amount of requests by browser, operating system and device type of the client", []string{"browser_family", "os_family", "device_type"})
+	}
+
+	if cfg.ApdexTarget > 0 {
+		m.apdexRequests = counter("http_apdex_requests_total", "Amount of requests by Apdex zone, which is satisfied, tolerating or frustrated", append(append([]string{}, labels...), "zone"))
+		if m.apdexRequests != nil && cfg.enabled("http_apdex_score") {
+			reg.MustRegister(newApdexScore(prefix, rename("http_apdex_score"), labels, m.apdexRequests.vec))
+		}
+	}
+
+	if cfg.RefererMetrics {
+		m.refererRequests = counter("http_requests_by_referer_total", "Amount of requests by registrable domain of the referrer", []string{"domain"})
+		m.refererDomains = newRefererDomains(cfg.RefererTop, cfg.RefererInternal)
+	}
+
+	if cfg.UniqueClients && cfg.enabled("http_unique_clients_estimate") {
+		m.uniqueClients = newUniqueClients(prefix, rename("http_unique_clients_estimate"), cfg.UniqueClientsWindows)
+		reg.MustRegister(m.uniqueClients)
+	}
+
+	if cfg.TopPaths > 0 && cfg.enabled("http_top_paths") {
+		m.topPaths = newTopPaths(prefix, rename("http_top_paths"), cfg.TopPaths, cfg.TopPathsDecay)
+		reg.MustRegister(m.topPaths)
+	}
+
+	m.lastRequest = &newestTimestamp{}
+	if cfg.enabled("http_last_request_timestamp_seconds") {
+		reg.MustRegister(newLastRequestTimestamp(prefix, rename("http_last_request_timestamp_seconds"), m.lastRequest))
+	}
+
+	m.parseErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: prefix,
+		Name:      rename("parse_errors_total"),
+		Help:      "Total numbers of log file lines that could not be parsed",
+	})
+	if cfg.enabled("parse_errors_total") {
+		reg.MustRegister(m.parseErrorsTotal)
+	}
+}
+
+// expireSeries periodically removes all series which have not been observed
+// within ttl until ctx is done
+func (m *Metrics) expireSeries(ctx context.Context, ttl time.Duration) {
+	interval := ttl / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, e := range m.expirable {
+				e.expire(now)
+			}
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package exporter
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/geoip"
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ua-parser/uap-go/uaparser"
+)
+
+// namespace bundles everything needed to process the log files of a
+// configured namespace
+type namespace struct {
+	config        NamespaceConfig
+	metricsConfig MetricsConfig
+	labels        []string
+	parser        LineParser
+	metrics       *Metrics
+	collectors    *collectorSet
+	geoip         *geoip.DB
+	asn           *geoip.DB
+	userAgents    *uaparser.Parser
+	bots          *botClassifier
+	anonymizer    *anonymizer
+	errorLog      *errorLogMetrics
+	slos          *sloMetrics
+	positions     *tail.Positions
+	poll          bool
+	parseErrors   *parseErrors
+	recentEntries *recentEntries
+	statsd        *statsdClient
+	loki          *lokiClient
+	timings       *stageTimings
+	analysis      *analysis
+	health        *inputHealth
+	telemetry     *telemetry
+	inputs        *inputSet
+	// relabelDropped counts the lines dropped by relabeling rules
+	relabelDropped prometheus.Counter
+	// fail stops the exporter with the error of an input
+	fail      func(error)
+	lineCount uint64
+}
+
+// sampled counts a line of ns and reports whether its values are observed
+// with the configured sample rate
+func (ns *namespace) sampled() bool {
+	n := atomic.AddUint64(&ns.lineCount, 1)
+	return ns.metricsConfig.SampleRate <= 1 || n%uint64(ns.metricsConfig.SampleRate) == 0
+}
+
+// input describes where ns reads its lines from, which is the name used as
+// file label of inputs which are no files
+func (ns *namespace) input() string {
+	switch {
+	case ns.config.SyslogListen != "":
+		return "syslog:" + ns.config.SyslogListen
+	case ns.config.ForwardListen != "":
+		return "forward:" + ns.config.ForwardListen
+	case len(ns.config.Kafka.Brokers) > 0:
+		return "kafka:" + ns.config.Kafka.Topic
+	case ns.config.Journald.Enabled:
+		return "journald"
+	}
+	return ns.config.FileName
+}
+
+// followerConfig returns the configuration for following the files of ns
+func (ns *namespace) followerConfig() tail.FollowerConfig {
+	return tail.FollowerConfig{
+		Positions:     ns.positions,
+		FromBeginning: ns.config.FromBeginning,
+		Poll:          ns.poll,
+		OnReopen: func(reason string) {
+			ns.telemetry.fileReopens.WithLabelValues(ns.config.Name, reason).Inc()
+		},
+	}
+}
+
+// newNamespaces creates the configured namespaces of e and their metrics
+// without starting them
+func (e *Exporter) newNamespaces() error {
+	cfg := e.config
+
+	geoDB, err := openGeoIPDatabase(cfg.MetricsConfig.GeoIP.Database, cfg.MetricsConfig.GeoIP.ReloadInterval)
+	if err != nil {
+		return err
+	}
+
+	asnDB, err := openGeoIPDatabase(cfg.MetricsConfig.GeoIP.ASNDatabase, cfg.MetricsConfig.GeoIP.ReloadInterval)
+	if err != nil {
+		return err
+	}
+
+	var userAgents *uaparser.Parser
+	if cfg.MetricsConfig.UserAgentMetrics {
+		userAgents, err = uaparser.New()
+		if err != nil {
+			return err
+		}
+	}
+
+	bots, err := newBotClassifier(cfg.MetricsConfig.BotPatterns)
+	if err != nil {
+		return err
+	}
+
+	anon, err := newAnonymizer(cfg.Anonymize)
+	if err != nil {
+		return err
+	}
+
+	configs, groups, err := namespaceConfigs(cfg)
+	if err != nil {
+		return err
+	}
+	e.groups = groups
+
+	for _, nc := range configs {
+		var matched func(format int)
+		if len(nc.FallbackFormats) > 0 {
+			// The series of all formats exist before the first line
+			matches := make([]prometheus.Counter, len(nc.FallbackFormats)+1)
+			for i := range matches {
+				matches[i] = e.telemetry.formatMatches.WithLabelValues(nc.Name, strconv.Itoa(i))
+			}
+			matched = func(format int) {
+				matches[format].Inc()
+			}
+		}
+
+		parser, err := newParser(nc.LogConfig, nc.Format, matched)
+		if err != nil {
+			return err
+		}
+		if sp, ok := parser.(*scanParser); ok {
+			sp.restrict(usedFields(nc, cfg.Loki))
+		}
+
+		ns := &namespace{
+			config:        nc,
+			metricsConfig: cfg.MetricsConfig,
+			labels:        metricLabels(nc),
+			parser:        parser,
+			metrics:       &Metrics{},
+			collectors:    &collectorSet{},
+			geoip:         geoDB,
+			asn:           asnDB,
+			userAgents:    userAgents,
+			bots:          bots,
+			anonymizer:    anon,
+			positions:     e.positions,
+			poll:          cfg.Tail.Poll,
+			parseErrors:   &parseErrors{limit: cfg.DebugEntries},
+			recentEntries: newRecentEntries(cfg.DebugEntries),
+			health:        newInputHealth(),
+			telemetry:     e.telemetry,
+			inputs:        e.inputs,
+			fail:          e.fail,
+
+			relabelDropped: e.telemetry.relabelDropped.WithLabelValues(nc.Name),
+		}
+		e.collectors.MustRegister(ns.collectors)
+		ns.metrics.Init(nc.Name, ns.labels, cfg.MetricsConfig, nc.MetricRenames, ns.collectors, e.telemetry.seriesLimitHits)
+
+		if len(nc.SLOs) > 0 {
+			ns.slos = newSLOMetrics(cfg.MetricsConfig.prefix(nc.Name), nc.SLOs, ns.collectors)
+		}
+
+		if nc.ErrorLogFile != "" {
+			ns.errorLog = newErrorLogMetrics(cfg.MetricsConfig.prefix(nc.Name), ns.collectors)
+		}
+
+		e.namespaces = append(e.namespaces, ns)
+	}
+
+	return nil
+}
+
+// openGeoIPDatabase opens the GeoIP database at path and reloads it in the
+// given interval. It returns nil if path is empty.
+func openGeoIPDatabase(path string, reloadInterval time.Duration) (*geoip.DB, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	db, err := geoip.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	go db.ReloadEvery(reloadInterval, func(err error) {
+		slog.Error("Error while reloading GeoIP database", "file", path, "err", err)
+	})
+
+	return db, nil
+}
+
+// startNamespace starts following the log file or, for glob patterns, all
+// matching log files of ns, or receiving its lines from the configured input.
+// The error log of ns is followed in addition if configured.
+func startNamespace(ns *namespace) error {
+	if ns.config.ErrorLogFile != "" {
+		if err := startErrorLog(ns); err != nil {
+			return err
+		}
+	}
+
+	// Fields of single files are added regardless of the selectors
+	fields, _ := ns.config.Kubernetes.fileFields(ns.config.FileName)
+
+	if ns.config.SyslogListen != "" {
+		l, err := tail.NewSyslogListener(ns.config.SyslogListen)
+		if err != nil {
+			return err
+		}
+
+		l.OnError(ns.fail)
+
+		slog.Info("Listening for syslog messages", "namespace", ns.config.Name, "address", ns.config.SyslogListen)
+		startInput(ns, ns.input(), l, fields)
+	} else if ns.config.ForwardListen != "" {
+		l, err := tail.NewForwardListener(ns.config.ForwardListen, ns.config.ForwardMessageKey)
+		if err != nil {
+			return err
+		}
+
+		l.OnError(ns.fail)
+
+		slog.Info("Listening for forward protocol events", "namespace", ns.config.Name, "address", ns.config.ForwardListen)
+		startInput(ns, ns.input(), l, fields)
+	} else if len(ns.config.Kafka.Brokers) > 0 {
+		t, err := tail.NewKafkaConsumer(ns.config.Kafka.kafkaConfig())
+		if err != nil {
+			return err
+		}
+
+		t.OnError(ns.fail)
+
+		slog.Info("Consuming Kafka topic", "namespace", ns.config.Name, "topic", ns.config.Kafka.Topic)
+		startInput(ns, ns.input(), t, fields)
+	} else if ns.config.Journald.Enabled {
+		t, err := tail.NewJournalFollower(ns.config.Journald.journalConfig())
+		if err != nil {
+			return err
+		}
+
+		t.OnError(ns.fail)
+
+		slog.Info("Following the systemd journal", "namespace", ns.config.Name)
+		startInput(ns, ns.input(), t, fields)
+	} else if ns.config.FileName == stdinFileName {
+		t := tail.NewReaderFollower(os.Stdin)
+
+		t.OnError(ns.fail)
+
+		startInput(ns, stdinFileName, t, fields)
+	} else if tail.HasMeta(ns.config.FileName) {
+		d, err := tail.NewDiscoverer(ns.config.FileName)
+		if err != nil {
+			return err
+		}
+
+		d.OnError(ns.fail)
+
+		ns.health.attach()
+		go followLogFiles(ns, d)
+	} else {
+		go followLogFile(ns, fields)
+	}
+	return nil
+}
+
+// followLogFiles starts a follower for every file discovered by d and stops
+// it again as soon as the file disappears
+func followLogFiles(ns *namespace, d tail.Discoverer) {
+	followers := make(map[string]tail.Follower)
+
+	for ev := range d.Files() {
+		switch ev.Op {
+		case tail.FileCreated:
+			fields, ok := ns.config.Kubernetes.fileFields(ev.Name)
+			if !ok {
+				continue
+			}
+
+			// Files created after the start are read completely
+			config := ns.followerConfig()
+			if !ev.Existing {
+				config.FromBeginning = true
+			}
+
+			t, err := tail.NewFollower(ev.Name, config)
+			if err != nil {
+				slog.Error("Error while following file", "file", ev.Name, "err", err)
+				continue
+			}
+
+			name := ev.Name
+			t.OnError(func(err error) {
+				slog.Error("Error while following file", "file", name, "err", err)
+				ns.health.fail(name, err)
+			})
+
+			slog.Info("Following file", "namespace", ns.config.Name, "file", ev.Name)
+			followers[ev.Name] = t
+			ns.telemetry.tailLags.add(ns.config.Name, ev.Name, t)
+			startInput(ns, ev.Name, t, fields)
+
+		case tail.FileRemoved:
+			if t, ok := followers[ev.Name]; ok {
+				slog.Info("Stopped following file", "namespace", ns.config.Name, "file", ev.Name)
+				ns.telemetry.tailLags.remove(t)
+				ns.telemetry.pipelines.remove(t)
+				t.Stop()
+				delete(followers, ev.Name)
+				ns.health.forget(ev.Name)
+			}
+		}
+	}
+}
+
+// processLogFile updates the metrics of ns with every line emitted by t,
+// which follows file. fields are added to the entry of every line. Lines are
+// parsed by the parse workers of ns, the metrics are updated in the calling
+// goroutine. Lines are only dropped with drop set, files which are replayed
+// are read as fast as the pipeline allows and must not lose lines.
+func processLogFile(ns *namespace, file string, t tail.Follower, fields map[string]string, drop bool) {
+	if !ns.inputs.add(t) {
+		t.Stop()
+		return
+	}
+	defer ns.inputs.done(t)
+
+	ns.health.attach()
+
+	lastProcessed := ns.telemetry.lastProcessed.WithLabelValues(ns.config.Name, file)
+	for line := range parseLines(ns, file, t, drop) {
+		start := ns.timings.start()
+		processLine(ns, line, fields)
+		ns.timings.processed(start)
+		ns.health.lineProcessed()
+		lastProcessed.SetToCurrentTime()
+	}
+}
+
+// processLine updates the metrics of ns with a parsed line
+func processLine(ns *namespace, line parsedLine, fields map[string]string) {
+	metrics := ns.metrics
+
+	// The entry is kept for /debug/entries only once it is no longer read
+	record := false
+	defer func() {
+		if record {
+			ns.recentEntries.record(line.fields, line.reused)
+		} else {
+			line.reused.release()
+		}
+	}()
+
+	entry, err := line.entry, line.err
+	if err == errSkipLine {
+		return
+	}
+	if err != nil {
+		metrics.parseErrorsTotal.Inc()
+		ns.analysis.parseError()
+		ns.parseErrors.record(ns.config.Name, ns.anonymizer.text(line.text), ns.anonymizer.text(err.Error()))
+		return
+	}
+
+	for name, value := range fields {
+		entry.SetField(name, value)
+	}
+
+	if ns.skip(entry) || ns.tooOld(entry) {
+		return
+	}
+
+	// Locations are looked up and clients counted with the addresses before
+	// they are anonymized, which would merge the clients of a network
+	ip := clientIP(entry, ns.metricsConfig.GeoIP.ForwardedFor)
+	client, _ := entry.Field("remote_addr")
+	ns.anonymizer.anonymize(entry)
+	record = true
+	ns.loki.forward(ns, ns.anonymizer.text(line.text), entry, line.fields)
+
+	labelValues, ok := entryLabelValues(ns, entry)
+	if !ok {
+		ns.relabelDropped.Inc()
+		return
+	}
+
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		slog.Debug("Parsed line", "namespace", ns.config.Name, "line", ns.anonymizer.text(line.text))
+	}
+
+	metrics.countTotal.add(labelValues, 1)
+	ns.analysis.add(ns, entry)
+
+	if bytes, err := entry.FloatField("body_bytes_sent"); err == nil {
+		metrics.bytesTotal.add(labelValues, bytes)
+	}
+
+	sampled := ns.sampled()
+	ns.statsd.request(ns, entry, labelValues, sampled)
+
+	if bytes, err := entry.FloatField("body_bytes_sent"); err == nil && sampled {
+		metrics.responseBytesHist.observe(labelValues, bytes, nil)
+	}
+
+	if requestLength, err := entry.FloatField("request_length"); err == nil {
+		metrics.requestBytes.add(labelValues, requestLength)
+		if sampled {
+			metrics.requestBytesHist.observe(labelValues, requestLength, nil)
+		}
+	}
+
+	if gzipRatio, err := entry.Field("gzip_ratio"); err == nil {
+		if ratio, err := strconv.ParseFloat(gzipRatio, 64); err == nil {
+			if sampled {
+				metrics.gzipRatio.observe(labelValues, ratio, nil)
+			}
+		} else {
+			metrics.uncompressed.add(labelValues, 1)
+		}
+	}
+
+	exemplar := entryExemplar(entry, ns.config.ExemplarField)
+
+	upstreamLabelValues := labelValues
+	if ns.metricsConfig.UpstreamAddrLabel {
+		upstreamLabelValues = append(append([]string{}, labelValues...), upstreamAddr(entry))
+	}
+
+	if upstreamBytes, ok := upstreamSum(entry, "upstream_bytes_received"); ok {
+		metrics.upstreamBytes.add(upstreamLabelValues, upstreamBytes)
+	}
+
+	observeUpstreamTimes(ns, entry, labelValues, upstreamLabelValues, exemplar, sampled)
+	observeUpstreamStatus(ns, entry, labelValues)
+	observeCacheStatus(metrics, entry, labelValues)
+	observeLimitStatus(metrics, entry, labelValues)
+	observeApdex(ns, entry, labelValues)
+	ns.slos.observe(ns, entry)
+	observeTLS(metrics, entry)
+	observeTLSSession(ns, entry)
+	observeGeo(ns, ip)
+	observeClient(metrics, client)
+	observeTopPaths(ns, entry)
+	observeUserAgent(ns, entry)
+	observeReferer(ns, entry)
+
+	if responseTime, err := entry.FloatField("request_time"); err == nil && sampled {
+		metrics.responseSeconds.observe(labelValues, responseTime, nil)
+		metrics.responseSecondsHist.observe(labelValues, responseTime, exemplar)
+	}
+}
@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxParseErrorSamples is the default number of recent unparsable lines
+// kept per namespace
+const maxParseErrorSamples = 20
+
+// parseErrorLogInterval is the minimum interval between two parse errors
+// logged for a namespace, errors in between are only counted
+const parseErrorLogInterval = 10 * time.Second
+
+// parseError is a line which could not be parsed
+type parseError struct {
+	Time  time.Time `json:"time"`
+	Line  string    `json:"line"`
+	Error string    `json:"error"`
+}
+
+// parseErrors keeps the most recent parse errors of a namespace and rate
+// limits logging them. limit is the number of errors kept, without a limit
+// maxParseErrorSamples are.
+type parseErrors struct {
+	mu         sync.Mutex
+	limit      int
+	samples    []parseError
+	next       int
+	lastLog    time.Time
+	suppressed int
+}
+
+// record adds the parse error msg of line of namespace, which must both
+// already be anonymized, and logs it unless another error has been logged within the
+// log interval
+func (p *parseErrors) record(namespace, line, msg string) {
+	now := time.Now()
+	sample := parseError{Time: now, Line: line, Error: msg}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if limit := p.size(); len(p.samples) < limit {
+		p.samples = append(p.samples, sample)
+	} else {
+		p.samples[p.next] = sample
+		p.next = (p.next + 1) % limit
+	}
+
+	if now.Sub(p.lastLog) < parseErrorLogInterval {
+		p.suppressed++
+		return
+	}
+
+	if p.suppressed > 0 {
+		slog.Warn("Error while parsing line", "namespace", namespace, "line", line, "err", msg, "suppressed", p.suppressed)
+	} else {
+		slog.Warn("Error while parsing line", "namespace", namespace, "line", line, "err", msg)
+	}
+
+	p.lastLog = now
+	p.suppressed = 0
+}
+
+// size returns the number of parse errors kept
+func (p *parseErrors) size() int {
+	if p.limit <= 0 {
+		return maxParseErrorSamples
+	}
+	return p.limit
+}
+
+// recent returns the kept parse errors from the oldest to the newest
+func (p *parseErrors) recent() []parseError {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append(append([]parseError{}, p.samples[p.next:]...), p.samples[:p.next]...)
+}
+
+// ParseErrorsHandler serves the recent parse errors of all namespaces as
+// JSON object keyed by namespace
+func (e *Exporter) ParseErrorsHandler() http.Handler {
+	namespaces := e.namespaces
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errors := make(map[string][]parseError, len(namespaces))
+		for _, ns := range namespaces {
+			errors[ns.config.Name] = ns.parseErrors.recent()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(errors)
+	})
+}
@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// LineParser describes an object that turns a single log line into the
+// fields of an entry. The fields are kept as they are for /debug/entries,
+// as gonx has no accessor for the fields of an entry.
+type LineParser interface {
+	ParseFields(line string) (gonx.Fields, error)
+}
+
+// errSkipLine is returned by parsers for lines which are no access log lines
+// and are skipped without counting a parse error
+var errSkipLine = errors.New("line skipped")
+
+// jsonParser parses log lines written with log_format escape=json
+type jsonParser struct {
+	fields map[string]string
+}
+
+// dockerParser unwraps the lines of Docker json-file logs before they are
+// parsed by the inner parser
+type dockerParser struct {
+	inner LineParser
+}
+
+// dockerLine is a line of a Docker json-file log
+type dockerLine struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time,omitempty"`
+}
+
+// criParser unwraps the lines of container logs written by CRI runtimes
+// like containerd before they are parsed by the inner parser
+type criParser struct {
+	inner LineParser
+}
+
+// formatAdapter creates the LineParser of a format type from the
+// configuration and the resolved log format. Adapters of other servers map
+// their fields to the nginx variables feeding the metrics, so that all
+// servers share the same metrics.
+type formatAdapter func(c LogConfig, format string) (LineParser, error)
+
+// formatAdapters maps the format types to their adapters
+var formatAdapters = map[string]formatAdapter{
+	"text":    newTextParser,
+	"json":    func(c LogConfig, format string) (LineParser, error) { return &jsonParser{fields: c.JSONFields}, nil },
+	"ltsv":    func(c LogConfig, format string) (LineParser, error) { return &ltsvParser{fields: c.JSONFields}, nil },
+	"apache":  newApacheParser,
+	"caddy":   func(c LogConfig, format string) (LineParser, error) { return &caddyParser{}, nil },
+	"traefik": newTraefikParser,
+}
+
+// multiParser parses lines with the first of several formats they match
+type multiParser struct {
+	parsers []LineParser
+	// matched is called with the index of the format which matched
+	matched func(format int)
+}
+
+// newParser creates the LineParser for the configured format type and
+// envelope. Lines of text logs not matching format are parsed with the
+// fallback formats, matched is called with the index of the format which
+// matched a line, 0 for format.
+func newParser(c LogConfig, format string, matched func(format int)) (LineParser, error) {
+	formatType := c.FormatType
+	if formatType == "" {
+		formatType = "text"
+	}
+
+	adapter, ok := formatAdapters[formatType]
+	if !ok {
+		return nil, fmt.Errorf("unknown format type '%s'", c.FormatType)
+	}
+	p, err := adapter(c, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if formatType == "text" && len(c.FallbackFormats) > 0 {
+		mp := &multiParser{parsers: []LineParser{p}, matched: matched}
+		for _, f := range c.FallbackFormats {
+			fp, err := newTextParser(c, f)
+			if err != nil {
+				return nil, err
+			}
+			mp.parsers = append(mp.parsers, fp)
+		}
+		p = mp
+	}
+
+	switch c.Envelope {
+	case "", "none":
+		return p, nil
+	case "docker":
+		return &dockerParser{inner: p}, nil
+	case "cri":
+		return &criParser{inner: p}, nil
+	default:
+		return nil, fmt.Errorf("unknown envelope '%s'", c.Envelope)
+	}
+}
+
+// newTextParser creates the parser of log_format lines, which is the
+// configured parser, or the parser detecting the format for the format auto
+func newTextParser(c LogConfig, format string) (LineParser, error) {
+	if format == autoFormat {
+		return newAutoParser(c)
+	}
+	if c.Parser == "scanner" {
+		return newScanParser(format)
+	}
+	return newRegexParser(format), nil
+}
+
+// ParseFields parses line with the first format it matches. The error of
+// the first format is returned if line matches none of them.
+func (p *multiParser) ParseFields(line string) (gonx.Fields, error) {
+	var firstErr error
+	for i, parser := range p.parsers {
+		fields, err := parser.ParseFields(line)
+		if err == nil {
+			if p.matched != nil {
+				p.matched(i)
+			}
+			return fields, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// ParseFields parses the log line wrapped in a Docker json-file log line.
+// Lines written to stderr, like the nginx error log, are skipped. Lines
+// split into several records are joined by the dockerJoiner before.
+func (p *dockerParser) ParseFields(line string) (gonx.Fields, error) {
+	var l dockerLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return nil, err
+	}
+
+	if l.Stream == "stderr" {
+		return nil, errSkipLine
+	}
+
+	return p.inner.ParseFields(strings.TrimRight(l.Log, "\r\n"))
+}
+
+// ParseFields extracts all top level keys of a JSON object as entry fields.
+// Keys are renamed according to the configured field mapping, so e.g. a key
+// "duration" can feed the request_time metrics.
+func (p *jsonParser) ParseFields(line string) (gonx.Fields, error) {
+	var values map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewBufferString(line))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	fields := make(gonx.Fields, len(values))
+	for key, value := range values {
+		name := key
+		if mapped, ok := p.fields[key]; ok {
+			name = mapped
+		}
+
+		switch v := value.(type) {
+		case string:
+			fields[name] = v
+		case json.Number:
+			fields[name] = v.String()
+		case bool:
+			fields[name] = strconv.FormatBool(v)
+		}
+	}
+
+	return fields, nil
+}
+
+// ParseFields parses the log line wrapped in a CRI log line, which has the
+// form <time> <stream> <tag> <line>. Lines written to stderr are skipped.
+// Partial lines are joined by the criJoiner before.
+func (p *criParser) ParseFields(line string) (gonx.Fields, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid CRI log line")
+	}
+	if criPartial(parts[2]) {
+		return nil, fmt.Errorf("partial CRI log line")
+	}
+
+	if parts[1] == "stderr" {
+		return nil, errSkipLine
+	}
+
+	return p.inner.ParseFields(parts[3])
+}
@@ -0,0 +1,141 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+// combinedLine is a line of the combined format preset
+const combinedLine = `1.2.3.4 - bob [15/Oct/2026:10:00:00 +0000] "GET /a?b=1 HTTP/1.1" 200 612 "https://example.com/" "curl/8.0"`
+
+// combinedFields are the fields of combinedLine
+var combinedFields = gonx.Fields{
+	"remote_addr":     "1.2.3.4",
+	"remote_user":     "bob",
+	"time_local":      "15/Oct/2026:10:00:00 +0000",
+	"request":         "GET /a?b=1 HTTP/1.1",
+	"status":          "200",
+	"body_bytes_sent": "612",
+	"http_referer":    "https://example.com/",
+	"http_user_agent": "curl/8.0",
+}
+
+// parseTest is a line parsed by the parser of config. Without want the line
+// is expected to fail, or to be skipped with skip.
+type parseTest struct {
+	name   string
+	config LogConfig
+	line   string
+	want   gonx.Fields
+	skip   bool
+}
+
+func testParseFields(t *testing.T, tests []parseTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		format, err := resolveFormat(test.config, false)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		p, err := newParser(test.config, format, nil)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		fields, err := p.ParseFields(test.line)
+		switch {
+		case test.skip:
+			if err != errSkipLine {
+				t.Errorf("%s: line not skipped, error %v", test.name, err)
+			}
+		case test.want == nil:
+			if err == nil || err == errSkipLine {
+				t.Errorf("%s: line parsed, error %v", test.name, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %s", test.name, err)
+		case !reflect.DeepEqual(fields, test.want):
+			t.Errorf("%s: fields %v, want %v", test.name, fields, test.want)
+		}
+	}
+}
+
+func TestJSONParser(t *testing.T) {
+	testParseFields(t, []parseTest{
+		{
+			name:   "json",
+			config: LogConfig{FormatType: "json"},
+			line:   `{"remote_addr":"1.2.3.4","status":200,"request_time":0.012,"ssl":true,"upstream":null,"hops":["a"]}`,
+			want: gonx.Fields{
+				"remote_addr":  "1.2.3.4",
+				"status":       "200",
+				"request_time": "0.012",
+				"ssl":          "true",
+			},
+		},
+		{
+			name:   "json with field mapping",
+			config: LogConfig{FormatType: "json", JSONFields: map[string]string{"duration": "request_time", "code": "status"}},
+			line:   `{"duration":1.5e-3,"code":"404","path":"/a"}`,
+			want: gonx.Fields{
+				"request_time": "1.5e-3",
+				"status":       "404",
+				"path":         "/a",
+			},
+		},
+		{
+			name:   "invalid json",
+			config: LogConfig{FormatType: "json"},
+			line:   `{"status":`,
+		},
+	})
+}
+
+func TestEnvelopeParsers(t *testing.T) {
+	testParseFields(t, []parseTest{
+		{
+			name:   "docker",
+			config: LogConfig{Preset: "combined", Envelope: "docker"},
+			line:   `{"log":"1.2.3.4 - bob [15/Oct/2026:10:00:00 +0000] \"GET /a?b=1 HTTP/1.1\" 200 612 \"https://example.com/\" \"curl/8.0\"\r\n","stream":"stdout","time":"2026-10-15T10:00:00.123456789Z"}`,
+			want:   combinedFields,
+		},
+		{
+			name:   "docker stderr",
+			config: LogConfig{Preset: "combined", Envelope: "docker"},
+			line:   `{"log":"2026/10/15 10:00:00 [error] 1#1: open() failed\n","stream":"stderr","time":"2026-10-15T10:00:00Z"}`,
+			skip:   true,
+		},
+		{
+			name:   "docker without json",
+			config: LogConfig{Preset: "combined", Envelope: "docker"},
+			line:   combinedLine,
+		},
+		{
+			name:   "cri",
+			config: LogConfig{Preset: "combined", Envelope: "cri"},
+			line:   "2026-10-15T10:00:00.123456789Z stdout F " + combinedLine,
+			want:   combinedFields,
+		},
+		{
+			name:   "cri stderr",
+			config: LogConfig{Preset: "combined", Envelope: "cri"},
+			line:   "2026-10-15T10:00:00.123456789Z stderr F 2026/10/15 10:00:00 [error] 1#1: open() failed",
+			skip:   true,
+		},
+		{
+			name:   "cri partial",
+			config: LogConfig{Preset: "combined", Envelope: "cri"},
+			line:   "2026-10-15T10:00:00.123456789Z stdout P " + combinedLine,
+		},
+		{
+			name:   "cri without tag",
+			config: LogConfig{Preset: "combined", Envelope: "cri"},
+			line:   "2026-10-15T10:00:00.123456789Z stdout",
+		},
+	})
+}
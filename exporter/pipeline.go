@@ -0,0 +1,162 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipeline is the state of the processing of a followed input
+type pipeline struct {
+	namespace string
+	file      string
+	// lagger is nil for inputs which are no regular files
+	lagger  tail.Lagger
+	running bool
+
+	// offset is the read offset seen on the last scrape, progressed the
+	// last time the offset advanced or the file was read completely
+	offset     int64
+	progressed time.Time
+}
+
+// up tells whether p is running and, for regular files, reading the file
+// at now. A file with unread bytes whose read offset did not advance for
+// stallTimeout is stalled.
+func (p *pipeline) up(now time.Time, stallTimeout time.Duration) bool {
+	if !p.running {
+		return false
+	}
+	if p.lagger == nil {
+		return true
+	}
+
+	offset, err := p.lagger.Offset()
+	if err != nil {
+		return true
+	}
+	lag, err := p.lagger.Lag()
+	if err != nil {
+		return true
+	}
+
+	if offset != p.offset || lag <= 0 {
+		p.offset, p.progressed = offset, now
+	}
+	return stallTimeout <= 0 || now.Sub(p.progressed) < stallTimeout
+}
+
+// pipelineCollector reports whether the pipelines of all followed inputs
+// are up on every scrape
+type pipelineCollector struct {
+	mu           sync.Mutex
+	pipelines    map[tail.Follower]*pipeline
+	stallTimeout time.Duration
+	desc         *prometheus.Desc
+}
+
+func newPipelineCollector(stallTimeout time.Duration) *pipelineCollector {
+	return &pipelineCollector{
+		pipelines:    make(map[tail.Follower]*pipeline),
+		stallTimeout: stallTimeout,
+		desc: prometheus.NewDesc(
+			"nginx_exporter_pipeline_up",
+			"Whether the lines of a log file or input are read and processed, 0 once its follower stopped or a file with unread bytes has not been read for --tail.stall-timeout",
+			[]string{"namespace", "file"}, nil,
+		),
+	}
+}
+
+// add reports the pipeline of t, which follows file of namespace, as up
+func (c *pipelineCollector) add(namespace, file string, t tail.Follower) {
+	lagger, _ := t.(tail.Lagger)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pipelines[t] = &pipeline{
+		namespace:  namespace,
+		file:       file,
+		lagger:     lagger,
+		running:    true,
+		offset:     -1,
+		progressed: time.Now(),
+	}
+}
+
+// stopped reports the pipeline of t as down, as its follower stopped. If t
+// was removed already, as its file disappeared, forget is called unless file
+// of namespace is followed again by now.
+func (c *pipelineCollector) stopped(t tail.Follower, namespace, file string, forget func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.pipelines[t]; ok {
+		p.running = false
+		return
+	}
+
+	for _, p := range c.pipelines {
+		if p.namespace == namespace && p.file == file {
+			return
+		}
+	}
+	forget()
+}
+
+// remove stops reporting the pipeline of t, which is no longer followed
+func (c *pipelineCollector) remove(t tail.Follower) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pipelines, t)
+}
+
+func (c *pipelineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *pipelineCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range c.pipelines {
+		up := 0.0
+		if p.up(now, c.stallTimeout) {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, up, p.namespace, p.file)
+	}
+}
+
+// startInput reports the pipeline of t, which follows the input file of ns,
+// as up and processes its lines in a new goroutine. The pipeline is added
+// before, so a follower removed right away is not reported forever.
+func startInput(ns *namespace, file string, t tail.Follower, fields map[string]string) {
+	ns.telemetry.pipelines.add(ns.config.Name, file, t)
+	go processInput(ns, file, t, fields)
+}
+
+// processInput processes the lines of t, whose pipeline was added already,
+// and reports its pipeline as down once t stopped unexpectedly. Unlike
+// processLogFile, which replays files as well, it is used for the inputs
+// which are followed until the exporter shuts down, whose lines are dropped
+// with DropLines set.
+func processInput(ns *namespace, file string, t tail.Follower, fields map[string]string) {
+	processLogFile(ns, file, t, fields, ns.config.DropLines)
+
+	// Followers are stopped on shutdown, which is no failure
+	if ns.inputs.shuttingDown() {
+		ns.telemetry.pipelines.remove(t)
+		return
+	}
+
+	// The file of a removed follower disappeared, its series are only
+	// deleted now as processLogFile updates them until it returns
+	ns.telemetry.pipelines.stopped(t, ns.config.Name, file, func() {
+		ns.telemetry.forget(ns.config.Name, file)
+	})
+}
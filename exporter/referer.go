@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satyrius/gonx"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// refererDecay is the time constant of the ranking of referrer domains
+	refererDecay = time.Hour
+
+	// refererRefresh is the interval in which the labeled domains are
+	// updated from the ranking
+	refererRefresh = 10 * time.Second
+)
+
+// refererDomains decides which referrer domains are labeled individually,
+// which are the domains with the most recent requests. All other domains
+// are labeled other.
+type refererDomains struct {
+	mu        sync.Mutex
+	ranking   *topK
+	internal  map[string]bool
+	labeled   map[string]bool
+	refreshed time.Time
+}
+
+func newRefererDomains(top int, internal stringList) *refererDomains {
+	r := &refererDomains{
+		ranking:  newTopK(top, refererDecay),
+		internal: make(map[string]bool, len(internal)),
+		labeled:  make(map[string]bool),
+	}
+	for _, d := range internal {
+		r.internal[strings.ToLower(d)] = true
+	}
+	return r
+}
+
+// label returns the domain label of a request from referer to host at now,
+// which is direct for requests without referrer, internal for referrers of
+// the registrable domain of host or an internal domain, the registrable
+// domain of the referrer if it is among the top domains and other otherwise
+func (r *refererDomains) label(referer, host string, now time.Time) string {
+	if referer == "" || referer == "-" {
+		return "direct"
+	}
+
+	domain := registrableDomain(referer)
+	if domain == "" {
+		return "other"
+	}
+	if r.internal[domain] || (host != "" && domain == registrableDomain("//"+host)) {
+		return "internal"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ranking.add(domain, 1, now)
+	if now.Sub(r.refreshed) >= refererRefresh || len(r.labeled) < r.ranking.k {
+		r.labeled = make(map[string]bool, r.ranking.k)
+		for _, item := range r.ranking.top(now) {
+			r.labeled[item.key] = true
+		}
+		r.refreshed = now
+	}
+
+	if r.labeled[domain] {
+		return domain
+	}
+	return "other"
+}
+
+// registrableDomain returns the lowercased registrable domain of the host of
+// the URL rawURL, like example.co.uk for https://www.example.co.uk/, or the
+// address for hosts which are IP addresses. It returns an empty string if
+// rawURL has no valid host.
+func registrableDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return ""
+	}
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// observeReferer counts the request of entry by the domain of its referrer
+func observeReferer(ns *namespace, entry *gonx.Entry) {
+	if ns.metrics.refererRequests == nil {
+		return
+	}
+
+	referer, err := entry.Field("http_referer")
+	if err != nil {
+		return
+	}
+
+	domain := ns.metrics.refererDomains.label(referer, virtualHost(entry), time.Now())
+	ns.metrics.refererRequests.add([]string{domain}, 1)
+}
@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// regexParser parses text log lines with the regular expression gonx builds
+// for a log_format, a variable extends up to the first character of the
+// literal following it. Unlike gonx.Parser it returns the fields of a line,
+// which gonx keeps to its entries.
+type regexParser struct {
+	regexp *regexp.Regexp
+}
+
+// regexVariable matches the quoted variables of a format and the character
+// following them
+var regexVariable = regexp.MustCompile(`\\\$([a-z_]+)(\\?(.))`)
+
+// newRegexParser compiles format into a regexParser
+func newRegexParser(format string) *regexParser {
+	re := regexVariable.ReplaceAllString(regexp.QuoteMeta(format+" "), "(?P<$1>[^$3]*)$2")
+	return &regexParser{regexp: regexp.MustCompile(fmt.Sprintf("^%v$", strings.Trim(re, " ")))}
+}
+
+// ParseFields parses line into the fields of its entry
+func (p *regexParser) ParseFields(line string) (gonx.Fields, error) {
+	values := p.regexp.FindStringSubmatch(line)
+	if values == nil {
+		return nil, fmt.Errorf("access log line '%v' does not match given format '%v'", line, p.regexp)
+	}
+
+	names := p.regexp.SubexpNames()
+	fields := make(gonx.Fields, len(names)-1)
+	for i, name := range names[1:] {
+		fields[name] = values[i+1]
+	}
+	return fields, nil
+}
@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/denniswinter/nginx-log-exporter/relabel"
+	"github.com/satyrius/gonx"
+)
+
+var (
+	uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexRE  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// RouteConfig maps request paths matching a regular expression to a route
+// name, which may refer to capture groups of the expression
+type RouteConfig struct {
+	Match relabel.Regexp `yaml:"match"`
+	Name  string         `yaml:"name"`
+}
+
+func (c RouteConfig) validate() error {
+	if c.Match.Regexp == nil {
+		return fmt.Errorf("route '%s' has no match expression", c.Name)
+	}
+	if c.Name == "" {
+		return fmt.Errorf("route matching '%s' has no name", c.Match.String())
+	}
+	return nil
+}
+
+// requestPath returns the path of the request of entry without the query
+// string, taken from $request_uri, $uri or the second part of $request
+func requestPath(entry *gonx.Entry) string {
+	path, err := entry.Field("request_uri")
+	if err != nil {
+		path, err = entry.Field("uri")
+	}
+	if err != nil {
+		request, err := entry.Field("request")
+		if err != nil {
+			return ""
+		}
+
+		chunks := strings.Fields(request)
+		if len(chunks) < 2 {
+			return ""
+		}
+		path = chunks[1]
+	}
+
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+// route returns the name of the first route matching path. If no route
+// matches, path is returned with ids replaced by placeholders unless
+// normalization is disabled.
+func route(routes []RouteConfig, path string, normalize bool) string {
+	for _, r := range routes {
+		if indexes := r.Match.FindStringSubmatchIndex(path); indexes != nil {
+			return string(r.Match.ExpandString(nil, r.Name, path, indexes))
+		}
+	}
+
+	if normalize {
+		return normalizePath(path)
+	}
+	return path
+}
+
+// normalizePath replaces path segments which are numeric ids, UUIDs or long
+// hex tokens with the placeholders :id, :uuid and :hex
+func normalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+		case isNumeric(segment):
+			segments[i] = ":id"
+		case uuidRE.MatchString(segment):
+			segments[i] = ":uuid"
+		case hexRE.MatchString(segment):
+			segments[i] = ":hex"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// weightedCollector exposes the histograms and summaries of a collector with
+// every observation counted weight times. With only every weight-th line
+// observed their _count, _sum and buckets still match all lines, while each
+// sampled line is observed only once.
+type weightedCollector struct {
+	prometheus.Collector
+	weight uint64
+}
+
+// weighted returns c with its observations counted weight times, or c
+// itself for a weight of 1
+func weighted(c prometheus.Collector, weight int) prometheus.Collector {
+	if weight <= 1 {
+		return c
+	}
+	return &weightedCollector{Collector: c, weight: uint64(weight)}
+}
+
+func (c *weightedCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		ch <- weightedMetric{Metric: m, weight: c.weight}
+	}
+}
+
+// weightedMetric is a histogram or summary whose counts are multiplied by
+// weight when it is written. Quantiles are left as they are.
+type weightedMetric struct {
+	prometheus.Metric
+	weight uint64
+}
+
+func (m weightedMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+
+	w := m.weight
+	if s := out.Summary; s != nil {
+		s.SampleCount = scaleCount(s.SampleCount, w)
+		s.SampleSum = scaleFloat(s.SampleSum, w)
+	}
+	if h := out.Histogram; h != nil {
+		h.SampleCount = scaleCount(h.SampleCount, w)
+		h.SampleCountFloat = scaleFloat(h.SampleCountFloat, w)
+		h.SampleSum = scaleFloat(h.SampleSum, w)
+		for _, b := range h.Bucket {
+			b.CumulativeCount = scaleCount(b.CumulativeCount, w)
+			b.CumulativeCountFloat = scaleFloat(b.CumulativeCountFloat, w)
+		}
+
+		// Native histograms, whose bucket counts are deltas to the
+		// previous bucket, which scale just like the counts
+		h.ZeroCount = scaleCount(h.ZeroCount, w)
+		h.ZeroCountFloat = scaleFloat(h.ZeroCountFloat, w)
+		for _, deltas := range [][]int64{h.PositiveDelta, h.NegativeDelta} {
+			for i := range deltas {
+				deltas[i] *= int64(w)
+			}
+		}
+		for _, counts := range [][]float64{h.PositiveCount, h.NegativeCount} {
+			for i := range counts {
+				counts[i] *= float64(w)
+			}
+		}
+	}
+	return nil
+}
+
+func scaleCount(v *uint64, w uint64) *uint64 {
+	if v == nil {
+		return nil
+	}
+	scaled := *v * w
+	return &scaled
+}
+
+func scaleFloat(v *float64, w uint64) *float64 {
+	if v == nil {
+		return nil
+	}
+	scaled := *v * float64(w)
+	return &scaled
+}
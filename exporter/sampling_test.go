@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWeighted(t *testing.T) {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "h", Buckets: []float64{1, 2}})
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "s", Objectives: map[float64]float64{0.5: 0.05}})
+	for _, v := range []float64{0.5, 1.5} {
+		histogram.Observe(v)
+		summary.Observe(v)
+	}
+
+	tests := []struct {
+		weight    int
+		count     uint64
+		sum       float64
+		buckets   []uint64
+		quantile  float64
+		collector prometheus.Collector
+	}{
+		{weight: 1, count: 2, sum: 2, buckets: []uint64{1, 2}, collector: histogram},
+		{weight: 10, count: 20, sum: 20, buckets: []uint64{10, 20}, collector: histogram},
+		{weight: 10, count: 20, sum: 20, quantile: 0.5, collector: summary},
+	}
+
+	for _, test := range tests {
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(weighted(test.collector, test.weight))
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := families[0].Metric[0]
+
+		if h := m.Histogram; h != nil {
+			if h.GetSampleCount() != test.count || h.GetSampleSum() != test.sum {
+				t.Errorf("weight %d: histogram count %d and sum %g, want %d and %g", test.weight, h.GetSampleCount(), h.GetSampleSum(), test.count, test.sum)
+			}
+			for i, b := range h.Bucket {
+				if b.GetCumulativeCount() != test.buckets[i] {
+					t.Errorf("weight %d: bucket %g counts %d, want %d", test.weight, b.GetUpperBound(), b.GetCumulativeCount(), test.buckets[i])
+				}
+			}
+		}
+		if s := m.Summary; s != nil {
+			if s.GetSampleCount() != test.count || s.GetSampleSum() != test.sum {
+				t.Errorf("weight %d: summary count %d and sum %g, want %d and %g", test.weight, s.GetSampleCount(), s.GetSampleSum(), test.count, test.sum)
+			}
+			if q := s.Quantile[0].GetValue(); q != test.quantile {
+				t.Errorf("weight %d: median %g, want %g", test.weight, q, test.quantile)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/satyrius/gonx"
+)
+
+// scanParser parses text log lines by scanning them for the literals of the
+// log_format instead of matching a regular expression. Just like with gonx,
+// a variable extends up to the first character of the literal following it,
+// and the last variable of a format without trailing literal up to the end
+// of the line, which must not contain a space then. Besides the entry no
+// memory is allocated per line, the values are substrings of the line.
+// Only the used variables are added to the entry once restricted, and entries
+// parsed with parseReused share their fields maps.
+type scanParser struct {
+	format string
+	// literals[i] precedes fields[i], the last literal trails the format
+	literals []string
+	fields   []string
+	// unused[i] is set if fields[i] is scanned but not added to the entry
+	unused  []bool
+	entries sync.Pool
+}
+
+// scanEntry is an entry parsed by parseReused, whose fields map is reused for
+// another line once it is released
+type scanEntry struct {
+	entry  *gonx.Entry
+	fields gonx.Fields
+	pool   *sync.Pool
+}
+
+// release returns e for reuse. Neither e nor its entry must be used
+// afterwards.
+func (e *scanEntry) release() {
+	if e == nil {
+		return
+	}
+	clear(e.fields)
+	e.pool.Put(e)
+}
+
+// newScanParser compiles format into a scanParser. Variables must be
+// separated by a literal.
+func newScanParser(format string) (*scanParser, error) {
+	p := &scanParser{format: format}
+
+	last := 0
+	for _, m := range formatVariable.FindAllStringIndex(format, -1) {
+		literal, name := format[last:m[0]], format[m[0]+1:m[1]]
+		if literal == "" && len(p.fields) > 0 {
+			return nil, fmt.Errorf("variables $%s and $%s of the format are not separated", p.fields[len(p.fields)-1], name)
+		}
+
+		p.literals = append(p.literals, literal)
+		p.fields = append(p.fields, name)
+		last = m[1]
+	}
+	p.literals = append(p.literals, format[last:])
+	p.unused = make([]bool, len(p.fields))
+
+	return p, nil
+}
+
+// restrict limits the entries to the variables in used, all of them are kept
+// if used is nil. The other variables are still scanned to match the line.
+func (p *scanParser) restrict(used map[string]bool) {
+	if used == nil {
+		return
+	}
+	for i, name := range p.fields {
+		p.unused[i] = !used[name]
+	}
+}
+
+// ParseFields parses line into the fields of an entry
+func (p *scanParser) ParseFields(line string) (gonx.Fields, error) {
+	fields := make(gonx.Fields, len(p.fields))
+	if err := p.scan(line, fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// parseReused parses line into an entry whose fields map is taken from the
+// entries released before
+func (p *scanParser) parseReused(line string) (*scanEntry, error) {
+	e, _ := p.entries.Get().(*scanEntry)
+	if e == nil {
+		fields := make(gonx.Fields, len(p.fields))
+		e = &scanEntry{entry: gonx.NewEntry(fields), fields: fields, pool: &p.entries}
+	}
+
+	if err := p.scan(line, e.fields); err != nil {
+		e.release()
+		return nil, err
+	}
+	return e, nil
+}
+
+// scan adds the variables of line to fields
+func (p *scanParser) scan(line string, fields gonx.Fields) error {
+	if !strings.HasPrefix(line, p.literals[0]) {
+		return p.mismatch(line)
+	}
+	rest := line[len(p.literals[0]):]
+
+	for i, name := range p.fields {
+		literal := p.literals[i+1]
+
+		if literal == "" {
+			// Only the last variable can lack a following literal
+			if strings.IndexByte(rest, ' ') >= 0 {
+				return p.mismatch(line)
+			}
+			if !p.unused[i] {
+				fields[name] = rest
+			}
+			rest = ""
+			break
+		}
+
+		end := strings.IndexByte(rest, literal[0])
+		if end < 0 || !strings.HasPrefix(rest[end:], literal) {
+			return p.mismatch(line)
+		}
+		if !p.unused[i] {
+			fields[name] = rest[:end]
+		}
+		rest = rest[end+len(literal):]
+	}
+
+	if rest != "" {
+		return p.mismatch(line)
+	}
+	return nil
+}
+
+func (p *scanParser) mismatch(line string) error {
+	return fmt.Errorf("access log line '%s' does not match given format '%s'", line, p.format)
+}
+
+// builtinFields are the log variables read for every namespace, by the
+// metrics, the filters, the anonymizer and the derived labels like method
+var builtinFields = []string{
+	"request", "request_method", "request_uri", "uri", "server_protocol",
+	"status", "body_bytes_sent", "request_length", "request_time", "gzip_ratio",
+	"upstream_addr", "upstream_status", "upstream_response_time",
+	"upstream_connect_time", "upstream_header_time", "upstream_bytes_received",
+	"upstream_cache_status", "limit_req_status", "limit_conn_status",
+	"ssl_protocol", "ssl_cipher", "ssl_session_reused",
+	"remote_addr", "realip_remote_addr", "http_x_real_ip", "http_x_forwarded_for",
+	"http_user_agent", "http_referer", "host", "server_name", "http_host",
+	"time_iso8601", "time_local", "msec",
+}
+
+// usedFields returns the log variables read for nc, which are the builtin
+// ones, the labels, the variables of expressions, the source labels of
+// relabeling rules, the exemplar field and the stream labels of Loki. It
+// returns nil if the lines are forwarded to Loki as JSON, which holds all
+// variables.
+func usedFields(nc NamespaceConfig, loki LokiConfig) map[string]bool {
+	if loki.URL != "" && loki.Format == "json" {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	add := func(names []string) {
+		for _, name := range names {
+			used[name] = true
+		}
+	}
+
+	add(builtinFields)
+	add(metricLabels(nc))
+	add(loki.LabelFields)
+	add([]string{nc.ExemplarField})
+	add(nc.Filter.IncludeExpr.variables)
+	add(nc.Filter.ExcludeExpr.variables)
+	for _, le := range nc.LabelExpressions {
+		add(le.Expr.variables)
+	}
+	for _, slo := range nc.SLOs {
+		add(slo.Match.variables)
+	}
+	for _, rc := range nc.RelabelConfigs {
+		add(rc.SourceLabels)
+	}
+	return used
+}
@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+// benchFormat is the default --format
+const benchFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for" $request_time`
+
+const benchLine = `1.2.3.4 - - [10/Oct/2026:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 612 "https://example.com/" "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0" "-" 0.012`
+
+func benchmarkParse(b *testing.B, p LineParser) {
+	if _, err := p.ParseFields(benchLine); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ParseFields(benchLine); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseRegex(b *testing.B) {
+	benchmarkParse(b, newRegexParser(benchFormat))
+}
+
+func BenchmarkParseScanner(b *testing.B) {
+	p, err := newScanParser(benchFormat)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkParse(b, p)
+}
+
+func BenchmarkParseScannerReused(b *testing.B) {
+	p, err := newScanParser(benchFormat)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e, err := p.parseReused(benchLine)
+		if err != nil {
+			b.Fatal(err)
+		}
+		e.release()
+	}
+}
+
+func TestScanParserMatchesGonx(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		line   string
+	}{
+		{name: "default", format: benchFormat, line: benchLine},
+		{name: "default mismatch", format: benchFormat, line: `1.2.3.4 - - [10/Oct/2026:13:55:36 +0000] "GET / HTTP/1.1" 200`},
+		{name: "quoted", format: `"$request" "$http_user_agent"`, line: `"GET / HTTP/1.1" "curl/8.0 (x86_64)"`},
+		{name: "quoted empty", format: `"$request" "$http_user_agent"`, line: `"" ""`},
+		{name: "quoted mismatch", format: `"$request" "$http_user_agent"`, line: `"GET / HTTP/1.1" curl`},
+		{name: "trailing literal", format: `[$time_local] $status;`, line: `[10/Oct/2026:13:55:36 +0000] 200;`},
+		{name: "trailing literal missing", format: `[$time_local] $status;`, line: `[10/Oct/2026:13:55:36 +0000] 200`},
+		{name: "trailing text", format: `[$time_local] $status;`, line: `[10/Oct/2026:13:55:36 +0000] 200; more`},
+		{name: "leading literal missing", format: `[$time_local] $status;`, line: `10/Oct/2026:13:55:36 +0000] 200;`},
+		{name: "last variable", format: `$remote_addr $status`, line: `1.2.3.4 200`},
+		{name: "last variable with space", format: `$remote_addr $status`, line: `1.2.3.4 200 OK`},
+		{name: "empty line", format: `$remote_addr $status`, line: ``},
+	}
+
+	for _, test := range tests {
+		want, wantErr := gonx.NewParser(test.format).ParseString(test.line)
+
+		regex, regexErr := newRegexParser(test.format).ParseFields(test.line)
+		switch {
+		case (regexErr != nil) != (wantErr != nil) || regexErr != nil && regexErr.Error() != wantErr.Error():
+			t.Errorf("%s: regex error %v, gonx %v", test.name, regexErr, wantErr)
+		case regexErr == nil:
+			for name, value := range regex {
+				if v, _ := want.Field(name); v != value {
+					t.Errorf("%s: regex field %s %q, gonx %q", test.name, name, value, v)
+				}
+			}
+		}
+
+		p, err := newScanParser(test.format)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		got, err := p.ParseFields(test.line)
+
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("%s: error %v, gonx %v", test.name, err, wantErr)
+			continue
+		}
+		// The messages differ, gonx quotes its regular expression
+		if err == nil && !reflect.DeepEqual(got, regex) {
+			t.Errorf("%s: fields %v, gonx %v", test.name, got, regex)
+		}
+	}
+}
+
+func TestScanParserRestrict(t *testing.T) {
+	p, err := newScanParser(benchFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.restrict(map[string]bool{"status": true, "request_time": true})
+
+	for i := 0; i < 2; i++ {
+		e, err := p.parseReused(benchLine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := e.fields, (gonx.Fields{"status": "200", "request_time": "0.012"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("fields %v, want %v", got, want)
+		}
+		e.release()
+	}
+
+	if _, err := p.parseReused("1.2.3.4 -"); err == nil {
+		t.Error("restricted parser matched a truncated line")
+	}
+}
+
+func TestUsedFields(t *testing.T) {
+	var nc NamespaceConfig
+	nc.MetricLabels = labelNames{"status", "upstream_cluster"}
+	nc.ExemplarField = "http_traceparent"
+	if err := nc.Filter.ExcludeExpr.UnmarshalFlag(`http_x_tenant == "test"`); err != nil {
+		t.Fatal(err)
+	}
+
+	used := usedFields(nc, LokiConfig{})
+	for _, name := range []string{"status", "request_time", "upstream_cluster", "http_traceparent", "http_x_tenant"} {
+		if !used[name] {
+			t.Errorf("%s is not used", name)
+		}
+	}
+	if used["remote_user"] {
+		t.Error("remote_user is used")
+	}
+
+	if used := usedFields(nc, LokiConfig{URL: "http://loki", Format: "json"}); used != nil {
+		t.Errorf("used %v with Loki JSON lines, want all fields", used)
+	}
+}
@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// overflowValue is the label value of series which exceed the series limit
+const overflowValue = "other"
+
+// seriesTracker restricts the number of distinct label value combinations of
+// a metric and keeps track of when each of them was last observed
+type seriesTracker struct {
+	mu     sync.Mutex
+	limit  int
+	ttl    time.Duration
+	series map[string]*trackedSeries
+	hits   prometheus.Counter
+}
+
+type trackedSeries struct {
+	values   []string
+	lastSeen time.Time
+}
+
+// newSeriesTracker creates a seriesTracker counting the observations folded
+// into the overflow series with hits
+func newSeriesTracker(limit int, ttl time.Duration, hits prometheus.Counter) *seriesTracker {
+	return &seriesTracker{
+		limit:  limit,
+		ttl:    ttl,
+		series: make(map[string]*trackedSeries),
+		hits:   hits,
+	}
+}
+
+// labelValues returns values if they belong to a known series or the limit
+// has not been reached yet. Otherwise the values of the overflow series are
+// returned and a hit is counted.
+func (t *seriesTracker) labelValues(values []string) []string {
+	if t == nil || (t.limit <= 0 && t.ttl <= 0) {
+		return values
+	}
+
+	key := strings.Join(values, "\xff")
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.series[key]; ok {
+		s.lastSeen = now
+		return values
+	}
+
+	if t.limit <= 0 || len(t.series) < t.limit {
+		t.series[key] = &trackedSeries{values: values, lastSeen: now}
+		return values
+	}
+
+	t.hits.Inc()
+
+	overflow := make([]string, len(values))
+	for i := range overflow {
+		overflow[i] = overflowValue
+	}
+
+	key = strings.Join(overflow, "\xff")
+	if s, ok := t.series[key]; ok {
+		s.lastSeen = now
+	} else {
+		t.series[key] = &trackedSeries{values: overflow, lastSeen: now}
+	}
+	return overflow
+}
+
+// expire forgets all series not observed within the TTL and returns their
+// label values
+func (t *seriesTracker) expire(now time.Time) [][]string {
+	if t == nil || t.ttl <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var expired [][]string
+	for key, s := range t.series {
+		if now.Sub(s.lastSeen) > t.ttl {
+			expired = append(expired, s.values)
+			delete(t.series, key)
+		}
+	}
+	return expired
+}
+
+// labelDeleter is implemented by all metric vectors
+type labelDeleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// expireSeries deletes the series of vec expired by tracker
+func expireSeries(vec labelDeleter, tracker *seriesTracker, now time.Time) {
+	for _, values := range tracker.expire(now) {
+		vec.DeleteLabelValues(values...)
+	}
+}
+
+// counterMetric is a CounterVec whose series are tracked by a seriesTracker
+type counterMetric struct {
+	vec     *prometheus.CounterVec
+	tracker *seriesTracker
+}
+
+func newCounterMetric(vec *prometheus.CounterVec, tracker *seriesTracker) *counterMetric {
+	return &counterMetric{vec: vec, tracker: tracker}
+}
+
+// add adds v to the series with values. Calling add on a nil counterMetric
+// is a no-op.
+func (c *counterMetric) add(values []string, v float64) {
+	if c == nil {
+		return
+	}
+	c.vec.WithLabelValues(c.tracker.labelValues(values)...).Add(v)
+}
+
+// expire deletes series which have not been observed within the TTL
+func (c *counterMetric) expire(now time.Time) {
+	if c == nil {
+		return
+	}
+	expireSeries(c.vec, c.tracker, now)
+}
+
+// observerMetric is a HistogramVec or SummaryVec whose series are tracked by
+// a seriesTracker
+type observerMetric struct {
+	vec     observerVec
+	tracker *seriesTracker
+}
+
+// observerVec is implemented by HistogramVec and SummaryVec
+type observerVec interface {
+	prometheus.ObserverVec
+	labelDeleter
+}
+
+func newObserverMetric(vec observerVec, tracker *seriesTracker) *observerMetric {
+	return &observerMetric{vec: vec, tracker: tracker}
+}
+
+// observe records v for the series with values, attaching exemplar if it is
+// not nil. Calling observe on a nil observerMetric is a no-op.
+func (o *observerMetric) observe(values []string, v float64, exemplar prometheus.Labels) {
+	if o == nil {
+		return
+	}
+
+	obs := o.vec.WithLabelValues(o.tracker.labelValues(values)...)
+	if eo, ok := obs.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	obs.Observe(v)
+}
+
+// expire deletes series which have not been observed within the TTL
+func (o *observerMetric) expire(now time.Time) {
+	if o == nil {
+		return
+	}
+	expireSeries(o.vec, o.tracker, now)
+}
@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesTrackerLimit(t *testing.T) {
+	hits := prometheus.NewCounter(prometheus.CounterOpts{Name: "hits"})
+	tracker := newSeriesTracker(2, 0, hits)
+
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{[]string{"GET", "200"}, []string{"GET", "200"}},
+		{[]string{"GET", "404"}, []string{"GET", "404"}},
+		{[]string{"GET", "200"}, []string{"GET", "200"}},
+		{[]string{"POST", "200"}, []string{"other", "other"}},
+		{[]string{"PUT", "500"}, []string{"other", "other"}},
+	}
+	for _, test := range tests {
+		if got := tracker.labelValues(test.values); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("label values of %q are %q, want %q", test.values, got, test.want)
+		}
+	}
+
+	if got := testutil.ToFloat64(hits); got != 2 {
+		t.Errorf("%v series limit hits, want 2", got)
+	}
+}
+
+func TestSeriesTrackerTTL(t *testing.T) {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests"}, []string{"method"})
+	counter := newCounterMetric(vec, newSeriesTracker(0, time.Minute, nil))
+
+	counter.add([]string{"GET"}, 1)
+	counter.add([]string{"POST"}, 1)
+
+	counter.expire(time.Now().Add(30 * time.Second))
+	if got := testutil.CollectAndCount(vec); got != 2 {
+		t.Errorf("%d series within the TTL, want 2", got)
+	}
+
+	counter.expire(time.Now().Add(2 * time.Minute))
+	if got := testutil.CollectAndCount(vec); got != 0 {
+		t.Errorf("%d series after the TTL, want 0", got)
+	}
+
+	// An expired series starts again when it is observed once more
+	counter.add([]string{"GET"}, 1)
+	if got := testutil.ToFloat64(vec.WithLabelValues("GET")); got != 1 {
+		t.Errorf("expired series restarted at %v, want 1", got)
+	}
+}
@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+)
+
+// inputSet tracks followers until all lines they emitted are processed
+type inputSet struct {
+	mu        sync.Mutex
+	followers map[tail.Follower]bool
+	stopping  bool
+	wg        sync.WaitGroup
+}
+
+func newInputSet() *inputSet {
+	return &inputSet{followers: make(map[tail.Follower]bool)}
+}
+
+// add registers t, whose lines are processed until done is called. It
+// returns false once the exporter is shutting down, t must not be read then.
+func (s *inputSet) add(t tail.Follower) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		return false
+	}
+
+	s.followers[t] = true
+	s.wg.Add(1)
+	return true
+}
+
+// done marks all lines of t as processed
+func (s *inputSet) done(t tail.Follower) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.followers[t] {
+		delete(s.followers, t)
+		s.wg.Done()
+	}
+}
+
+// shuttingDown tells whether the followers are being stopped
+func (s *inputSet) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stopping
+}
+
+// reopen reopens the files of all followers of regular files
+func (s *inputSet) reopen() {
+	s.mu.Lock()
+	followers := make([]tail.Follower, 0, len(s.followers))
+	for t := range s.followers {
+		followers = append(followers, t)
+	}
+	s.mu.Unlock()
+
+	for _, t := range followers {
+		if r, ok := t.(tail.Reopener); ok {
+			if err := r.Reopen(); err != nil {
+				slog.Error("Error while reopening file", "err", err)
+			}
+		}
+	}
+}
+
+// stop stops all followers and waits until the lines they already emitted
+// are processed or ctx is done
+func (s *inputSet) stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopping = true
+	followers := make([]tail.Follower, 0, len(s.followers))
+	for t := range s.followers {
+		followers = append(followers, t)
+	}
+	s.mu.Unlock()
+
+	// Followers of files store their final position when stopped
+	for _, t := range followers {
+		t.Stop()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// SLOConfig defines a service level objective over the requests matching an
+// expression. Requests are bad events if they failed with a server error
+// or, if Latency is set, took longer than Latency seconds, all others are
+// good events.
+type SLOConfig struct {
+	Name      string              `yaml:"name"`
+	Match     conditionExpression `yaml:"match"`
+	Objective float64             `yaml:"objective"`
+	Latency   float64             `yaml:"latency"`
+}
+
+func (c SLOConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("SLO has no name")
+	}
+	if c.Objective <= 0 || c.Objective >= 1 {
+		return fmt.Errorf("SLO '%s' has objective %v, which must be between 0 and 1, e.g. 0.999", c.Name, c.Objective)
+	}
+	if c.Latency < 0 {
+		return fmt.Errorf("SLO '%s' has negative latency %v", c.Name, c.Latency)
+	}
+	return nil
+}
+
+// sloMetrics counts the good and bad events of the SLOs of a namespace
+type sloMetrics struct {
+	slos   []SLOConfig
+	events *prometheus.CounterVec
+}
+
+// newSLOMetrics creates the metrics of slos in namespace and registers them
+// with reg. The events of all SLOs are initialized, so that their rates are
+// available before the first request.
+func newSLOMetrics(namespace string, slos []SLOConfig, reg prometheus.Registerer) *sloMetrics {
+	m := &sloMetrics{
+		slos: slos,
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_slo_events_total",
+			Help:      "Amount of requests counting towards an SLO by event, which is good or bad",
+		}, []string{"slo", "event"}),
+	}
+
+	objectives := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_slo_objective_ratio",
+		Help:      "Objective of an SLO, the share of good events to achieve",
+	}, []string{"slo"})
+	reg.MustRegister(m.events, objectives)
+
+	for _, slo := range slos {
+		m.events.WithLabelValues(slo.Name, "good")
+		m.events.WithLabelValues(slo.Name, "bad")
+		objectives.WithLabelValues(slo.Name).Set(slo.Objective)
+	}
+
+	return m
+}
+
+// observe counts the request of entry as event of every SLO it matches
+func (m *sloMetrics) observe(ns *namespace, entry *gonx.Entry) {
+	if m == nil {
+		return
+	}
+
+	for _, slo := range m.slos {
+		if !slo.Match.empty() && !slo.Match.match(ns, entry) {
+			continue
+		}
+
+		event := "good"
+		if status, _ := entry.Field("status"); statusClass(status) == "5xx" {
+			event = "bad"
+		} else if slo.Latency > 0 {
+			responseTime, err := entry.FloatField("request_time")
+			if err != nil {
+				continue
+			}
+			if responseTime > slo.Latency {
+				event = "bad"
+			}
+		}
+
+		m.events.WithLabelValues(slo.Name, event).Inc()
+	}
+}
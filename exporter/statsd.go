@@ -0,0 +1,176 @@
+package exporter
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+// StatsDConfig is a struct
+type StatsDConfig struct {
+	Address       string        `long:"statsd.address" description:"Address of a StatsD or DogStatsD server to send a counter and timing sample per request to via UDP, e.g. 127.0.0.1:8125"`
+	Prefix        string        `long:"statsd.prefix" default:"nginx" description:"Prefix of the StatsD metric names"`
+	TagFormat     string        `long:"statsd.tag-format" default:"dogstatsd" choice:"dogstatsd" choice:"none" description:"Format of the namespace and metric labels sent along, dogstatsd for |#name:value tags or none for plain StatsD without tags"`
+	FlushInterval time.Duration `long:"statsd.flush-interval" default:"1s" description:"Maximum time a sample is buffered before it is sent"`
+}
+
+// statsdMaxPacket is the maximum size of a StatsD packet, which fits into
+// the MTU of common networks
+const statsdMaxPacket = 1432
+
+// statsdClient buffers StatsD samples and sends them in packets of up to
+// statsdMaxPacket bytes
+type statsdClient struct {
+	config StatsDConfig
+	conn   net.Conn
+
+	mu  sync.Mutex
+	buf []byte
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newStatsDClient(c StatsDConfig) (*statsdClient, error) {
+	conn, err := net.Dial("udp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &statsdClient{
+		config:  c,
+		conn:    conn,
+		buf:     make([]byte, 0, statsdMaxPacket),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	slog.Info("Sending requests to StatsD", "address", c.Address)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *statsdClient) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// stop sends the buffered samples and closes the connection
+func (s *statsdClient) stop(ctx context.Context) error {
+	close(s.done)
+	<-s.stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flush()
+	return s.conn.Close()
+}
+
+// flush sends the buffered samples, s.mu must be held
+func (s *statsdClient) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+
+	// Packets are lost anyway if the server is gone, errors are only logged
+	if _, err := s.conn.Write(s.buf); err != nil {
+		slog.Debug("Error while sending StatsD packet", "address", s.config.Address, "err", err)
+	}
+	s.buf = s.buf[:0]
+}
+
+// send buffers a sample of metric with value and StatsD type typ. rate is
+// the sample rate, tags are appended in the configured tag format.
+func (s *statsdClient) send(metric, value, typ string, rate float64, tags []string) {
+	var b strings.Builder
+	b.WriteString(s.config.Prefix)
+	b.WriteByte('.')
+	b.WriteString(metric)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(typ)
+	if rate < 1 {
+		b.WriteString("|@")
+		b.WriteString(strconv.FormatFloat(rate, 'g', -1, 64))
+	}
+	if s.config.TagFormat == "dogstatsd" && len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+	sample := b.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buf) > 0 && len(s.buf)+1+len(sample) > statsdMaxPacket {
+		s.flush()
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, sample...)
+}
+
+// request sends the samples of a request of ns with labelValues. The
+// timing is only sent for sampled requests, with the sample rate of ns.
+func (s *statsdClient) request(ns *namespace, entry *gonx.Entry, labelValues []string, sampled bool) {
+	if s == nil {
+		return
+	}
+
+	tags := make([]string, 0, len(ns.labels)+1)
+	tags = append(tags, "namespace:"+statsdTagValue(ns.config.Name))
+	for i, name := range ns.labels {
+		tags = append(tags, name+":"+statsdTagValue(labelValues[i]))
+	}
+
+	s.send("http.requests", "1", "c", 1, tags)
+
+	if bytes, err := entry.Field("body_bytes_sent"); err == nil {
+		if _, err := strconv.ParseUint(bytes, 10, 64); err == nil {
+			s.send("http.response_bytes", bytes, "c", 1, tags)
+		}
+	}
+
+	if !sampled {
+		return
+	}
+
+	rate := 1.0
+	if ns.metricsConfig.SampleRate > 1 {
+		rate = 1 / float64(ns.metricsConfig.SampleRate)
+	}
+	if responseTime, err := entry.FloatField("request_time"); err == nil {
+		s.send("http.response_time", strconv.FormatFloat(responseTime*1000, 'f', -1, 64), "ms", rate, tags)
+	}
+}
+
+// statsdTagReplacer replaces the characters separating tags and samples
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// statsdTagValue replaces the characters separating tags and samples
+func statsdTagValue(value string) string {
+	return statsdTagReplacer.Replace(value)
+}
@@ -0,0 +1,356 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	hpcloud "github.com/hpcloud/tail"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// telemetry are the self-telemetry metrics of an exporter
+type telemetry struct {
+	linesRead       *prometheus.CounterVec
+	bytesRead       *prometheus.CounterVec
+	linesParsed     *prometheus.CounterVec
+	relabelDropped  *prometheus.CounterVec
+	linesDropped    *prometheus.CounterVec
+	formatMatches   *prometheus.CounterVec
+	lastParse       *prometheus.GaugeVec
+	lastProcessed   *prometheus.GaugeVec
+	parseDuration   *prometheus.HistogramVec
+	lastIngestDelay *prometheus.GaugeVec
+	ingestDelay     *prometheus.HistogramVec
+	fileReopens     *prometheus.CounterVec
+	seriesLimitHits *prometheus.CounterVec
+	exprErrors      *expressionErrors
+	parseQueues     *queueCollector
+	tailLags        *lagCollector
+	pipelines       *pipelineCollector
+}
+
+// newTelemetry creates the self-telemetry metrics and registers them with
+// reg. Files with unread bytes are reported as stalled after stallTimeout.
+func newTelemetry(reg prometheus.Registerer, stallTimeout time.Duration) *telemetry {
+	t := &telemetry{
+		linesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "lines_read_total",
+			Help:      "Number of lines read from a log file or input",
+		}, []string{"namespace", "file"}),
+
+		bytesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "bytes_read_total",
+			Help:      "Number of bytes read from a log file or input, including line breaks",
+		}, []string{"namespace", "file"}),
+
+		linesParsed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "lines_parsed_total",
+			Help:      "Number of lines parsed by result, which is ok, error or skipped for lines of an envelope which are no access log lines",
+		}, []string{"namespace", "file", "result"}),
+
+		linesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "lines_dropped_total",
+			Help:      "Number of lines dropped without parsing them because the parse workers could not keep up, only with --parse-queue.drop",
+		}, []string{"namespace", "file"}),
+
+		relabelDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "lines_relabel_dropped_total",
+			Help:      "Number of parsed lines dropped from all metrics by a keep or drop relabeling rule",
+		}, []string{"namespace"}),
+
+		formatMatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "format_matches_total",
+			Help:      "Number of lines parsed with a format of a namespace with fallback formats, 0 for the format and 1 and above for the fallback formats in their order",
+		}, []string{"namespace", "format"}),
+
+		lastParse: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "nginx_exporter",
+			Name:      "last_parse_timestamp_seconds",
+			Help:      "Time a line of a log file or input was last parsed successfully",
+		}, []string{"namespace", "file"}),
+
+		lastProcessed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "nginx_exporter",
+			Name:      "last_line_processed_timestamp_seconds",
+			Help:      "Time a line of a log file or input was last processed, whether it could be parsed or not",
+		}, []string{"namespace", "file"}),
+
+		parseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "nginx_exporter",
+			Name:      "parse_duration_seconds",
+			Help:      "Time needed to parse a single line",
+			Buckets:   prometheus.ExponentialBuckets(0.000001, 2, 12),
+		}, []string{"namespace"}),
+
+		lastIngestDelay: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "nginx_exporter",
+			Name:      "last_ingest_delay_seconds",
+			Help:      "Time between the timestamp of the last line parsed and parsing it, taken from $time_iso8601, $time_local or $msec",
+		}, []string{"namespace", "file"}),
+
+		ingestDelay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "nginx_exporter",
+			Name:      "ingest_delay_seconds",
+			Help:      "Time between the timestamps of lines and parsing them, taken from $time_iso8601, $time_local or $msec, starting at 1s as $time_iso8601 and $time_local have a resolution of a second",
+			Buckets:   []float64{1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+		}, []string{"namespace"}),
+
+		fileReopens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "file_reopens_total",
+			Help:      "Number of times a followed file was reopened because it was rotated or truncated",
+		}, []string{"namespace", "reason"}),
+
+		seriesLimitHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "series_limit_hits_total",
+			Help:      "Number of observations folded into the overflow series because the series limit of a metric was reached",
+		}, []string{"namespace", "metric"}),
+
+		exprErrors: &expressionErrors{counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_exporter",
+			Name:      "expression_errors_total",
+			Help:      "Number of times an expression failed to evaluate for a line, which counts as false or an empty label value",
+		}, []string{"namespace", "expr"})},
+
+		parseQueues: newQueueCollector(),
+		tailLags:    newLagCollector(),
+		pipelines:   newPipelineCollector(stallTimeout),
+	}
+
+	reg.MustRegister(t.linesRead, t.bytesRead, t.linesParsed, t.linesDropped, t.relabelDropped, t.formatMatches, t.lastParse, t.lastProcessed, t.parseDuration, t.lastIngestDelay, t.ingestDelay, t.fileReopens, t.seriesLimitHits, t.exprErrors.counter, t.parseQueues, t.tailLags, t.pipelines)
+	return t
+}
+
+// fileTelemetry holds the self-telemetry series of a single log file or
+// input
+type fileTelemetry struct {
+	linesRead     prometheus.Counter
+	bytesRead     prometheus.Counter
+	parsedOK      prometheus.Counter
+	parsedError   prometheus.Counter
+	parsedSkipped prometheus.Counter
+	dropped       prometheus.Counter
+	lastParse     prometheus.Gauge
+	parseDuration prometheus.Observer
+	lastDelay     prometheus.Gauge
+	ingestDelay   prometheus.Observer
+}
+
+// file returns the self-telemetry series of file of namespace
+func (t *telemetry) file(namespace, file string) *fileTelemetry {
+	return &fileTelemetry{
+		linesRead:     t.linesRead.WithLabelValues(namespace, file),
+		bytesRead:     t.bytesRead.WithLabelValues(namespace, file),
+		parsedOK:      t.linesParsed.WithLabelValues(namespace, file, "ok"),
+		parsedError:   t.linesParsed.WithLabelValues(namespace, file, "error"),
+		parsedSkipped: t.linesParsed.WithLabelValues(namespace, file, "skipped"),
+		dropped:       t.linesDropped.WithLabelValues(namespace, file),
+		lastParse:     t.lastParse.WithLabelValues(namespace, file),
+		parseDuration: t.parseDuration.WithLabelValues(namespace),
+		lastDelay:     t.lastIngestDelay.WithLabelValues(namespace, file),
+		ingestDelay:   t.ingestDelay.WithLabelValues(namespace),
+	}
+}
+
+// forget deletes the series of file of namespace, which is no longer
+// followed as it disappeared
+func (t *telemetry) forget(namespace, file string) {
+	t.linesRead.DeleteLabelValues(namespace, file)
+	t.bytesRead.DeleteLabelValues(namespace, file)
+	for _, result := range []string{"ok", "error", "skipped"} {
+		t.linesParsed.DeleteLabelValues(namespace, file, result)
+	}
+	t.linesDropped.DeleteLabelValues(namespace, file)
+	t.lastParse.DeleteLabelValues(namespace, file)
+	t.lastProcessed.DeleteLabelValues(namespace, file)
+	t.lastIngestDelay.DeleteLabelValues(namespace, file)
+}
+
+// parsed records the result of parsing a line
+func (f *fileTelemetry) parsed(err error) {
+	switch err {
+	case nil:
+		f.parsedOK.Inc()
+		f.lastParse.SetToCurrentTime()
+	case errSkipLine:
+		f.parsedSkipped.Inc()
+	default:
+		f.parsedError.Inc()
+	}
+}
+
+// ingested records the delay between the time of entry and now, which
+// covers the buffering of nginx and the lag of the exporter. Negative delays
+// of clocks ahead, e.g. of hosts sending syslog, count as no delay.
+func (f *fileTelemetry) ingested(entry *gonx.Entry, now time.Time) {
+	t, ok := entryTime(entry)
+	if !ok {
+		return
+	}
+
+	delay := now.Sub(t).Seconds()
+	if delay < 0 {
+		delay = 0
+	}
+	f.lastDelay.Set(delay)
+	f.ingestDelay.Observe(delay)
+}
+
+// queue is the channel of parsed lines of a log file, waiting for their
+// metrics to be updated. Lines which are dropped while the parse workers are
+// busy wait in read before they are parsed.
+type queue struct {
+	namespace string
+	file      string
+	lines     chan parsedLine
+	read      chan *hpcloud.Line
+}
+
+// queueCollector reports the occupancy of the queues of all log files
+type queueCollector struct {
+	mu       sync.Mutex
+	queues   map[*queue]bool
+	length   *prometheus.Desc
+	capacity *prometheus.Desc
+	read     *prometheus.Desc
+}
+
+func newQueueCollector() *queueCollector {
+	return &queueCollector{
+		queues: make(map[*queue]bool),
+		length: prometheus.NewDesc(
+			"nginx_exporter_parse_queue_length",
+			"Number of parsed lines waiting for their metrics to be updated, a full queue means the metric updates cannot keep up",
+			[]string{"namespace", "file"}, nil,
+		),
+		capacity: prometheus.NewDesc(
+			"nginx_exporter_parse_queue_capacity",
+			"Capacity of the queue of parsed lines, which is --parse-queue.size or the number of parse workers",
+			[]string{"namespace", "file"}, nil,
+		),
+		read: prometheus.NewDesc(
+			"nginx_exporter_read_queue_length",
+			"Number of read lines waiting for a parse worker with --parse-queue.drop, which are dropped once as many as the capacity of the parse queue are waiting",
+			[]string{"namespace", "file"}, nil,
+		),
+	}
+}
+
+func (c *queueCollector) add(q *queue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queues[q] = true
+}
+
+func (c *queueCollector) remove(q *queue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.queues, q)
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.length
+	ch <- c.capacity
+	ch <- c.read
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for q := range c.queues {
+		ch <- prometheus.MustNewConstMetric(c.length, prometheus.GaugeValue, float64(len(q.lines)), q.namespace, q.file)
+		ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(cap(q.lines)), q.namespace, q.file)
+		if q.read != nil {
+			ch <- prometheus.MustNewConstMetric(c.read, prometheus.GaugeValue, float64(len(q.read)), q.namespace, q.file)
+		}
+	}
+}
+
+// laggingFile is a followed file whose lag is reported
+type laggingFile struct {
+	namespace string
+	file      string
+	lagger    tail.Lagger
+}
+
+// lagCollector reports the lag of all followed files on every scrape
+type lagCollector struct {
+	mu    sync.Mutex
+	files map[tail.Follower]laggingFile
+	desc  *prometheus.Desc
+}
+
+func newLagCollector() *lagCollector {
+	return &lagCollector{
+		files: make(map[tail.Follower]laggingFile),
+		desc: prometheus.NewDesc(
+			"nginx_exporter_tail_lag_bytes",
+			"Number of bytes between the read offset and the end of a followed file, a growing lag means the exporter cannot keep up",
+			[]string{"namespace", "file"}, nil,
+		),
+	}
+}
+
+// add reports the lag of t, which follows file of namespace, if t is a
+// follower of a regular file
+func (c *lagCollector) add(namespace, file string, t tail.Follower) {
+	lagger, ok := t.(tail.Lagger)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files[t] = laggingFile{namespace: namespace, file: file, lagger: lagger}
+}
+
+func (c *lagCollector) remove(t tail.Follower) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.files, t)
+}
+
+// offsets returns the current read offsets of all followed files
+func (c *lagCollector) offsets() []FileOffset {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]FileOffset, 0, len(c.files))
+	for _, f := range c.files {
+		if offset, err := f.lagger.Offset(); err == nil {
+			result = append(result, FileOffset{Namespace: f.namespace, File: f.file, Offset: offset})
+		}
+	}
+	return result
+}
+
+func (c *lagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *lagCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range c.files {
+		lag, err := f.lagger.Lag()
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(lag), f.namespace, f.file)
+	}
+}
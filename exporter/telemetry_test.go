@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTelemetryForget(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	tel := newTelemetry(reg, 0)
+
+	for _, file := range []string{"/var/log/a.log", "/var/log/b.log"} {
+		f := tel.file("nginx", file)
+		f.linesRead.Inc()
+		f.parsed(nil)
+		f.dropped.Inc()
+		f.lastDelay.Set(1)
+		tel.lastProcessed.WithLabelValues("nginx", file).SetToCurrentTime()
+	}
+	tel.forget("nginx", "/var/log/a.log")
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make(map[string]int)
+	for _, mf := range families {
+		series[mf.GetName()] = len(mf.Metric)
+	}
+
+	tests := map[string]int{
+		"nginx_exporter_lines_read_total":                      1,
+		"nginx_exporter_bytes_read_total":                      1,
+		"nginx_exporter_lines_parsed_total":                    3,
+		"nginx_exporter_lines_dropped_total":                   1,
+		"nginx_exporter_last_parse_timestamp_seconds":          1,
+		"nginx_exporter_last_line_processed_timestamp_seconds": 1,
+		"nginx_exporter_last_ingest_delay_seconds":             1,
+	}
+	for name, want := range tests {
+		if got := series[name]; got != want {
+			t.Errorf("%s: %d series, want %d", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// TestFormat parses every line read from r with the parser of namespace, or
+// the first namespace if it is empty, and writes the extracted fields or the
+// parse error of each line to w. It reports whether all lines were parsed.
+// Lines are not processed, so no metrics are updated. The parser is built
+// anew, as the parser of the namespace only keeps the fields it uses.
+func (e *Exporter) TestFormat(w io.Writer, r io.Reader, namespace string) (bool, error) {
+	ns, err := e.namespace(namespace)
+	if err != nil {
+		return false, err
+	}
+
+	if ns.config.FormatType == "" || ns.config.FormatType == "text" {
+		fmt.Fprintf(w, "format: %s\n", ns.config.Format)
+		for _, f := range ns.config.FallbackFormats {
+			fmt.Fprintf(w, "fallback format: %s\n", f)
+		}
+	}
+
+	parser, err := newParser(ns.config.LogConfig, ns.config.Format, nil)
+	if err != nil {
+		return false, err
+	}
+
+	joiner := newLineJoiner(ns.config.Envelope)
+	ok := true
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if joiner != nil {
+			var whole bool
+			if line, whole = joiner.join(line); !whole {
+				continue
+			}
+		}
+
+		fields, err := parser.ParseFields(line)
+		switch {
+		case err == errSkipLine:
+			fmt.Fprintf(w, "line %d: skipped\n", n)
+		case err != nil:
+			ok = false
+			fmt.Fprintf(w, "line %d: FAILED: %s\n", n, err)
+		default:
+			b, err := json.Marshal(fields)
+			if err != nil {
+				return false, err
+			}
+			fmt.Fprintf(w, "line %d: %s\n", n, b)
+		}
+	}
+	return ok, scanner.Err()
+}
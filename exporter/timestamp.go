@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// timeLocalLayout is the layout of $time_local
+const timeLocalLayout = "02/Jan/2006:15:04:05 -0700"
+
+// entryTime returns the time of entry taken from $time_iso8601, $time_local
+// or $msec, whichever is part of the log format
+func entryTime(entry *gonx.Entry) (time.Time, bool) {
+	if value, err := entry.Field("time_iso8601"); err == nil {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, true
+		}
+	}
+
+	if value, err := entry.Field("time_local"); err == nil {
+		if t, err := time.Parse(timeLocalLayout, value); err == nil {
+			return t, true
+		}
+	}
+
+	if value, err := entry.Field("msec"); err == nil {
+		if msec, err := strconv.ParseFloat(value, 64); err == nil {
+			sec, frac := math.Modf(msec)
+			return time.Unix(int64(sec), int64(frac*1e9)), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// newestTimestamp keeps track of the newest entry time seen
+type newestTimestamp struct {
+	bits uint64
+}
+
+// observe updates the newest timestamp if t is newer
+func (n *newestTimestamp) observe(t time.Time) {
+	seconds := float64(t.UnixNano()) / 1e9
+	for {
+		old := atomic.LoadUint64(&n.bits)
+		if math.Float64frombits(old) >= seconds {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&n.bits, old, math.Float64bits(seconds)) {
+			return
+		}
+	}
+}
+
+// seconds returns the newest timestamp as Unix time
+func (n *newestTimestamp) seconds() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&n.bits))
+}
+
+// newLastRequestTimestamp creates a gauge reporting the newest timestamp of
+// n
+func newLastRequestTimestamp(namespace, name string, n *newestTimestamp) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      "Time of the newest request seen, taken from $time_iso8601, $time_local or $msec",
+	}, n.seconds)
+}
+
+// tooOld checks whether entry is older than the --ignore-older age of ns. It
+// also records the time of entry as the newest timestamp if it is newer.
+func (ns *namespace) tooOld(entry *gonx.Entry) bool {
+	t, ok := entryTime(entry)
+	if !ok {
+		return false
+	}
+
+	if ns.config.IgnoreOlder > 0 && time.Since(t) > ns.config.IgnoreOlder {
+		return true
+	}
+
+	ns.metrics.lastRequest.observe(t)
+	return false
+}
@@ -0,0 +1,43 @@
+package exporter
+
+import (
+	"github.com/satyrius/gonx"
+)
+
+// observeTLS counts the TLS protocol and cipher of requests made over TLS
+func observeTLS(m *Metrics, entry *gonx.Entry) {
+	protocol, err := entry.Field("ssl_protocol")
+	if err != nil || protocol == "" || protocol == "-" {
+		return
+	}
+
+	cipher, _ := entry.Field("ssl_cipher")
+	if cipher == "-" {
+		cipher = ""
+	}
+
+	m.tlsRequests.add([]string{protocol, cipher}, 1)
+}
+
+// observeTLSSession counts whether the TLS session of entry was reused,
+// which $ssl_session_reused logs as r, and a full handshake was saved
+func observeTLSSession(ns *namespace, entry *gonx.Entry) {
+	reused, err := entry.Field("ssl_session_reused")
+	if err != nil || reused == "" || reused == "-" {
+		return
+	}
+
+	labelValues := []string{"no"}
+	if reused == "r" {
+		labelValues[0] = "yes"
+	}
+	if ns.metricsConfig.TLSSessionProtocol {
+		protocol, _ := entry.Field("ssl_protocol")
+		if protocol == "-" {
+			protocol = ""
+		}
+		labelValues = append(labelValues, protocol)
+	}
+
+	ns.metrics.tlsSessions.add(labelValues, 1)
+}
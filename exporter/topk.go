@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// topKCapacityFactor is the number of keys tracked per reported key. Keys
+// beyond the capacity replace the key with the lowest weight, so only keys
+// with a weight near that of the last reported key are inaccurate.
+const topKCapacityFactor = 10
+
+// topKItem is a key tracked by a topK
+type topKItem struct {
+	key   string
+	score float64
+	index int
+}
+
+// topKHeap is a min-heap of the tracked keys by score
+type topKHeap []*topKItem
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].score < h[j].score }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	item := x.(*topKItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// topK estimates the k keys with the highest weight in constant space with
+// the space-saving algorithm. Weights decay exponentially with the time
+// constant decay, so the keys are those with the highest weight recently.
+// Scores are kept relative to a landmark time, which saves decaying all
+// scores on every update.
+type topK struct {
+	k        int
+	capacity int
+	decay    float64
+	landmark time.Time
+	items    map[string]*topKItem
+	heap     topKHeap
+}
+
+func newTopK(k int, decay time.Duration) *topK {
+	return &topK{
+		k:        k,
+		capacity: k * topKCapacityFactor,
+		decay:    decay.Seconds(),
+		landmark: time.Now(),
+		items:    make(map[string]*topKItem),
+	}
+}
+
+// add adds weight to key at now
+func (t *topK) add(key string, weight float64, now time.Time) {
+	exponent := now.Sub(t.landmark).Seconds() / t.decay
+	if exponent > 100 {
+		// Move the landmark before the scores overflow
+		for _, item := range t.heap {
+			item.score *= math.Exp(-exponent)
+		}
+		t.landmark, exponent = now, 0
+	}
+	score := weight * math.Exp(exponent)
+
+	if item, ok := t.items[key]; ok {
+		item.score += score
+		heap.Fix(&t.heap, item.index)
+		return
+	}
+
+	if len(t.heap) < t.capacity {
+		item := &topKItem{key: key, score: score}
+		t.items[key] = item
+		heap.Push(&t.heap, item)
+		return
+	}
+
+	// The new key takes over the lowest score, which bounds its error
+	min := t.heap[0]
+	delete(t.items, min.key)
+	min.key = key
+	min.score += score
+	t.items[key] = min
+	heap.Fix(&t.heap, 0)
+}
+
+// top returns the k keys with the highest score and their decayed weight
+// per second at now
+func (t *topK) top(now time.Time) []topKItem {
+	scale := math.Exp(-now.Sub(t.landmark).Seconds()/t.decay) / t.decay
+
+	items := make([]topKItem, len(t.heap))
+	for i, item := range t.heap {
+		items[i] = topKItem{key: item.key, score: item.score * scale}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].score > items[j].score
+	})
+	if len(items) > t.k {
+		items = items[:t.k]
+	}
+	return items
+}
+
+// topPaths tracks the request paths with the most requests, bytes sent and
+// time spent. It implements prometheus.Collector.
+type topPaths struct {
+	mu                      sync.Mutex
+	requests, bytes, time   *topK
+	requestsDesc, bytesDesc *prometheus.Desc
+	timeDesc                *prometheus.Desc
+}
+
+// newTopPaths creates the top k paths of namespace with weights decaying
+// with the time constant decay. name is the prefix of the metric names.
+func newTopPaths(namespace, name string, k int, decay time.Duration) *topPaths {
+	desc := func(suffix, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name+suffix), help, []string{"path"}, nil)
+	}
+
+	return &topPaths{
+		requests:     newTopK(k, decay),
+		bytes:        newTopK(k, decay),
+		time:         newTopK(k, decay),
+		requestsDesc: desc("_requests_per_second", "Recent requests per second of the paths with the most requests"),
+		bytesDesc:    desc("_bytes_per_second", "Recent bytes sent per second of the paths sending the most bytes"),
+		timeDesc:     desc("_seconds_per_second", "Recent time spent on requests per second of the paths taking the most time"),
+	}
+}
+
+// insert counts a request of path at now
+func (p *topPaths) insert(path string, bytes, seconds float64, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests.add(path, 1, now)
+	if bytes > 0 {
+		p.bytes.add(path, bytes, now)
+	}
+	if seconds > 0 {
+		p.time.add(path, seconds, now)
+	}
+}
+
+// Describe implements prometheus.Collector
+func (p *topPaths) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.requestsDesc
+	ch <- p.bytesDesc
+	ch <- p.timeDesc
+}
+
+// Collect implements prometheus.Collector
+func (p *topPaths) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range []struct {
+		desc *prometheus.Desc
+		topK *topK
+	}{
+		{p.requestsDesc, p.requests},
+		{p.bytesDesc, p.bytes},
+		{p.timeDesc, p.time},
+	} {
+		for _, item := range t.topK.top(now) {
+			ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, item.score, item.key)
+		}
+	}
+}
+
+// observeTopPaths counts the request of entry in the top paths
+func observeTopPaths(ns *namespace, entry *gonx.Entry) {
+	if ns.metrics.topPaths == nil {
+		return
+	}
+
+	bytes, _ := entry.FloatField("body_bytes_sent")
+	seconds, _ := entry.FloatField("request_time")
+	ns.metrics.topPaths.insert(ns.fieldValue(entry, "path"), bytes, seconds, time.Now())
+}
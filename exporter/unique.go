@@ -0,0 +1,128 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axiomhq/hyperloglog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// durationList is a list of durations like 1h or 1d which is given as a
+// comma separated flag value
+type durationList []model.Duration
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (l *durationList) UnmarshalFlag(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		d, err := model.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration '%s'", s)
+		}
+		*l = append(*l, d)
+	}
+	return nil
+}
+
+// MarshalFlag implements flags.Marshaler
+func (l durationList) MarshalFlag() (string, error) {
+	s := make([]string, len(l))
+	for i, d := range l {
+		s[i] = d.String()
+	}
+	return strings.Join(s, ","), nil
+}
+
+// clientWindow estimates the number of distinct clients seen since the start
+// of the current window
+type clientWindow struct {
+	length time.Duration
+	label  string
+	start  time.Time
+	sketch *hyperloglog.Sketch
+}
+
+// uniqueClients estimates the number of distinct client addresses in a set
+// of fixed windows like the current hour or day. It implements
+// prometheus.Collector.
+type uniqueClients struct {
+	mu      sync.Mutex
+	desc    *prometheus.Desc
+	windows []*clientWindow
+}
+
+// newUniqueClients creates the estimate named name for the given window
+// lengths
+func newUniqueClients(namespace, name string, windows durationList) *uniqueClients {
+	u := &uniqueClients{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", name),
+			"Estimated number of distinct client addresses since the start of the current window",
+			[]string{"window"}, nil,
+		),
+	}
+
+	for _, d := range windows {
+		u.windows = append(u.windows, &clientWindow{
+			length: time.Duration(d),
+			label:  d.String(),
+			sketch: hyperloglog.New(),
+		})
+	}
+
+	return u
+}
+
+// roll starts a new window if now lies beyond the current one
+func (w *clientWindow) roll(now time.Time) {
+	if start := now.Truncate(w.length); !start.Equal(w.start) {
+		w.start = start
+		w.sketch = hyperloglog.New()
+	}
+}
+
+// insert adds client to all windows
+func (u *uniqueClients) insert(client string, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, w := range u.windows {
+		w.roll(now)
+		w.sketch.Insert([]byte(client))
+	}
+}
+
+// Describe implements prometheus.Collector
+func (u *uniqueClients) Describe(ch chan<- *prometheus.Desc) {
+	ch <- u.desc
+}
+
+// Collect implements prometheus.Collector
+func (u *uniqueClients) Collect(ch chan<- prometheus.Metric) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	for _, w := range u.windows {
+		w.roll(now)
+		ch <- prometheus.MustNewConstMetric(u.desc, prometheus.GaugeValue, float64(w.sketch.Estimate()), w.label)
+	}
+}
+
+// observeClient adds the client address addr, the $remote_addr of a line,
+// to the unique clients estimate
+func observeClient(metrics *Metrics, addr string) {
+	if metrics.uniqueClients == nil || addr == "" || addr == "-" {
+		return
+	}
+
+	metrics.uniqueClients.insert(addr, time.Now())
+}
@@ -0,0 +1,171 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// splitUpstreams splits the value of an $upstream_* variable into the values
+// of the individual upstream attempts. nginx separates attempts on servers of
+// the same upstream group with commas and internal redirects to another group
+// with colons, e.g. "192.168.1.1:80, 192.168.1.2:80 : 192.168.10.1:80".
+func splitUpstreams(value string) []string {
+	var values []string
+	for _, group := range strings.Split(value, " : ") {
+		for _, v := range strings.Split(group, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// upstreamAddr returns the address of the upstream server which produced the
+// final response for entry
+func upstreamAddr(entry *gonx.Entry) string {
+	value, err := entry.Field("upstream_addr")
+	if err != nil {
+		return ""
+	}
+
+	addrs := splitUpstreams(value)
+	if len(addrs) == 0 || addrs[len(addrs)-1] == "-" {
+		return ""
+	}
+	return addrs[len(addrs)-1]
+}
+
+// upstreamSum returns the sum of the values of the $upstream_* variable field
+// over all upstream attempts. It returns false if field is missing or does not
+// contain any number.
+func upstreamSum(entry *gonx.Entry, field string) (float64, bool) {
+	value, err := entry.Field(field)
+	if err != nil {
+		return 0, false
+	}
+
+	sum, found := 0.0, false
+	for _, v := range splitUpstreams(value) {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			sum += f
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// observeUpstreamTimes records the upstream time metrics of entry if it is
+// sampled and counts upstream retries
+func observeUpstreamTimes(ns *namespace, entry *gonx.Entry, labelValues, upstreamLabelValues []string, exemplar prometheus.Labels, sampled bool) {
+	m := ns.metrics
+
+	if value, err := entry.Field("upstream_response_time"); err == nil {
+		if attempts := len(splitUpstreams(value)); attempts > 1 {
+			m.upstreamRetries.add(labelValues, float64(attempts-1))
+		}
+	}
+
+	if !sampled {
+		return
+	}
+
+	observeUpstreamTime(ns, entry, "upstream_response_time", m.upstreamSeconds, m.upstreamSecondsHist, labelValues, upstreamLabelValues, exemplar)
+	observeUpstreamTime(ns, entry, "upstream_connect_time", m.upstreamConnectSeconds, m.upstreamConnectSecondsHist, labelValues, upstreamLabelValues, exemplar)
+	observeUpstreamTime(ns, entry, "upstream_header_time", m.upstreamHeaderSeconds, m.upstreamHeaderSecondsHist, labelValues, upstreamLabelValues, exemplar)
+}
+
+// observeUpstreamTime records the time of the $upstream_* variable field with
+// summary and hist. By default the times of all upstream attempts are summed
+// up, with --upstream-per-attempt every attempt is observed on its own, labeled with the
+// address of its server if the upstream_addr label is enabled.
+func observeUpstreamTime(ns *namespace, entry *gonx.Entry, field string, summary, hist *observerMetric, labelValues, upstreamLabelValues []string, exemplar prometheus.Labels) {
+	if !ns.metricsConfig.UpstreamPerAttempt {
+		if sum, ok := upstreamSum(entry, field); ok {
+			summary.observe(upstreamLabelValues, sum, nil)
+			hist.observe(upstreamLabelValues, sum, exemplar)
+		}
+		return
+	}
+
+	value, err := entry.Field(field)
+	if err != nil {
+		return
+	}
+	times := splitUpstreams(value)
+
+	var addrs []string
+	if ns.metricsConfig.UpstreamAddrLabel {
+		if value, err := entry.Field("upstream_addr"); err == nil {
+			addrs = splitUpstreams(value)
+		}
+	}
+
+	for i, t := range times {
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			continue
+		}
+
+		values := labelValues
+		if ns.metricsConfig.UpstreamAddrLabel {
+			addr := ""
+			if len(addrs) == len(times) && addrs[i] != "-" {
+				addr = addrs[i]
+			}
+			values = append(append([]string{}, labelValues...), addr)
+		}
+
+		summary.observe(values, f, nil)
+		hist.observe(values, f, exemplar)
+	}
+}
+
+// observeUpstreamStatus counts the status of every upstream attempt of entry
+// from $upstream_status, labeled with the address of its server if the
+// upstream_addr label is enabled. Requests whose $status differs from the
+// status of the final attempt, e.g. because error_page replaced it, are
+// counted as mismatch.
+func observeUpstreamStatus(ns *namespace, entry *gonx.Entry, labelValues []string) {
+	value, err := entry.Field("upstream_status")
+	if err != nil {
+		return
+	}
+	statuses := splitUpstreams(value)
+
+	var addrs []string
+	if ns.metricsConfig.UpstreamAddrLabel {
+		if value, err := entry.Field("upstream_addr"); err == nil {
+			addrs = splitUpstreams(value)
+		}
+	}
+
+	for i, status := range statuses {
+		if status == "-" {
+			continue
+		}
+
+		values := append([]string{}, labelValues...)
+		if ns.metricsConfig.UpstreamAddrLabel {
+			addr := ""
+			if len(addrs) == len(statuses) && addrs[i] != "-" {
+				addr = addrs[i]
+			}
+			values = append(values, addr)
+		}
+		values = append(values, aggregateStatus(status, ns.config.KeepStatuses))
+
+		ns.metrics.upstreamResponses.add(values, 1)
+	}
+
+	if len(statuses) == 0 {
+		return
+	}
+	final := statuses[len(statuses)-1]
+	if status, err := entry.Field("status"); err == nil && final != "-" && status != final {
+		ns.metrics.upstreamMismatches.add(labelValues, 1)
+	}
+}
@@ -0,0 +1,56 @@
+package exporter
+
+import (
+	"strings"
+
+	"github.com/satyrius/gonx"
+	"github.com/ua-parser/uap-go/uaparser"
+)
+
+// mobileOSFamilies are operating systems whose devices are phones unless the
+// device is known to be a tablet
+var mobileOSFamilies = map[string]bool{
+	"Android":       true,
+	"iOS":           true,
+	"Windows Phone": true,
+	"BlackBerry OS": true,
+	"KaiOS":         true,
+}
+
+// deviceType reduces the parsed client to one of desktop, mobile, tablet,
+// bot or other
+func deviceType(client *uaparser.Client, userAgent string) string {
+	family := client.Device.Family
+
+	switch {
+	case family == "Spider":
+		return "bot"
+	case strings.Contains(family, "iPad") || strings.Contains(family, "Tablet") || strings.Contains(family, "Kindle"):
+		return "tablet"
+	case client.Os.Family == "Android" && !strings.Contains(userAgent, "Mobile"):
+		// Android tablets do not send the Mobile token
+		return "tablet"
+	case mobileOSFamilies[client.Os.Family]:
+		return "mobile"
+	case family == "Other" && client.Os.Family != "Other":
+		return "desktop"
+	default:
+		return "other"
+	}
+}
+
+// observeUserAgent counts the request of entry by browser, operating system
+// and device type parsed from $http_user_agent
+func observeUserAgent(ns *namespace, entry *gonx.Entry) {
+	if ns.userAgents == nil {
+		return
+	}
+
+	userAgent, err := entry.Field("http_user_agent")
+	if err != nil {
+		return
+	}
+
+	client := ns.userAgents.Parse(userAgent)
+	ns.metrics.userAgentRequests.add([]string{client.UserAgent.Family, client.Os.Family, deviceType(client, userAgent)}, 1)
+}
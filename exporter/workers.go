@@ -0,0 +1,117 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	hpcloud "github.com/hpcloud/tail"
+	"github.com/satyrius/gonx"
+)
+
+// parsedLine is a line and the result of parsing it
+type parsedLine struct {
+	text  string
+	entry *gonx.Entry
+	// fields is the fields map of entry, which is kept by its reference
+	fields gonx.Fields
+	err    error
+	// reused is set for entries of the scanner, which are released once
+	// the line is processed
+	reused *scanEntry
+}
+
+// parse parses line with p, reusing the entries of the scanner
+func parse(p LineParser, line string) (*gonx.Entry, gonx.Fields, *scanEntry, error) {
+	sp, ok := p.(*scanParser)
+	if !ok {
+		fields, err := p.ParseFields(line)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return gonx.NewEntry(fields), fields, nil, nil
+	}
+
+	e, err := sp.parseReused(line)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return e.entry, e.fields, e, nil
+}
+
+// parseLines parses the lines emitted by t for file with the parse workers
+// of ns. The order of the lines is only preserved with a single worker. The
+// returned channel is closed once t has emitted its last line and all are
+// parsed. With drop set, lines are dropped while as many lines as the queue
+// holds wait for a busy worker, instead of blocking t until the workers
+// catch up.
+func parseLines(ns *namespace, file string, t tail.Follower, drop bool) <-chan parsedLine {
+	workers := ns.config.ParseWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	size := ns.config.ParseQueueSize
+	if size < 1 {
+		size = workers
+	}
+
+	telemetry := ns.telemetry.file(ns.config.Name, file)
+	q := &queue{
+		namespace: ns.config.Name,
+		file:      file,
+		lines:     make(chan parsedLine, size),
+	}
+
+	lines := t.Lines()
+	if j := newLineJoiner(ns.config.Envelope); j != nil {
+		lines = joinLines(lines, j)
+	}
+	if drop {
+		q.read = make(chan *hpcloud.Line, size)
+		go func(in chan *hpcloud.Line) {
+			defer close(q.read)
+			for line := range in {
+				select {
+				case q.read <- line:
+				default:
+					telemetry.dropped.Inc()
+				}
+			}
+		}(lines)
+		lines = q.read
+	}
+	ns.telemetry.parseQueues.add(q)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for line := range lines {
+				telemetry.linesRead.Inc()
+				telemetry.bytesRead.Add(float64(len(line.Text) + 1))
+
+				start := time.Now()
+				entry, fields, reused, err := parse(ns.parser, line.Text)
+				elapsed := time.Since(start)
+				telemetry.parseDuration.Observe(elapsed.Seconds())
+				telemetry.parsed(err)
+				ns.timings.parsed(elapsed)
+				if err == nil {
+					telemetry.ingested(entry, start)
+				}
+
+				q.lines <- parsedLine{text: line.Text, entry: entry, fields: fields, err: err, reused: reused}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		ns.telemetry.parseQueues.remove(q)
+		close(q.lines)
+	}()
+
+	return q.lines
+}
@@ -0,0 +1,95 @@
+package geoip
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// DB is a MaxMind GeoIP2 or GeoLite2 database which can be reloaded to pick
+// up updates of the database file
+type DB struct {
+	path   string
+	mu     sync.RWMutex
+	reader *geoip2.Reader
+}
+
+// Open opens the database at path
+func Open(path string) (*DB, error) {
+	db := &DB{path: path}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload reopens the database file
+func (db *DB) Reload() error {
+	reader, err := geoip2.Open(db.path)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	old := db.reader
+	db.reader = reader
+	db.mu.Unlock()
+
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// ReloadEvery reloads the database in the given interval, calling onError if
+// reloading fails. It never returns.
+func (db *DB) ReloadEvery(interval time.Duration, onError func(error)) {
+	for range time.Tick(interval) {
+		if err := db.Reload(); err != nil {
+			onError(err)
+		}
+	}
+}
+
+// Location returns the ISO country code of ip and, if city is true, the
+// English name of its city. Unknown values are returned as empty strings.
+func (db *DB) Location(ip net.IP, city bool) (string, string) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if city {
+		record, err := db.reader.City(ip)
+		if err != nil {
+			return "", ""
+		}
+		return record.Country.IsoCode, record.City.Names["en"]
+	}
+
+	record, err := db.reader.Country(ip)
+	if err != nil {
+		return "", ""
+	}
+	return record.Country.IsoCode, ""
+}
+
+// ASN returns the autonomous system number of ip and the name of its
+// organization. The number is 0 if it is unknown.
+func (db *DB) ASN(ip net.IP) (uint, string) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	record, err := db.reader.ASN(ip)
+	if err != nil {
+		return 0, ""
+	}
+	return record.AutonomousSystemNumber, record.AutonomousSystemOrganization
+}
+
+// Close closes the database
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.reader.Close()
+}
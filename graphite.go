@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/graphite"
+)
+
+// GraphiteConfig is a struct
+type GraphiteConfig struct {
+	Address  string        `long:"graphite.address" description:"Address of a Graphite carbon server to push the metrics to via the plaintext protocol, e.g. carbon:2003"`
+	Prefix   string        `long:"graphite.prefix" default:"nginx" description:"Prefix of the Graphite metric paths"`
+	Interval time.Duration `long:"graphite.interval" default:"60s" description:"Interval in which the metrics are pushed"`
+	UseTags  bool          `long:"graphite.use-tags" description:"Send the labels as Graphite tags instead of appending them to the metric path"`
+}
+
+// graphiteLogger logs the errors of the Graphite bridge
+type graphiteLogger struct{}
+
+func (graphiteLogger) Println(v ...interface{}) {
+	slog.Error("Error while pushing metrics to Graphite", "err", fmt.Sprint(v...))
+}
+
+// startGraphite pushes the metrics gathered by g to the carbon server of c
+// in its interval. Counters are pushed as they are, histograms and summaries
+// with their buckets or quantiles, sum and count. The returned function
+// pushes the metrics a last time and stops.
+func startGraphite(c GraphiteConfig, g prometheus.Gatherer) (func(context.Context) error, error) {
+	b, err := graphite.NewBridge(&graphite.Config{
+		URL:           c.Address,
+		Prefix:        c.Prefix,
+		Interval:      c.Interval,
+		UseTags:       c.UseTags,
+		Gatherer:      g,
+		Logger:        graphiteLogger{},
+		ErrorHandling: graphite.ContinueOnError,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		b.Run(ctx)
+	}()
+
+	slog.Info("Pushing metrics to Graphite", "address", c.Address, "interval", c.Interval)
+	return func(context.Context) error {
+		cancel()
+		<-stopped
+		return b.Push()
+	}, nil
+}
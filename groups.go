@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// groupPath returns the path the metrics of group are exposed on, which is
+// below the telemetry path like /metrics/shop
+func groupPath(telemetryPath, group string) string {
+	return path.Join(telemetryPath, group)
+}
+
+// newGroupRegistry returns the registry of the metrics of group, which are
+// those of its namespaces and the build info with the constant labels. The
+// metrics of the Go runtime and the process are left to the main registry.
+func newGroupRegistry(group string, labels map[string]string, e *exporter.Exporter) (*prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(labels, registry)
+	for _, c := range []prometheus.Collector{e.GroupCollector(group), newBuildInfo()} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// groupHandler serves the metrics of group from registry, only to its users
+// if it has any
+func groupHandler(c ListenConfig, group exporter.GroupConfig, registry *prometheus.Registry) http.Handler {
+	handler := metricsHandler(c, registry)
+	if len(group.BasicAuthUsers) == 0 {
+		return handler
+	}
+	return &basicAuth{realm: group.Name, users: group.BasicAuthUsers, handler: handler}
+}
+
+// basicAuth serves handler only to requests with the password of one of
+// users, which maps the users to the bcrypt hashes of their passwords
+type basicAuth struct {
+	realm   string
+	users   map[string]string
+	handler http.Handler
+
+	// verified caches the SHA-256 of the passwords verified already, as
+	// checking a bcrypt hash takes long on purpose
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte
+}
+
+func (a *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if ok && a.verify(user, password) {
+		a.handler.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+a.realm+`"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// verify tells whether password is the password of user
+func (a *basicAuth) verify(user, password string) bool {
+	hash, ok := a.users[user]
+	if !ok {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	a.mu.Lock()
+	cached, ok := a.verified[user]
+	a.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(cached[:], sum[:]) == 1 {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.verified == nil {
+		a.verified = make(map[string][sha256.Size]byte)
+	}
+	a.verified[user] = sum
+	return true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fileStatus is the state of a single log file or input as reported by the
+// exporter telemetry
+type fileStatus struct {
+	Namespace  string         `json:"namespace"`
+	File       string         `json:"file"`
+	LinesRead  float64        `json:"lines_read"`
+	ParsedOK   float64        `json:"parsed_ok"`
+	ParseError float64        `json:"parse_errors"`
+	Skipped    float64        `json:"skipped"`
+	LagBytes   *float64       `json:"lag_bytes,omitempty"`
+	Offset     *int64         `json:"offset,omitempty"`
+	Position   *tail.Position `json:"position,omitempty"`
+}
+
+// fileStatuses collects the status of all log files and inputs from the
+// telemetry metrics gathered by g, sorted by namespace and file
+func fileStatuses(g prometheus.Gatherer) ([]*fileStatus, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[[2]string]*fileStatus)
+	status := func(m *dto.Metric) *fileStatus {
+		var key [2]string
+		for _, l := range m.GetLabel() {
+			switch l.GetName() {
+			case "namespace":
+				key[0] = l.GetValue()
+			case "file":
+				key[1] = l.GetValue()
+			}
+		}
+
+		f, ok := files[key]
+		if !ok {
+			f = &fileStatus{Namespace: key[0], File: key[1]}
+			files[key] = f
+		}
+		return f
+	}
+
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "nginx_exporter_lines_read_total":
+				status(m).LinesRead = m.GetCounter().GetValue()
+			case "nginx_exporter_lines_parsed_total":
+				f := status(m)
+				for _, l := range m.GetLabel() {
+					if l.GetName() != "result" {
+						continue
+					}
+					switch l.GetValue() {
+					case "ok":
+						f.ParsedOK = m.GetCounter().GetValue()
+					case "error":
+						f.ParseError = m.GetCounter().GetValue()
+					case "skipped":
+						f.Skipped = m.GetCounter().GetValue()
+					}
+				}
+			case "nginx_exporter_tail_lag_bytes":
+				lag := m.GetGauge().GetValue()
+				status(m).LagBytes = &lag
+			}
+		}
+	}
+
+	result := make([]*fileStatus, 0, len(files))
+	for _, f := range files {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].File < result[j].File
+	})
+	return result, nil
+}
+
+var landingPage = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>nginx log exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.number { text-align: right; }
+code { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>nginx log exporter</h1>
+<p>Version {{.Version}} (revision {{.Revision}})</p>
+<p><a href="{{.TelemetryPath}}">Metrics</a>{{range .Groups}} &middot; <a href="{{.Path}}">Metrics of {{.Name}}</a>{{end}} &middot; <a href="/-/healthy">Health</a> &middot; <a href="/-/ready">Readiness</a> &middot; <a href="/debug/parse-errors">Parse errors</a></p>
+<h2>Namespaces</h2>
+<table>
+<tr><th>Namespace</th><th>Input</th><th>Format</th></tr>
+{{range .Namespaces}}<tr><td>{{.Name}}</td><td>{{.Input}}</td><td><code>{{.Format}}</code></td></tr>
+{{end}}</table>
+<h2>Files</h2>
+<table>
+<tr><th>Namespace</th><th>File</th><th>Lines read</th><th>Parsed</th><th>Parse errors</th><th>Skipped</th><th>Lag (bytes)</th></tr>
+{{range .Files}}<tr><td>{{.Namespace}}</td><td>{{.File}}</td><td class="number">{{.LinesRead}}</td><td class="number">{{.ParsedOK}}</td><td class="number">{{.ParseError}}</td><td class="number">{{.Skipped}}</td><td class="number">{{with .LagBytes}}{{.}}{{end}}</td></tr>
+{{else}}<tr><td colspan="7">No lines read yet</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// groupLink links the metrics of a group of namespaces on the landing page
+type groupLink struct {
+	Name string
+	Path string
+}
+
+// landingHandler serves the landing page at /, showing the namespaces and
+// the state of their files
+func landingHandler(e *exporter.Exporter, telemetryPath string, g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		files, err := fileStatuses(g)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Version       string
+			Revision      string
+			TelemetryPath string
+			Groups        []groupLink
+			Namespaces    []exporter.NamespaceStatus
+			Files         []*fileStatus
+		}{
+			Version:       Version,
+			Revision:      Revision,
+			TelemetryPath: telemetryPath,
+			Namespaces:    e.Namespaces(),
+			Files:         files,
+		}
+		for _, g := range e.Groups() {
+			data.Groups = append(data.Groups, groupLink{Name: g.Name, Path: groupPath(telemetryPath, g.Name)})
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingPage.Execute(w, data); err != nil {
+			slog.Error("Error while rendering landing page", "err", err)
+		}
+	})
+}
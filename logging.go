@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// LoggingConfig is a struct
+type LoggingConfig struct {
+	Level  string `long:"log.level" default:"info" choice:"debug" choice:"info" choice:"warn" choice:"error" description:"Only log messages with this severity or above, debug logs every parsed line"`
+	Format string `long:"log.format" default:"logfmt" choice:"logfmt" choice:"json" description:"Output format of log messages"`
+	File   string `long:"log.file" description:"File to append log messages to instead of writing them to stderr, e.g. for the Windows service"`
+}
+
+// setupLogging installs the default logger configured by c, which the log
+// package writes to as well
+func setupLogging(c LoggingConfig) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		panic(err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var w io.Writer = os.Stderr
+	if c.File != "" {
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			panic(err)
+		}
+		w = f
+	}
+
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if c.Format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
@@ -1,187 +1,320 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/denniswinter/nginx-log-exporter/tail"
+	"github.com/denniswinter/nginx-log-exporter/exporter"
 	"github.com/jessevdk/go-flags"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/satyrius/gonx"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
-// Metrics is a struct containing pointers
-type Metrics struct {
-	countTotal          *prometheus.CounterVec
-	bytesTotal          *prometheus.CounterVec
-	upstreamSeconds     *prometheus.SummaryVec
-	upstreamSecondsHist *prometheus.HistogramVec
-	upstreamBytes       *prometheus.CounterVec
-	responseSeconds     *prometheus.SummaryVec
-	responseSecondsHist *prometheus.HistogramVec
-	responseBytes       *prometheus.CounterVec
-	parseErrorsTotal    prometheus.Counter
-}
-
 // Config is a struct
 type Config struct {
-	LogConfig    LogConfig
+	exporter.Config
+	Version      bool `long:"version" description:"Print the version and exit"`
 	ListenConfig ListenConfig
-	Labels       map[string]string `short:"l" long:"labels" description:"Labels which to add to metrics"`
+	Logging      LoggingConfig
+	OTLP         OTLPConfig
+	RemoteWrite  RemoteWriteConfig
+	Pushgateway  PushgatewayConfig
+	Graphite     GraphiteConfig
+	Labels       map[string]string `short:"l" long:"labels" description:"Constant label added to all metrics, e.g. instance:edge-1, may be given more than once"`
 }
 
 // ListenConfig is a struct
 type ListenConfig struct {
-	ListenAddress string `long:"web.listen-address" default:"0.0.0.0:4040" description:"Address to listen on for web interface and telemetry."`
-	TelemetryPath string `long:"web.telemetry-path" default:"/metrics" description:"Path under which to expose metrics"`
+	ListenAddress          string        `long:"web.listen-address" default:"0.0.0.0:4040" description:"Address to listen on for web interface and telemetry, or a Unix domain socket like unix:///run/nginx-log-exporter.sock"`
+	SocketMode             string        `long:"web.socket-mode" default:"0660" description:"Octal permissions of the Unix domain socket of --web.listen-address"`
+	SystemdSocket          bool          `long:"web.systemd-socket" description:"Serve on the sockets passed by a systemd socket unit instead of --web.listen-address"`
+	DisableExporterMetrics bool          `long:"web.disable-exporter-metrics" description:"Exclude the metrics about the exporter process itself (go_*, process_* and promhttp_*) for a smaller scrape"`
+	CreatedSamples         bool          `long:"web.openmetrics-created-samples" description:"Add the _created samples holding the creation time of counters, histograms and summaries to the OpenMetrics exposition, which doubles the number of their series"`
+	EnablePprof            bool          `long:"web.enable-pprof" description:"Serve the profiling endpoints of net/http/pprof under /debug/pprof/"`
+	PprofListenAddress     string        `long:"web.pprof-listen-address" description:"Serve the profiling endpoints on this address, e.g. 127.0.0.1:6060, instead of the address of the web interface"`
+	TelemetryPath          string        `long:"web.telemetry-path" default:"/metrics" description:"Path under which to expose metrics"`
+	WebConfigFile          string        `long:"web.config.file" description:"Path to a web configuration file of the Prometheus exporter toolkit enabling TLS, client certificate verification or basic auth"`
+	ReadyTimeout           time.Duration `long:"web.ready-timeout" default:"1m" description:"Time after attaching to its input after which a namespace is ready without having processed a line"`
 }
 
-// LogConfig is a struct
-type LogConfig struct {
-	FileName string `short:"f" long:"filename" default:"/var/log/nginx/access.log" description:"Path to logfile to parse"`
-	Format   string `long:"format" default:"$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\" $request_time" description:"NGINX access_log format"`
-}
+func main() {
+	var cfg Config
+	p := flags.NewParser(&cfg, flags.Default)
+	p.SubcommandsOptional = true
 
-// Init Initializes a metrics struct
-func (m *Metrics) Init() {
-
-	labels := make([]string, 2)
-	labels[0] = "status"
-	labels[1] = "method"
-
-	m.countTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: "nginx",
-		Name:      "http_response_count_total",
-		Help:      "Amount of processes HTTP requests",
-	}, labels)
-
-	m.bytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: "nginx",
-		Name:      "http_response_bytes_total",
-		Help:      "Total amount of transferred bytes",
-	}, labels)
-
-	m.upstreamSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace: "nginx",
-		Name:      "http_upstream_time_seconds",
-		Help:      "Time needed by upstream servers to handle requests",
-	}, labels)
-
-	m.upstreamSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: "nginx",
-		Name:      "http_upstream_time_seconds_hist",
-		Help:      "Time needed by upstream servers to handle requests",
-	}, labels)
-
-	m.upstreamBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: "nginx",
-		Name:      "http_upstream_bytes",
-		Help:      "Amount of upstream bytes send",
-	}, labels)
-
-	m.responseSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace: "nginx",
-		Name:      "http_response_time_seconds",
-		Help:      "Time needed by nginx to handle requests",
-	}, labels)
-
-	m.responseSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: "nginx",
-		Name:      "http_response_time_seconds_hist",
-		Help:      "Time needed by nginx to handle requests",
-	}, labels)
-
-	m.responseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: "nginx",
-		Name:      "http_response_bytes",
-		Help:      "Amount of response bytes send",
-	}, labels)
-
-	m.parseErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
-		Namespace: "nginx",
-		Name:      "parse_errors_total",
-		Help:      "Total numbers of log file lines that could not be parsed",
-	})
+	bench := &BenchCommand{}
+	if _, err := p.AddCommand("bench", "Replay a log file through the pipeline", "Replay a log file through the pipeline of a namespace and report the throughput, allocations and time spent per stage", bench); err != nil {
+		panic(err)
+	}
 
-	prometheus.MustRegister(m.countTotal)
-	prometheus.MustRegister(m.bytesTotal)
-	prometheus.MustRegister(m.upstreamSeconds)
-	prometheus.MustRegister(m.upstreamSecondsHist)
-	prometheus.MustRegister(m.upstreamBytes)
-	prometheus.MustRegister(m.responseSeconds)
-	prometheus.MustRegister(m.responseSecondsHist)
-	prometheus.MustRegister(m.responseBytes)
-	prometheus.MustRegister(m.parseErrorsTotal)
-}
+	analyzeCmd := &AnalyzeCommand{}
+	if _, err := p.AddCommand("analyze", "Report on static log files", "Process static log files with the pipeline of a namespace and report the requests by status and method, the top routes, the latency percentiles and the bytes sent", analyzeCmd); err != nil {
+		panic(err)
+	}
 
-func main() {
-	var cfg Config
-	_, err := flags.ParseArgs(&cfg, os.Args)
+	checkConfigCmd := &CheckConfigCommand{}
+	if _, err := p.AddCommand("check-config", "Check the configuration", "Check the configuration given by the flags and the configuration file, including that the log files can be read, and exit with status 1 on problems", checkConfigCmd); err != nil {
+		panic(err)
+	}
 
-	if err != nil {
+	testFormatCmd := &TestFormatCommand{}
+	if _, err := p.AddCommand("test-format", "Parse sample lines with the format", "Parse sample log lines from a file or stdin with the configured format and print the extracted fields or the parse error of every line", testFormatCmd); err != nil {
 		panic(err)
 	}
 
-	t, err := tail.NewFollower(cfg.LogConfig.FileName)
-	if err != nil {
+	hashPasswordCmd := &HashPasswordCommand{}
+	if _, err := p.AddCommand("hash-password", "Hash a password for basic auth", "Read a password from stdin and print its bcrypt hash for basic_auth_users of the web configuration file", hashPasswordCmd); err != nil {
 		panic(err)
 	}
 
-	t.OnError(func(err error) {
+	if err := addServiceCommands(p); err != nil {
 		panic(err)
-	})
+	}
 
-	metrics := Metrics{}
-	metrics.Init()
+	if err := setEnvKeys(p); err != nil {
+		panic(err)
+	}
 
-	parser := gonx.NewParser(cfg.LogConfig.Format)
+	_, err := p.ParseArgs(os.Args[1:])
 
-	go processLogFile(cfg, t, parser, &metrics)
+	if err != nil {
+		panic(err)
+	}
 
-	log.Printf("Running HTTP server on address %s\n", cfg.ListenConfig.ListenAddress)
+	if cfg.Version {
+		fmt.Println(versionString())
+		return
+	}
 
-	http.Handle(cfg.ListenConfig.TelemetryPath, prometheus.Handler())
-	http.ListenAndServe(cfg.ListenConfig.ListenAddress, nil)
-}
+	if p.Active != nil && p.Active.Name == "hash-password" {
+		if err := hashPassword(hashPasswordCmd, os.Stdin, os.Stdout); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	setupLogging(cfg.Logging)
 
-func processLogFile(cfg Config, t tail.Follower, parser *gonx.Parser, metrics *Metrics) {
-	for line := range t.Lines() {
-		entry, err := parser.ParseString(line.Text)
+	if ok, err := runServiceCommand(p.Active); ok {
 		if err != nil {
-			log.Fatalf("Error while parsing line '%s': '%s'", line.Text, err)
-			metrics.parseErrorsTotal.Inc()
-			continue
+			panic(err)
+		}
+		return
+	}
+
+	cfg.SetOptions = explicitOptions(p)
+	cfg.FormatSet = cfg.SetOptions["format"]
+
+	if p.Active != nil && p.Active.Name == "check-config" {
+		if !checkConfig(cfg, os.Stdout) {
+			os.Exit(1)
 		}
+		return
+	}
 
-		labelValues := make([]string, 2)
+	e, err := exporter.New(cfg.Config)
+	if err != nil {
+		panic(err)
+	}
+	registry, err := newRegistry(cfg.ListenConfig, cfg.Labels, e.Collector())
+	if err != nil {
+		panic(err)
+	}
+
+	if p.Active != nil && p.Active.Name == "analyze" {
+		if err := analyze(analyzeCmd, e); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if p.Active != nil && p.Active.Name == "test-format" {
+		ok, err := testFormat(testFormatCmd, e)
+		if err != nil {
+			panic(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
 
-		if status, err := entry.Field("status"); err == nil {
-			labelValues[0] = status
+	if p.Active != nil && p.Active.Name == "bench" {
+		if err := runBench(bench, e); err != nil {
+			panic(err)
 		}
 
-		if request, err := entry.Field("request"); err == nil {
-			chunks := strings.Fields(request)
-			labelValues[1] = chunks[0]
+		if cfg.Pushgateway.URL != "" {
+			if err := pushToGateway(cfg.Pushgateway, registry); err != nil {
+				panic(err)
+			}
 		}
+		return
+	}
 
-		log.Printf("Parsed line '%s'", line.Text)
+	if err := web.Validate(cfg.ListenConfig.WebConfigFile); err != nil {
+		panic(err)
+	}
 
-		metrics.countTotal.WithLabelValues(labelValues...).Inc()
+	// pushers push the metrics a last time and stop on shutdown
+	var pushers []func(context.Context) error
+	if cfg.OTLP.Endpoint != "" {
+		stop, err := startOTLP(cfg.OTLP, registry)
+		if err != nil {
+			panic(err)
+		}
+		pushers = append(pushers, stop)
+	}
+	if cfg.RemoteWrite.URL != "" {
+		pushers = append(pushers, startRemoteWrite(cfg.RemoteWrite, registry))
+	}
+	if cfg.Graphite.Address != "" {
+		stop, err := startGraphite(cfg.Graphite, registry)
+		if err != nil {
+			panic(err)
+		}
+		pushers = append(pushers, stop)
+	}
 
-		if bytes, err := entry.FloatField("body_bytes_sent"); err == nil {
-			metrics.bytesTotal.WithLabelValues(labelValues...).Add(bytes)
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- e.Run(ctx)
+	}()
+
+	slog.Info("Starting nginx-log-exporter", "version", Version, "revision", Revision)
+	// An own mux keeps handlers registered on http.DefaultServeMux by imported
+	// packages off the web interface
+	mux := http.NewServeMux()
+	// The metrics of groups restricted to their own users are still
+	// pushed, but only exposed on the paths of their groups
+	metricsRegistry := registry
+	if e.Restricted() {
+		metricsRegistry, err = newRegistry(cfg.ListenConfig, cfg.Labels, e.UnrestrictedCollector())
+		if err != nil {
+			panic(err)
 		}
+	}
+	mux.Handle(cfg.ListenConfig.TelemetryPath, metricsHandler(cfg.ListenConfig, metricsRegistry))
+	for _, g := range e.Groups() {
+		groupRegistry, err := newGroupRegistry(g.Name, cfg.Labels, e)
+		if err != nil {
+			panic(err)
+		}
+		mux.Handle(groupPath(cfg.ListenConfig.TelemetryPath, g.Name), groupHandler(cfg.ListenConfig, g, groupRegistry))
+	}
+	mux.Handle("/", landingHandler(e, cfg.ListenConfig.TelemetryPath, metricsRegistry))
+	mux.Handle("/debug/parse-errors", e.ParseErrorsHandler())
+	mux.Handle("/debug/entries", e.EntriesHandler())
+	mux.Handle("/api/v1/status", statusHandler(e, metricsRegistry))
+	mux.Handle("/-/healthy", e.HealthyHandler())
+	mux.Handle("/-/ready", e.ReadyHandler(cfg.ListenConfig.ReadyTimeout))
+
+	if cfg.ListenConfig.EnablePprof {
+		startPprof(cfg.ListenConfig, mux)
+	}
+
+	ls, err := listeners(cfg.ListenConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	srv := &http.Server{Handler: mux}
+	for _, l := range ls {
+		go func(l net.Listener) {
+			if err := serve(cfg.ListenConfig, srv, l); err != http.ErrServerClosed {
+				panic(err)
+			}
+		}(l)
+	}
+
+	handleUSR1(e, registry)
 
-		if upstreamTime, err := entry.FloatField("upstream_response_time"); err == nil {
-			metrics.upstreamSeconds.WithLabelValues(labelValues...).Observe(upstreamTime)
-			metrics.upstreamSecondsHist.WithLabelValues(labelValues...).Observe(upstreamTime)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	// On Windows the service control manager stops the exporter instead
+	stopService, err := runService(signals, cfg.ShutdownTimeout)
+	if err != nil {
+		panic(err)
+	}
+
+	select {
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig)
+	case err := <-stopped:
+		panic(err)
+	}
+
+	shutdown(cfg, stop, stopped, srv, pushers)
+	stopService()
+}
+
+// newRegistry returns the registry of exposed and pushed metrics, which are
+// those of collector, the build info and, unless disabled, the metrics of the
+// Go runtime and the process. All of them carry the constant labels.
+func newRegistry(c ListenConfig, labels map[string]string, collector prometheus.Collector) (*prometheus.Registry, error) {
+	cs := []prometheus.Collector{collector, newBuildInfo()}
+	if !c.DisableExporterMetrics {
+		cs = append(cs,
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	registry := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(labels, registry)
+	for _, c := range cs {
+		if err := reg.Register(c); err != nil {
+			return nil, err
 		}
+	}
+	return registry, nil
+}
+
+// metricsHandler serves the metrics of registry, instrumented with the
+// promhttp metrics unless the exporter metrics are disabled
+func metricsHandler(c ListenConfig, registry *prometheus.Registry) http.Handler {
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: c.CreatedSamples,
+	})
 
-		if responseTime, err := entry.FloatField("request_time"); err == nil {
-			metrics.responseSeconds.WithLabelValues(labelValues...).Observe(responseTime)
-			metrics.responseSecondsHist.WithLabelValues(labelValues...).Observe(responseTime)
+	if c.DisableExporterMetrics {
+		return handler
+	}
+	return promhttp.InstrumentMetricHandler(registry, handler)
+}
+
+// shutdown stops the exporter, which waits for the lines already read to be
+// processed and saves the positions, then pushes the metrics a last time and
+// stops srv once its requests are done
+func shutdown(cfg Config, stop context.CancelFunc, stopped <-chan error, srv *http.Server, pushers []func(context.Context) error) {
+	// The exporter waits up to the same timeout for its lines
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	stop()
+	if err := <-stopped; err != nil {
+		slog.Error("Error while stopping the exporter", "err", err)
+	}
+
+	for _, stop := range pushers {
+		if err := stop(ctx); err != nil {
+			slog.Error("Error while pushing metrics", "err", err)
 		}
 	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Error while shutting down HTTP server", "err", err)
+	}
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	promexporter "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OTLPConfig is a struct
+type OTLPConfig struct {
+	Endpoint string            `long:"otlp.endpoint" description:"URL of an OpenTelemetry collector to push the metrics to via OTLP, e.g. http://otel-collector:4317 for gRPC or http://otel-collector:4318/v1/metrics for HTTP"`
+	Protocol string            `long:"otlp.protocol" default:"grpc" choice:"grpc" choice:"http" description:"OTLP transport, grpc or http with protobuf encoding"`
+	Interval time.Duration     `long:"otlp.interval" default:"30s" description:"Interval in which the metrics are pushed"`
+	Headers  map[string]string `long:"otlp.header" description:"Header sent with every push, e.g. authorization:Bearer <token>"`
+}
+
+// startOTLP pushes the metrics gathered by g to the collector of c in its
+// interval. The returned function pushes the metrics a last time and stops.
+func startOTLP(c OTLPConfig, g prometheus.Gatherer) (func(context.Context) error, error) {
+	ctx := context.Background()
+
+	var exporter sdkmetric.Exporter
+	var err error
+	switch c.Protocol {
+	case "grpc":
+		exporter, err = otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithEndpointURL(c.Endpoint),
+			otlpmetricgrpc.WithHeaders(c.Headers),
+		)
+	case "http":
+		exporter, err = otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpointURL(c.Endpoint),
+			otlpmetrichttp.WithHeaders(c.Headers),
+		)
+	default:
+		err = fmt.Errorf("unknown OTLP protocol '%s'", c.Protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(c.Interval),
+		sdkmetric.WithProducer(promexporter.NewMetricProducer(promexporter.WithGatherer(g))),
+	)
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "nginx-log-exporter"),
+			attribute.String("service.version", Version),
+		)),
+	)
+
+	slog.Info("Pushing metrics via OTLP", "endpoint", c.Endpoint, "protocol", c.Protocol, "interval", c.Interval)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPasswordCommand is a struct
+type HashPasswordCommand struct {
+	Cost int `long:"cost" default:"10" description:"bcrypt cost of the hash, every increment doubles the time needed to check a password"`
+}
+
+// hashPassword reads a password from the first line of r and writes its
+// bcrypt hash for basic_auth_users of the web configuration file to w
+func hashPassword(c *HashPasswordCommand, r io.Reader, w io.Writer) error {
+	password, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return fmt.Errorf("no password given on stdin")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), c.Cost)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(hash))
+	return err
+}
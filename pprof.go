@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofPath is the path the profiling endpoints are served under
+const pprofPath = "/debug/pprof/"
+
+// registerPprof adds the profiling endpoints of net/http/pprof to mux
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc(pprofPath, pprof.Index)
+	mux.HandleFunc(pprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPath+"trace", pprof.Trace)
+}
+
+// startPprof serves the profiling endpoints on mux or, if c has a separate
+// pprof address, on a server of their own
+func startPprof(c ListenConfig, mux *http.ServeMux) {
+	if c.PprofListenAddress == "" {
+		registerPprof(mux)
+		return
+	}
+
+	pprofMux := http.NewServeMux()
+	registerPprof(pprofMux)
+
+	slog.Info("Serving pprof endpoints", "address", c.PprofListenAddress)
+	go func() {
+		if err := http.ListenAndServe(c.PprofListenAddress, pprofMux); err != nil {
+			panic(err)
+		}
+	}()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushgatewayConfig is a struct
+type PushgatewayConfig struct {
+	URL      string            `long:"push.gateway-url" description:"URL of a Pushgateway to push the metrics to after replaying a file with bench, e.g. http://pushgateway:9091"`
+	Job      string            `long:"push.job" default:"nginx-log-exporter" description:"Job label of the pushed metrics"`
+	Grouping map[string]string `long:"push.grouping" description:"Grouping label of the pushed metrics, e.g. instance:web-01"`
+}
+
+// pushToGateway replaces the metrics of the job and grouping of c on the
+// Pushgateway with the metrics gathered by g
+func pushToGateway(c PushgatewayConfig, g prometheus.Gatherer) error {
+	p := push.New(c.URL, c.Job).Gatherer(g)
+	for name, value := range c.Grouping {
+		p = p.Grouping(name, value)
+	}
+
+	if err := p.Push(); err != nil {
+		return err
+	}
+
+	slog.Info("Pushed metrics to Pushgateway", "url", c.URL, "job", c.Job)
+	return nil
+}
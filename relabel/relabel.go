@@ -0,0 +1,242 @@
+// Package relabel rewrites the label values of a log line with rules like
+// the relabel_configs of Prometheus. Rules set labels from the values of
+// other labels or log variables, empty them or drop the whole line.
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Action is the action to be performed on a relabeling rule match
+type Action string
+
+const (
+	// Replace sets the target label to the replacement expanded with the
+	// regex matches
+	Replace Action = "replace"
+	// Lowercase sets the target label to the lowercased source value
+	Lowercase Action = "lowercase"
+	// Uppercase sets the target label to the uppercased source value
+	Uppercase Action = "uppercase"
+	// Map sets the target label to the mapped source value
+	Map Action = "map"
+	// HashMod sets the target label to the modulus of a hash of the source value
+	HashMod Action = "hashmod"
+	// Keep drops lines whose source value does not match the regex from all
+	// metrics, like a filter
+	Keep Action = "keep"
+	// Drop drops lines whose source value matches the regex from all
+	// metrics, like a filter
+	Drop Action = "drop"
+	// BlankUnlessMatch empties the target label unless the source value
+	// matches the regex, the line is still counted. Unlike labelkeep of
+	// Prometheus it matches label values, not label names.
+	BlankUnlessMatch Action = "blank_unless_match"
+	// BlankIfMatch empties the target label if the source value matches the
+	// regex, the line is still counted. Unlike labeldrop of Prometheus it
+	// matches label values, not label names.
+	BlankIfMatch Action = "blank_if_match"
+)
+
+// DefaultConfig is the default relabeling rule
+var DefaultConfig = Config{
+	Action:      Replace,
+	Separator:   ";",
+	Regex:       MustNewRegexp("(.*)"),
+	Replacement: "$1",
+}
+
+// Labels maps label names to their values
+type Labels map[string]string
+
+// Config is a relabeling rule which is applied to the labels of a log line
+type Config struct {
+	SourceLabels []string          `yaml:"source_labels"`
+	Separator    string            `yaml:"separator"`
+	Regex        Regexp            `yaml:"regex"`
+	Modulus      uint64            `yaml:"modulus"`
+	TargetLabel  string            `yaml:"target_label"`
+	Replacement  string            `yaml:"replacement"`
+	Mapping      map[string]string `yaml:"mapping"`
+	Action       Action            `yaml:"action"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+func (c *Config) validate() error {
+	if len(c.SourceLabels) == 0 {
+		return fmt.Errorf("relabel configuration for %s action requires 'source_labels'", c.Action)
+	}
+
+	switch c.Action {
+	case BlankUnlessMatch, BlankIfMatch:
+		// The label of a single source label is emptied by default
+		if c.TargetLabel == "" && len(c.SourceLabels) == 1 {
+			c.TargetLabel = c.SourceLabels[0]
+		}
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel configuration for %s action requires 'target_label'", c.Action)
+		}
+	case Replace, Lowercase, Uppercase, Map, HashMod:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel configuration for %s action requires 'target_label'", c.Action)
+		}
+	case Keep, Drop:
+	default:
+		return fmt.Errorf("unknown relabel action '%s'", c.Action)
+	}
+
+	if c.Action == HashMod && c.Modulus == 0 {
+		return fmt.Errorf("relabel configuration for hashmod action requires 'modulus'")
+	}
+	if c.Action == Map && len(c.Mapping) == 0 {
+		return fmt.Errorf("relabel configuration for map action requires 'mapping'")
+	}
+
+	return nil
+}
+
+// Regexp encapsulates a regexp.Regexp and makes it YAML unmarshalable
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp creates a new anchored Regexp
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+// MustNewRegexp works like NewRegexp, but panics if the regular expression
+// does not compile
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	return re.original, nil
+}
+
+// UnmarshalFlag implements the flags.Unmarshaler interface
+func (re *Regexp) UnmarshalFlag(value string) error {
+	r, err := NewRegexp(value)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalFlag implements the flags.Marshaler interface
+func (re Regexp) MarshalFlag() (string, error) {
+	return re.original, nil
+}
+
+// Targets returns the names of all labels set by cfgs in order of their
+// first appearance
+func Targets(cfgs []*Config) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, cfg := range cfgs {
+		if cfg.TargetLabel != "" && !seen[cfg.TargetLabel] {
+			seen[cfg.TargetLabel] = true
+			targets = append(targets, cfg.TargetLabel)
+		}
+	}
+	return targets
+}
+
+// Process applies cfgs to labels in order. Source labels not present in
+// labels are resolved with lookup. It returns false if the line should be
+// dropped.
+func Process(labels Labels, cfgs []*Config, lookup func(string) string) bool {
+	for _, cfg := range cfgs {
+		if !relabel(labels, cfg, lookup) {
+			return false
+		}
+	}
+	return true
+}
+
+func relabel(labels Labels, cfg *Config, lookup func(string) string) bool {
+	values := make([]string, 0, len(cfg.SourceLabels))
+	for _, name := range cfg.SourceLabels {
+		value, ok := labels[name]
+		if !ok {
+			value = lookup(name)
+		}
+		values = append(values, value)
+	}
+	val := strings.Join(values, cfg.Separator)
+
+	switch cfg.Action {
+	case Drop:
+		if cfg.Regex.MatchString(val) {
+			return false
+		}
+	case Keep:
+		if !cfg.Regex.MatchString(val) {
+			return false
+		}
+	case BlankIfMatch:
+		if cfg.Regex.MatchString(val) {
+			labels[cfg.TargetLabel] = ""
+		}
+	case BlankUnlessMatch:
+		if !cfg.Regex.MatchString(val) {
+			labels[cfg.TargetLabel] = ""
+		}
+	case Replace:
+		indexes := cfg.Regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		labels[cfg.TargetLabel] = string(cfg.Regex.ExpandString([]byte{}, cfg.Replacement, val, indexes))
+	case Lowercase:
+		labels[cfg.TargetLabel] = strings.ToLower(val)
+	case Uppercase:
+		labels[cfg.TargetLabel] = strings.ToUpper(val)
+	case Map:
+		if mapped, ok := cfg.Mapping[val]; ok {
+			labels[cfg.TargetLabel] = mapped
+		}
+	case HashMod:
+		sum := md5.Sum([]byte(val))
+		mod := binary.BigEndian.Uint64(sum[8:]) % cfg.Modulus
+		labels[cfg.TargetLabel] = fmt.Sprintf("%d", mod)
+	}
+
+	return true
+}
@@ -0,0 +1,169 @@
+package relabel
+
+import (
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestProcess(t *testing.T) {
+	lookup := func(name string) string {
+		return map[string]string{"request_uri": "/healthz", "http_user_agent": "Googlebot/2.1"}[name]
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		labels Labels
+		want   Labels
+		keep   bool
+	}{
+		{
+			name:   "replace",
+			config: "source_labels: [status]\nregex: '(\\d)..'\ntarget_label: status_class\nreplacement: '${1}xx'",
+			labels: Labels{"status": "404"},
+			want:   Labels{"status": "404", "status_class": "4xx"},
+			keep:   true,
+		},
+		{
+			name:   "replace without match",
+			config: "source_labels: [status]\nregex: '(\\d)..'\ntarget_label: status_class\nreplacement: '${1}xx'",
+			labels: Labels{"status": "-"},
+			want:   Labels{"status": "-"},
+			keep:   true,
+		},
+		{
+			name:   "replace joined source labels",
+			config: "source_labels: [method, status]\ntarget_label: key",
+			labels: Labels{"method": "GET", "status": "200"},
+			want:   Labels{"method": "GET", "status": "200", "key": "GET;200"},
+			keep:   true,
+		},
+		{
+			name:   "lowercase",
+			config: "source_labels: [method]\ntarget_label: method\naction: lowercase",
+			labels: Labels{"method": "GET"},
+			want:   Labels{"method": "get"},
+			keep:   true,
+		},
+		{
+			name:   "uppercase",
+			config: "source_labels: [method]\ntarget_label: method\naction: uppercase",
+			labels: Labels{"method": "get"},
+			want:   Labels{"method": "GET"},
+			keep:   true,
+		},
+		{
+			name:   "map",
+			config: "source_labels: [status]\ntarget_label: result\naction: map\nmapping: {'200': ok}",
+			labels: Labels{"status": "200"},
+			want:   Labels{"status": "200", "result": "ok"},
+			keep:   true,
+		},
+		{
+			name:   "map without mapping",
+			config: "source_labels: [status]\ntarget_label: result\naction: map\nmapping: {'200': ok}",
+			labels: Labels{"status": "500"},
+			want:   Labels{"status": "500"},
+			keep:   true,
+		},
+		{
+			name:   "hashmod",
+			config: "source_labels: [remote_addr]\ntarget_label: shard\naction: hashmod\nmodulus: 1",
+			labels: Labels{"remote_addr": "1.2.3.4"},
+			want:   Labels{"remote_addr": "1.2.3.4", "shard": "0"},
+			keep:   true,
+		},
+		{
+			name:   "drop matching line",
+			config: "source_labels: [request_uri]\nregex: /healthz\naction: drop",
+			labels: Labels{},
+			keep:   false,
+		},
+		{
+			name:   "keep matching line",
+			config: "source_labels: [request_uri]\nregex: /healthz\naction: keep",
+			labels: Labels{},
+			want:   Labels{},
+			keep:   true,
+		},
+		{
+			name:   "blank_if_match matching value",
+			config: "source_labels: [http_user_agent]\nregex: '.*bot.*'\naction: blank_if_match",
+			labels: Labels{"http_user_agent": "Googlebot/2.1"},
+			want:   Labels{"http_user_agent": ""},
+			keep:   true,
+		},
+		{
+			name:   "blank_if_match other value",
+			config: "source_labels: [http_user_agent]\nregex: '.*bot.*'\naction: blank_if_match",
+			labels: Labels{"http_user_agent": "curl/8.0"},
+			want:   Labels{"http_user_agent": "curl/8.0"},
+			keep:   true,
+		},
+		{
+			name:   "blank_unless_match other value",
+			config: "source_labels: [host]\nregex: '.*\\.example\\.com'\naction: blank_unless_match",
+			labels: Labels{"host": "10.0.0.1"},
+			want:   Labels{"host": ""},
+			keep:   true,
+		},
+		{
+			name:   "blank_if_match target from looked up source",
+			config: "source_labels: [http_user_agent]\nregex: '.*bot.*'\ntarget_label: device\naction: blank_if_match",
+			labels: Labels{"device": "other"},
+			want:   Labels{"device": ""},
+			keep:   true,
+		},
+	}
+
+	for _, test := range tests {
+		var cfg Config
+		if err := yaml.Unmarshal([]byte(test.config), &cfg); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		keep := Process(test.labels, []*Config{&cfg}, lookup)
+		if keep != test.keep {
+			t.Errorf("%s: kept %t, want %t", test.name, keep, test.keep)
+			continue
+		}
+		if keep && !reflect.DeepEqual(test.labels, test.want) {
+			t.Errorf("%s: labels %v, want %v", test.name, test.labels, test.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config string
+		err    bool
+	}{
+		{config: "source_labels: [status]\ntarget_label: x", err: false},
+		{config: "target_label: x", err: true},
+		{config: "source_labels: [status]", err: true},
+		{config: "source_labels: [status]\naction: drop", err: false},
+		{config: "source_labels: [status]\naction: blank_if_match", err: false},
+		{config: "source_labels: [method, status]\naction: blank_if_match", err: true},
+		{config: "source_labels: [status]\ntarget_label: x\naction: hashmod", err: true},
+		{config: "source_labels: [status]\ntarget_label: x\naction: map", err: true},
+		{config: "source_labels: [status]\naction: unknown", err: true},
+		{config: "source_labels: [status]\ntarget_label: x\nregex: '('", err: true},
+	}
+
+	for _, test := range tests {
+		var cfg Config
+		err := yaml.Unmarshal([]byte(test.config), &cfg)
+		if (err != nil) != test.err {
+			t.Errorf("%q: error %v, want error %t", test.config, err, test.err)
+		}
+	}
+}
+
+func TestTargets(t *testing.T) {
+	cfgs := []*Config{{TargetLabel: "b"}, {TargetLabel: ""}, {TargetLabel: "a"}, {TargetLabel: "b"}}
+	if got, want := Targets(cfgs), []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriteConfig is a struct
+type RemoteWriteConfig struct {
+	URL         string            `long:"remote-write.url" description:"URL of a Prometheus remote_write endpoint to push the metrics to, e.g. https://prometheus.example.com/api/v1/write"`
+	Interval    time.Duration     `long:"remote-write.interval" default:"30s" description:"Interval in which the metrics are pushed"`
+	Timeout     time.Duration     `long:"remote-write.timeout" default:"10s" description:"Timeout of a single push"`
+	MaxRetries  int               `long:"remote-write.max-retries" default:"5" description:"Number of retries of a failed push, with a backoff doubling from 500ms"`
+	Username    string            `long:"remote-write.username" description:"User name to authenticate with via basic auth"`
+	Password    string            `long:"remote-write.password" description:"Password to authenticate with via basic auth"`
+	BearerToken string            `long:"remote-write.bearer-token" description:"Bearer token to authenticate with"`
+	Labels      map[string]string `long:"remote-write.label" description:"Label added to every pushed series, e.g. instance:edge-01, as there is no scrape adding job and instance"`
+}
+
+// remoteWriteRetryBackoff is the backoff before the first retry of a push
+const remoteWriteRetryBackoff = 500 * time.Millisecond
+
+// remoteWriter pushes the metrics gathered from a registry to a remote_write
+// endpoint
+type remoteWriter struct {
+	config   RemoteWriteConfig
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// startRemoteWrite pushes the metrics gathered by g to the endpoint of c in
+// its interval. The returned function pushes the metrics a last time and
+// stops.
+func startRemoteWrite(c RemoteWriteConfig, g prometheus.Gatherer) func(context.Context) error {
+	w := &remoteWriter{
+		config:   c,
+		gatherer: g,
+		client:   &http.Client{Timeout: c.Timeout},
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	slog.Info("Pushing metrics via remote_write", "url", c.URL, "interval", c.Interval)
+	go w.run()
+
+	return w.stop
+}
+
+func (w *remoteWriter) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if err := w.push(context.Background()); err != nil {
+				slog.Error("Error while pushing metrics via remote_write", "url", w.config.URL, "err", err)
+			}
+		}
+	}
+}
+
+func (w *remoteWriter) stop(ctx context.Context) error {
+	close(w.done)
+	<-w.stopped
+	return w.push(ctx)
+}
+
+// push sends the current metrics, retrying with backoff on network errors,
+// rate limiting and server errors
+func (w *remoteWriter) push(ctx context.Context) error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	body := s2.EncodeSnappy(nil, encodeWriteRequest(families, w.config.Labels, time.Now()))
+
+	backoff := remoteWriteRetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.send(ctx, body)
+		if err == nil || !retry || attempt >= w.config.MaxRetries {
+			return err
+		}
+
+		slog.Debug("Retrying remote_write push", "url", w.config.URL, "err", err, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// send posts a single compressed write request and reports whether a
+// failure is worth a retry
+func (w *remoteWriter) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("User-Agent", "nginx-log-exporter/"+Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.config.Username != "" {
+		req.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+	if w.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.config.BearerToken)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// remoteLabel is a label of a pushed series
+type remoteLabel struct {
+	name, value string
+}
+
+// encodeWriteRequest encodes families as protobuf WriteRequest of the
+// remote_write protocol. Histograms and summaries are split into their
+// series like in the text format.
+func encodeWriteRequest(families []*dto.MetricFamily, extra map[string]string, now time.Time) []byte {
+	ts := now.UnixNano() / int64(time.Millisecond)
+
+	var buf []byte
+	series := func(name string, labels []remoteLabel, value float64) {
+		all := append([]remoteLabel{{"__name__", name}}, labels...)
+		for n, v := range extra {
+			all = append(all, remoteLabel{n, v})
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+		var s []byte
+		for _, l := range all {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+
+			s = protowire.AppendTag(s, 1, protowire.BytesType)
+			s = protowire.AppendBytes(s, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts))
+
+		s = protowire.AppendTag(s, 2, protowire.BytesType)
+		s = protowire.AppendBytes(s, sample)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, s)
+	}
+
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := make([]remoteLabel, 0, len(m.GetLabel())+1)
+			for _, l := range m.GetLabel() {
+				labels = append(labels, remoteLabel{l.GetName(), l.GetValue()})
+			}
+			with := func(n, v string) []remoteLabel {
+				return append(append([]remoteLabel{}, labels...), remoteLabel{n, v})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				series(name, labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				series(name, labels, m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				inf := false
+				for _, b := range h.GetBucket() {
+					inf = math.IsInf(b.GetUpperBound(), 1)
+					series(name+"_bucket", with("le", formatFloat(b.GetUpperBound())), float64(b.GetCumulativeCount()))
+				}
+				if !inf {
+					series(name+"_bucket", with("le", "+Inf"), float64(h.GetSampleCount()))
+				}
+				series(name+"_sum", labels, h.GetSampleSum())
+				series(name+"_count", labels, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					series(name, with("quantile", formatFloat(q.GetQuantile())), q.GetValue())
+				}
+				series(name+"_sum", labels, s.GetSampleSum())
+				series(name+"_count", labels, float64(s.GetSampleCount()))
+			default:
+				series(name, labels, m.GetUntyped().GetValue())
+			}
+		}
+	}
+
+	return buf
+}
+
+// formatFloat formats the le and quantile labels like the text format
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// addServiceCommands adds no commands, as the exporter only runs as a
+// service on Windows
+func addServiceCommands(p *flags.Parser) error {
+	return nil
+}
+
+// runServiceCommand reports that none of the Windows service commands is
+// active
+func runServiceCommand(active *flags.Command) (bool, error) {
+	return false, nil
+}
+
+// runService does nothing, as the exporter only runs as a service on
+// Windows
+func runService(signals chan<- os.Signal, stopTimeout time.Duration) (func(), error) {
+	return func() {}, nil
+}
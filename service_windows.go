@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the default name of the Windows service
+const serviceName = "nginx-log-exporter"
+
+// InstallServiceCommand is a struct
+type InstallServiceCommand struct {
+	Name        string `long:"name" default:"nginx-log-exporter" description:"Name of the service"`
+	DisplayName string `long:"display-name" default:"nginx log exporter" description:"Name of the service shown by the services console"`
+	Args        struct {
+		Flags []string `positional-arg-name:"flags" description:"Flags the service runs the exporter with, given after --"`
+	} `positional-args:"yes"`
+}
+
+// UninstallServiceCommand is a struct
+type UninstallServiceCommand struct {
+	Name string `long:"name" default:"nginx-log-exporter" description:"Name of the service"`
+}
+
+var (
+	installServiceCmd   = &InstallServiceCommand{}
+	uninstallServiceCmd = &UninstallServiceCommand{}
+)
+
+// addServiceCommands adds the commands installing and uninstalling the
+// Windows service to p
+func addServiceCommands(p *flags.Parser) error {
+	if _, err := p.AddCommand("install-service", "Install the Windows service", "Install a Windows service starting the exporter with the flags given after -- on boot and restarting it when it fails", installServiceCmd); err != nil {
+		return err
+	}
+	_, err := p.AddCommand("uninstall-service", "Uninstall the Windows service", "Stop and remove the Windows service of the exporter", uninstallServiceCmd)
+	return err
+}
+
+// runServiceCommand runs the active command if it is one of the Windows
+// service commands and reports whether it was
+func runServiceCommand(active *flags.Command) (bool, error) {
+	if active == nil {
+		return false, nil
+	}
+
+	switch active.Name {
+	case "install-service":
+		return true, installService(installServiceCmd)
+	case "uninstall-service":
+		return true, uninstallService(uninstallServiceCmd)
+	}
+	return false, nil
+}
+
+// installService installs the service described by c, which runs the
+// current executable
+func installService(c *InstallServiceCommand) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(c.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", c.Name)
+	}
+
+	s, err := m.CreateService(c.Name, exe, mgr.Config{
+		DisplayName: c.DisplayName,
+		Description: "Prometheus exporter for the access logs of nginx",
+		StartType:   mgr.StartAutomatic,
+	}, c.Args.Flags...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// The service is restarted after failures, which are reset after a day
+	actions := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 10 * time.Second}}
+	if err := s.SetRecoveryActions(actions, uint32((24 * time.Hour).Seconds())); err != nil {
+		s.Delete()
+		return err
+	}
+
+	fmt.Printf("Installed service %s running %s %v\n", c.Name, exe, c.Args.Flags)
+	return nil
+}
+
+// uninstallService stops and removes the service described by c
+func uninstallService(c *UninstallServiceCommand) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(c.Name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %v", c.Name, err)
+	}
+	defer s.Close()
+
+	// A stopped service cannot be stopped again, it is removed anyway
+	s.Control(svc.Stop)
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Uninstalled service %s\n", c.Name)
+	return nil
+}
+
+// service handles the requests of the Windows service control manager. Stop
+// and shutdown requests are passed on to signals as SIGTERM, the service is
+// stopped once done is closed.
+type service struct {
+	signals     chan<- os.Signal
+	stopTimeout time.Duration
+	done        chan struct{}
+}
+
+// Execute implements svc.Handler
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: uint32(s.stopTimeout.Milliseconds())}
+				select {
+				case s.signals <- syscall.SIGTERM:
+				default:
+					// A shutdown is pending already
+				}
+				<-s.done
+				return false, 0
+			}
+		case <-s.done:
+			return false, 0
+		}
+	}
+}
+
+// runService runs the exporter as Windows service if it was started by the
+// service control manager, which is asked to wait up to stopTimeout for the
+// exporter to shut down. The returned function reports the service as
+// stopped and is called after shutting down.
+func runService(signals chan<- os.Signal, stopTimeout time.Duration) (func(), error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return func() {}, err
+	}
+
+	s := &service{signals: signals, stopTimeout: stopTimeout, done: make(chan struct{})}
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run(serviceName, s); err != nil {
+			slog.Error("Error while running as Windows service", "err", err)
+		}
+	}()
+
+	return func() {
+		close(s.done)
+		<-exited
+	}, nil
+}
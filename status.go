@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// startTime is the time the exporter was started at
+var startTime = time.Now()
+
+// status is the state of the exporter served by /api/v1/status
+type status struct {
+	Version       string                     `json:"version"`
+	Revision      string                     `json:"revision"`
+	StartTime     time.Time                  `json:"start_time"`
+	UptimeSeconds float64                    `json:"uptime_seconds"`
+	Namespaces    []exporter.NamespaceStatus `json:"namespaces"`
+	Files         []*fileStatus              `json:"files"`
+	Cardinality   map[string]int             `json:"cardinality"`
+}
+
+// currentStatus returns the version, uptime, the state of every file with
+// its offset and position and the number of series of every metric gathered
+// by g
+func currentStatus(e *exporter.Exporter, g prometheus.Gatherer) (*status, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fileStatuses(g)
+	if err != nil {
+		return nil, err
+	}
+
+	current := e.Positions().Current()
+	offsets := make(map[[2]string]int64)
+	for _, o := range e.Offsets() {
+		offsets[[2]string{o.Namespace, o.File}] = o.Offset
+	}
+	for _, f := range files {
+		if pos, ok := current[f.File]; ok {
+			f.Position = &pos
+		}
+		if offset, ok := offsets[[2]string{f.Namespace, f.File}]; ok {
+			f.Offset = &offset
+		}
+	}
+
+	s := &status{
+		Version:       Version,
+		Revision:      Revision,
+		StartTime:     startTime,
+		UptimeSeconds: time.Since(startTime).Seconds(),
+		Namespaces:    e.Namespaces(),
+		Files:         files,
+		Cardinality:   make(map[string]int),
+	}
+	// The runtime metrics of Go and the process are left out
+	for _, mf := range families {
+		if strings.HasPrefix(mf.GetName(), "go_") || strings.HasPrefix(mf.GetName(), "process_") || strings.HasPrefix(mf.GetName(), "promhttp_") {
+			continue
+		}
+		s.Cardinality[mf.GetName()] = len(mf.GetMetric())
+	}
+	return s, nil
+}
+
+// statusHandler serves the status of e and the metrics gathered by g as JSON
+func statusHandler(e *exporter.Exporter, g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := currentStatus(e, g)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	})
+}
@@ -0,0 +1,226 @@
+package tail
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/fsnotify/fsnotify.v1"
+)
+
+// rescanInterval is the interval in which the pattern is re-evaluated even
+// without any filesystem events, so that directories matching a wildcard
+// which are created later on are picked up as well
+const rescanInterval = 10 * time.Second
+
+// FileOp describes what happened to a discovered file
+type FileOp int
+
+const (
+	// FileCreated is emitted when a file starts matching the pattern
+	FileCreated FileOp = iota
+	// FileRemoved is emitted when a file no longer matches the pattern
+	FileRemoved
+)
+
+// FileEvent describes a file that appeared or disappeared
+type FileEvent struct {
+	Name string
+	Op   FileOp
+	// Existing is set for files which already matched the pattern when the
+	// discoverer was created
+	Existing bool
+}
+
+// Discoverer describes an object that emits a stream of files appearing and
+// disappearing for a glob pattern
+type Discoverer interface {
+	Files() chan FileEvent
+	OnError(func(error))
+	Stop() error
+}
+
+type discoverer struct {
+	pattern string
+	watcher *fsnotify.Watcher
+	known   map[string]bool
+	scanned bool
+	dirs    map[string]bool
+	files   chan FileEvent
+	errors  chan error
+	done    chan struct{}
+	once    sync.Once
+}
+
+// HasMeta reports whether path contains any of the glob meta characters
+// recognized by filepath.Match. The backslash is the path separator on
+// Windows and only escapes characters elsewhere.
+func HasMeta(path string) bool {
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[':
+			return true
+		case '\\':
+			if filepath.Separator != '\\' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewDiscoverer creates a new Discoverer instance for a given glob pattern.
+// Files already matching the pattern are emitted as created right away.
+func NewDiscoverer(pattern string) (Discoverer, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &discoverer{
+		pattern: pattern,
+		watcher: w,
+		known:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+		files:   make(chan FileEvent),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d, nil
+}
+
+func (d *discoverer) run() {
+	defer close(d.files)
+
+	ticker := time.NewTicker(rescanInterval)
+	defer ticker.Stop()
+
+	if !d.scan() {
+		return
+	}
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-d.watcher.Events:
+		case err := <-d.watcher.Errors:
+			d.fail(err)
+			return
+		case <-ticker.C:
+		}
+
+		if !d.scan() {
+			return
+		}
+	}
+}
+
+// scan evaluates the pattern, updates the watched directories and emits
+// events for every change since the last scan. It returns false when the
+// discoverer has been stopped or failed.
+func (d *discoverer) scan() bool {
+	dirs, err := filepath.Glob(filepath.Dir(d.pattern))
+	if err != nil {
+		d.fail(err)
+		return false
+	}
+
+	current := make(map[string]bool)
+	for _, dir := range dirs {
+		current[dir] = true
+		if !d.dirs[dir] {
+			// The directory might vanish between globbing and watching, the
+			// next scan will sort it out
+			if err := d.watcher.Add(dir); err == nil {
+				d.dirs[dir] = true
+			}
+		}
+	}
+
+	for dir := range d.dirs {
+		if !current[dir] {
+			d.watcher.Remove(dir)
+			delete(d.dirs, dir)
+		}
+	}
+
+	matches, err := filepath.Glob(d.pattern)
+	if err != nil {
+		d.fail(err)
+		return false
+	}
+
+	found := make(map[string]bool, len(matches))
+	for _, name := range matches {
+		found[name] = true
+		if !d.known[name] {
+			if !d.emit(FileEvent{Name: name, Op: FileCreated, Existing: !d.scanned}) {
+				return false
+			}
+			d.known[name] = true
+		}
+	}
+
+	for name := range d.known {
+		if !found[name] {
+			if !d.emit(FileEvent{Name: name, Op: FileRemoved}) {
+				return false
+			}
+			delete(d.known, name)
+		}
+	}
+
+	d.scanned = true
+	return true
+}
+
+func (d *discoverer) emit(ev FileEvent) bool {
+	select {
+	case d.files <- ev:
+		return true
+	case <-d.done:
+		return false
+	}
+}
+
+func (d *discoverer) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	select {
+	case d.errors <- err:
+	default:
+	}
+}
+
+func (d *discoverer) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-d.errors:
+			cb(err)
+		case <-d.done:
+		}
+	}()
+}
+
+func (d *discoverer) Files() chan FileEvent {
+	return d.files
+}
+
+func (d *discoverer) Stop() error {
+	var err error
+	d.once.Do(func() {
+		close(d.done)
+		err = d.watcher.Close()
+	})
+	return err
+}
@@ -0,0 +1,150 @@
+package tail
+
+import (
+	"bufio"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/hpcloud/tail"
+)
+
+type fifoFollower struct {
+	filename string
+	lines    chan *tail.Line
+	errors   chan error
+	done     chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	file     *os.File
+}
+
+// isFIFO checks whether filename is a named pipe
+func isFIFO(filename string) bool {
+	fi, err := os.Stat(filename)
+	return err == nil && fi.Mode()&os.ModeNamedPipe != 0
+}
+
+// newFIFOFollower creates a Follower which reads the lines written to the
+// named pipe filename. The pipe is reopened whenever its writer disconnects,
+// e.g. when nginx reopens its logs.
+func newFIFOFollower(filename string) Follower {
+	f := &fifoFollower{
+		filename: filename,
+		lines:    make(chan *tail.Line),
+		errors:   make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+func (f *fifoFollower) run() {
+	defer close(f.lines)
+
+	for {
+		// Opening blocks until a writer opens the pipe
+		file, err := os.OpenFile(f.filename, os.O_RDONLY, 0)
+		if err != nil {
+			f.fail(err)
+			return
+		}
+
+		if !f.open(file) {
+			return
+		}
+
+		err = f.read(file)
+		file.Close()
+
+		select {
+		case <-f.done:
+			return
+		default:
+		}
+
+		if err != nil {
+			f.fail(err)
+			return
+		}
+	}
+}
+
+// open stores file as the currently read pipe. It returns false and closes
+// file if the follower has been stopped in the meantime.
+func (f *fifoFollower) open(file *os.File) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	select {
+	case <-f.done:
+		file.Close()
+		return false
+	default:
+	}
+
+	f.file = file
+	return true
+}
+
+// read emits the lines of file until the writer disconnects
+func (f *fifoFollower) read(file *os.File) error {
+	s := bufio.NewScanner(file)
+	s.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	for s.Scan() {
+		select {
+		case f.lines <- tail.NewLine(s.Text()):
+		case <-f.done:
+			return nil
+		}
+	}
+	return s.Err()
+}
+
+func (f *fifoFollower) fail(err error) {
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+
+	select {
+	case f.errors <- err:
+	default:
+	}
+}
+
+func (f *fifoFollower) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-f.errors:
+			cb(err)
+		case <-f.done:
+		}
+	}()
+}
+
+func (f *fifoFollower) Lines() chan *tail.Line {
+	return f.lines
+}
+
+func (f *fifoFollower) Stop() error {
+	f.once.Do(func() {
+		close(f.done)
+
+		f.mu.Lock()
+		if f.file != nil {
+			f.file.Close()
+		}
+		f.mu.Unlock()
+
+		// Unblock an open waiting for a writer
+		if w, err := os.OpenFile(f.filename, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+	})
+	return nil
+}
@@ -1,53 +1,498 @@
 package tail
 
-import "github.com/hpcloud/tail"
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/hpcloud/tail/watch"
+)
 
 // Follower describes an object that emits a stream of lines
 type Follower interface {
 	Lines() chan *tail.Line
 	OnError(func(error))
+	Stop() error
+}
+
+// Lagger is implemented by followers of regular files, which can tell how
+// far they are behind the end of the file
+type Lagger interface {
+	// Lag returns the number of bytes between the current offset and the
+	// end of the file
+	Lag() (int64, error)
+
+	// Offset returns the offset after the last line passed on
+	Offset() (int64, error)
+}
+
+// Reopener is implemented by followers of regular files, which can reopen
+// their file on request
+type Reopener interface {
+	// Reopen closes the file and opens it again, continuing at the current
+	// offset if it is still the same file
+	Reopen() error
+}
+
+// FollowerConfig describes how files are followed
+type FollowerConfig struct {
+	// Positions resumes files at their saved position and saves the
+	// position of the followed file, it is optional
+	Positions *Positions
+
+	// FromBeginning reads files without a saved position from their
+	// beginning instead of only following the lines appended from now on
+	FromBeginning bool
+
+	// Poll detects changes of the file by polling it instead of using
+	// inotify, which does not work on NFS and some other filesystems. Files
+	// are always polled on Windows.
+	Poll bool
+
+	// OnReopen is called whenever the file is reopened after it has been
+	// rotated or truncated, with reason set to rotated or truncated
+	OnReopen func(reason string)
+}
+
+// SetPollInterval sets the interval in which followers with Poll set check
+// their files for changes. It applies to all followers.
+func SetPollInterval(interval time.Duration) {
+	watch.POLL_DURATION = interval
+}
+
+// tailLogger is the logger of a tail, which logs its messages as debug
+// messages via slog
+type tailLogger struct {
+	*log.Logger
+}
+
+func (l tailLogger) Printf(format string, v ...interface{}) {
+	slog.Debug(strings.TrimSpace(fmt.Sprintf(format, v...)))
 }
 
 type follower struct {
 	filename string
-	t        *tail.Tail
+	config   FollowerConfig
+	lines    chan *tail.Line
+
+	// control serializes reopening and stopping the follower
+	control sync.Mutex
+
+	// mu guards the tail, which is replaced when the file is reopened, the
+	// offset in the file after the last line passed on and the size the
+	// file had when it was last checked for being truncated
+	mu        sync.Mutex
+	t         *tail.Tail
+	inode     uint64
+	offset    int64
+	size      int64
+	forwarded chan struct{}
+	reopening bool
+	stopped   bool
+	onError   func(error)
+
+	err error
 }
 
-// NewFollower creates a new Follower instance for a given file
-func NewFollower(filename string) (Follower, error) {
+// NewFollower creates a new Follower instance for a given file. Named pipes
+// are read directly instead of being tailed. Files which do not exist yet
+// are followed once they appear.
+func NewFollower(filename string, config FollowerConfig) (Follower, error) {
+	if isFIFO(filename) {
+		return newFIFOFollower(filename), nil
+	}
+
 	f := &follower{
 		filename: filename,
+		config:   config,
+		lines:    make(chan *tail.Line),
 	}
 
-	if err := f.start(); err != nil {
+	if err := f.follow(f.location); err != nil {
 		return nil, err
 	}
 
+	if f.config.Positions != nil {
+		f.config.Positions.track(f.filename, f.position)
+	}
 	return f, nil
 }
 
-func (f *follower) start() error {
-	t, err := tail.TailFile(f.filename, tail.Config{
-		Follow: true,
-	})
+// locator returns the location to start following the file described by fi
+// at
+type locator func(fi os.FileInfo) *tail.SeekInfo
 
-	if err != nil {
-		return err
+// fromBeginning locates the beginning of a file
+func fromBeginning(os.FileInfo) *tail.SeekInfo {
+	return &tail.SeekInfo{Offset: 0, Whence: os.SEEK_SET}
+}
+
+// follow starts following the file at the location returned by locate, or
+// once it appears if it does not exist. It is called with mu held or before
+// the follower is shared.
+func (f *follower) follow(locate locator) error {
+	err := f.start(locate)
+	if os.IsNotExist(err) {
+		f.reopening = true
+		go f.await(locate, "")
+		return nil
 	}
+	return err
+}
+
+// await starts following the file at the location returned by locate as
+// soon as it exists, unless the follower is stopped before. The file is
+// reported as reopened for reason then, unless reason is empty.
+func (f *follower) await(locate locator, reason string) {
+	for {
+		f.mu.Lock()
+		if f.stopped {
+			f.reopening = false
+			close(f.lines)
+			f.mu.Unlock()
+			return
+		}
 
-	f.t = t
-	return nil
+		err := f.start(locate)
+		if os.IsNotExist(err) {
+			f.mu.Unlock()
+			time.Sleep(watch.POLL_DURATION)
+			continue
+		}
+
+		f.reopening = false
+		if err != nil {
+			f.failed(err)
+		}
+		f.mu.Unlock()
+
+		if err == nil && reason != "" {
+			f.reopened(reason)
+		}
+		return
+	}
 }
 
-func (f *follower) OnError(cb func(error)) {
-	go func() {
-		err := f.t.Wait()
+// start starts tailing the file at the location returned by locate and
+// passing its lines on. tail opens the file between two stats of its path,
+// so it is the file both describe unless it has been replaced meanwhile, in
+// which case it is opened again. It is called with mu held or before the
+// follower is shared.
+func (f *follower) start(locate locator) error {
+	for {
+		fi, err := os.Stat(f.filename)
 		if err != nil {
-			cb(err)
+			return err
+		}
+
+		// The end of the file is resolved here, so that the offset of the
+		// lines is known
+		location := locate(fi)
+		if location != nil && location.Whence == os.SEEK_END {
+			location = &tail.SeekInfo{Offset: fi.Size() + location.Offset, Whence: os.SEEK_SET}
+		}
+
+		// tail reopens truncated files, e.g. by copytruncate, by itself
+		// and stops once the file has been moved or deleted, the follower
+		// then follows the new file
+		t, err := tail.TailFile(f.filename, tail.Config{
+			Follow:    true,
+			MustExist: true,
+			Poll:      f.config.Poll || alwaysPoll,
+			Location:  location,
+			Logger:    tailLogger{tail.DefaultLogger},
+		})
+		if err != nil {
+			return err
+		}
+
+		if current, err := os.Stat(f.filename); err != nil || !os.SameFile(fi, current) {
+			f.discard(t)
+			continue
+		}
+
+		f.t = t
+		f.inode = inode(f.filename, fi)
+		f.offset, f.size = 0, 0
+		if location != nil {
+			f.offset = location.Offset
+		}
+		f.forwarded = make(chan struct{})
+		go f.forward(t, f.forwarded)
+		if f.onError != nil {
+			go f.wait(t, f.onError)
+		}
+		return nil
+	}
+}
+
+// discard stops t without passing its lines on
+func (f *follower) discard(t *tail.Tail) {
+	go func() {
+		for range t.Lines {
 		}
 	}()
+	t.Stop()
+	f.unwatched()
+}
+
+// forward passes the lines of t on until t is stopped. The file is followed
+// again if it has been moved or deleted, otherwise the lines are closed then
+// unless the file is reopened.
+func (f *follower) forward(t *tail.Tail, done chan struct{}) {
+	defer close(done)
+
+	for line := range t.Lines {
+		if f.truncated(line) {
+			f.reopened("truncated")
+		}
+		f.lines <- line
+
+		f.mu.Lock()
+		f.offset += int64(len(line.Text)) + 1
+		f.mu.Unlock()
+	}
+
+	// tail stops without an error once the file has been moved or deleted
+	err := t.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case f.reopening:
+	case err == nil && !f.stopped:
+		f.reopening = true
+		go f.rotated()
+	default:
+		close(f.lines)
+	}
+}
+
+// truncated reports whether line is the first line read after tail reopened
+// the file because it has been truncated, in which case the offset starts
+// over. tail reopens the file only after it has read all of it, so the file
+// is only checked once a line ends beyond the size it had before, and it has
+// been truncated if it is smaller than the end of the line. Files which have
+// grown beyond their former size again before their first line was read are
+// not noticed.
+func (f *follower) truncated(line *tail.Line) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.offset + int64(len(line.Text)) + 1
+	if end <= f.size {
+		return false
+	}
+
+	fi, err := os.Stat(f.filename)
+	if err != nil {
+		return false
+	}
+	// The file at the path of a rotated file is the new one
+	if id := inode(f.filename, fi); id != 0 && f.inode != 0 && id != f.inode {
+		return false
+	}
+
+	f.size = fi.Size()
+	if f.size >= end {
+		return false
+	}
+	f.offset = 0
+	return true
+}
+
+// rotated follows the file from its beginning after it has been moved or
+// deleted, e.g. by logrotate, as soon as the new file appears
+func (f *follower) rotated() {
+	f.unwatched()
+	f.await(fromBeginning, "rotated")
+}
+
+// failed stops the follower, which cannot continue without its file, after
+// starting to tail it failed with err. It is called with mu held.
+func (f *follower) failed(err error) {
+	f.stopped = true
+	close(f.lines)
+	if f.onError != nil {
+		go f.onError(err)
+	}
+}
+
+// wait calls onError with the error t failed with
+func (f *follower) wait(t *tail.Tail, onError func(error)) {
+	if err := t.Wait(); err != nil {
+		onError(err)
+	}
+}
+
+// reopened reports the file being reopened after it has been rotated or
+// truncated
+func (f *follower) reopened(reason string) {
+	slog.Info("Reopened file", "file", f.filename, "reason", reason)
+	if f.config.OnReopen != nil {
+		f.config.OnReopen(reason)
+	}
+}
+
+// Reopen closes the file and opens it again, e.g. after it has been replaced
+// in a way the follower did not notice. The lines read up to then are passed
+// on, reading continues after them if the file is still the same and not
+// smaller, otherwise at its beginning.
+func (f *follower) Reopen() error {
+	f.control.Lock()
+	defer f.control.Unlock()
+
+	f.mu.Lock()
+	// A file which is not there is being waited for already
+	if f.stopped || f.reopening {
+		f.mu.Unlock()
+		return nil
+	}
+	old, id, forwarded := f.t, f.inode, f.forwarded
+	f.reopening = true
+	f.mu.Unlock()
+
+	old.Kill(nil)
+	<-forwarded
+	old.Wait()
+	f.unwatched()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reopening = false
+
+	offset := f.offset
+	err := f.follow(func(fi os.FileInfo) *tail.SeekInfo {
+		current := inode(f.filename, fi)
+		if (current == 0 || id == 0 || current == id) && fi.Size() >= offset {
+			return &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}
+		}
+		return fromBeginning(fi)
+	})
+	if err != nil {
+		f.failed(err)
+	}
+	return err
+}
+
+// unwatchTimeout is how long Reopen waits for the inotify watch of the old
+// tail to be removed
+const unwatchTimeout = time.Second
+
+// unwatched waits until the inotify watch of a stopped tail of the file is
+// removed. tail removes it in the background after the tail has stopped and
+// shares watches of the same file, so a new tail watching the file before
+// would lose its events. Polled files have no watch.
+func (f *follower) unwatched() {
+	if f.config.Poll || alwaysPoll {
+		return
+	}
+
+	name := filepath.Clean(f.filename)
+	deadline := time.Now().Add(unwatchTimeout)
+	for watch.Events(name) != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// location returns the position to start following the file described by fi
+// at, which is its saved position or, without one, its end unless
+// FromBeginning is set. Positions of rotated or truncated files are not
+// resumed. Without an inode of the saved position or the file, as saved on
+// Windows by earlier versions, the position is resumed unless the file is
+// smaller.
+func (f *follower) location(fi os.FileInfo) *tail.SeekInfo {
+	pos, ok := f.config.Positions.Get(f.filename)
+	if !ok {
+		if f.config.FromBeginning {
+			return nil
+		}
+		return &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END}
+	}
+
+	id := inode(f.filename, fi)
+	if (id != 0 && pos.Inode != 0 && id != pos.Inode) || fi.Size() < pos.Offset {
+		return &tail.SeekInfo{Offset: 0, Whence: os.SEEK_SET}
+	}
+	return &tail.SeekInfo{Offset: pos.Offset, Whence: os.SEEK_SET}
+}
+
+// position returns the position after the last line passed on, in the file
+// tail opened, which is not the one at the path anymore once it has been
+// rotated
+func (f *follower) position() (Position, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.t == nil {
+		return Position{}, false
+	}
+	return Position{Offset: f.offset, Inode: f.inode}, true
+}
+
+func (f *follower) Offset() (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.offset, nil
+}
+
+func (f *follower) Lag() (int64, error) {
+	offset, _ := f.Offset()
+
+	fi, err := os.Stat(f.filename)
+	if err != nil {
+		return 0, err
+	}
+
+	// A rotated file may be larger than the new one until it is reopened
+	if lag := fi.Size() - offset; lag > 0 {
+		return lag, nil
+	}
+	return 0, nil
+}
+
+func (f *follower) OnError(cb func(error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.onError = cb
+	if !f.stopped && f.t != nil {
+		go f.wait(f.t, cb)
+	}
 }
 
 func (f *follower) Lines() chan *tail.Line {
-	return f.t.Lines
+	return f.lines
+}
+
+func (f *follower) Stop() error {
+	f.control.Lock()
+	defer f.control.Unlock()
+
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return f.err
+	}
+	f.stopped = true
+	t := f.t
+	f.mu.Unlock()
+
+	if f.config.Positions != nil {
+		f.config.Positions.untrack(f.filename)
+	}
+
+	// A file which did not appear yet has no tail
+	if t != nil {
+		f.err = t.Stop()
+		t.Cleanup()
+	}
+	return f.err
 }
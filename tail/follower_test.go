@@ -0,0 +1,206 @@
+package tail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	SetPollInterval(10 * time.Millisecond)
+	os.Exit(m.Run())
+}
+
+// appendLines appends lines to the file filename, creating it if necessary
+func appendLines(t *testing.T, filename string, lines ...string) {
+	t.Helper()
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(file, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// expectLines fails t unless f passes on lines next
+func expectLines(t *testing.T, f Follower, lines ...string) {
+	t.Helper()
+
+	for _, want := range lines {
+		select {
+		case line, ok := <-f.Lines():
+			if !ok {
+				t.Fatalf("lines closed, want %q", want)
+			}
+			if line.Text != want {
+				t.Fatalf("line %q, want %q", line.Text, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no line, want %q", want)
+		}
+	}
+}
+
+// expectReopen fails t unless the file is reported as reopened for reason
+func expectReopen(t *testing.T, reasons chan string, reason string) {
+	t.Helper()
+
+	select {
+	case got := <-reasons:
+		if got != reason {
+			t.Fatalf("reopened as %s, want %s", got, reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not reopened, want %s", reason)
+	}
+}
+
+// expectPosition fails t unless the position of f is at offset in the file
+// currently at its path. The offset of a line is added right after it has
+// been passed on.
+func expectPosition(t *testing.T, f *follower, offset int64) {
+	t.Helper()
+
+	fi, err := os.Stat(f.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Position{Offset: offset, Inode: inode(f.filename, fi)}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, ok := f.position()
+		if ok && got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("position %+v, want %+v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForChanges gives tail time to wait for changes of a file it has read,
+// it misses the changes made before
+func waitForChanges() {
+	time.Sleep(200 * time.Millisecond)
+}
+
+func TestFollowerReopen(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		t.Run(fmt.Sprintf("poll=%t", poll), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "access.log")
+			appendLines(t, filename, "a1", "a2")
+
+			reasons := make(chan string, 10)
+			f, err := NewFollower(filename, FollowerConfig{
+				FromBeginning: true,
+				Poll:          poll,
+				OnReopen: func(reason string) {
+					reasons <- reason
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Stop()
+			expectLines(t, f, "a1", "a2")
+			waitForChanges()
+
+			// Rotated like logrotate does by default
+			if err := os.Rename(filename, filename+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendLines(t, filename, "b1", "b2", "b3")
+			expectLines(t, f, "b1", "b2", "b3")
+			expectReopen(t, reasons, "rotated")
+
+			// Truncated like logrotate does with copytruncate, the file
+			// is appended to once tail noticed that it is smaller
+			if err := os.Truncate(filename, 0); err != nil {
+				t.Fatal(err)
+			}
+			waitForChanges()
+			appendLines(t, filename, "c1")
+			expectLines(t, f, "c1")
+			expectReopen(t, reasons, "truncated")
+
+			select {
+			case reason := <-reasons:
+				t.Errorf("reopened again as %s", reason)
+			default:
+			}
+		})
+	}
+}
+
+func TestFollowerPosition(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "access.log")
+	appendLines(t, filename, "a1", "a2")
+
+	fl, err := NewFollower(filename, FollowerConfig{FromBeginning: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fl.(*follower)
+	defer f.Stop()
+
+	expectLines(t, f, "a1", "a2")
+	expectPosition(t, f, 6)
+
+	// A line read by tail is not included until it has been passed on
+	waitForChanges()
+	appendLines(t, filename, "a3")
+	time.Sleep(200 * time.Millisecond)
+	expectPosition(t, f, 6)
+	expectLines(t, f, "a3")
+	expectPosition(t, f, 9)
+
+	waitForChanges()
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, filename, "b1")
+	expectLines(t, f, "b1")
+	expectPosition(t, f, 3)
+}
+
+func TestFollowerAwait(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := NewFollower(filename, FollowerConfig{FromBeginning: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendLines(t, filename, "a1")
+	expectLines(t, f, "a1")
+	if err := f.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A follower stopped before its file appeared closes its lines
+	f, err = NewFollower(filename+".missing", FollowerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-f.Lines():
+		if ok {
+			t.Fatal("line from missing file")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lines not closed")
+	}
+}
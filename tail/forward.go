@@ -0,0 +1,348 @@
+package tail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/tinylib/msgp/msgp"
+)
+
+type forwardListener struct {
+	messageKey string
+	listener   net.Listener
+	lines      chan *tail.Line
+	errors     chan error
+	done       chan struct{}
+	once       sync.Once
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	conns      map[net.Conn]bool
+}
+
+// NewForwardListener creates a Follower which receives the lines as events
+// of the Fluentd forward protocol on address, as sent by the forward output
+// of fluentd and fluent-bit. The line is taken from the field messageKey of
+// the record, records without that field are emitted as JSON objects.
+func NewForwardListener(address, messageKey string) (Follower, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &forwardListener{
+		messageKey: messageKey,
+		listener:   listener,
+		lines:      make(chan *tail.Line),
+		errors:     make(chan error, 1),
+		done:       make(chan struct{}),
+		conns:      make(map[net.Conn]bool),
+	}
+
+	l.wg.Add(1)
+	go l.accept()
+
+	go func() {
+		l.wg.Wait()
+		close(l.lines)
+	}()
+
+	return l, nil
+}
+
+func (l *forwardListener) accept() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			select {
+			case <-l.done:
+			default:
+				select {
+				case l.errors <- err:
+				default:
+				}
+			}
+			return
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = true
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.read(conn)
+	}
+}
+
+// read receives the messages of a single connection until it is closed or
+// a message is malformed
+func (l *forwardListener) read(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := msgp.NewReader(conn)
+	w := msgp.NewWriter(conn)
+	for {
+		if err := l.readMessage(r, w); err != nil {
+			return
+		}
+	}
+}
+
+// readMessage reads a single message in Message, Forward, PackedForward or
+// CompressedPackedForward mode and acknowledges it if requested
+func (l *forwardListener) readMessage(r *msgp.Reader, w *msgp.Writer) error {
+	n, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if n < 2 {
+		return fmt.Errorf("invalid forward message with %d elements", n)
+	}
+
+	// The tag is not used
+	if err := r.Skip(); err != nil {
+		return err
+	}
+
+	t, err := r.NextType()
+	if err != nil {
+		return err
+	}
+
+	var options map[string]interface{}
+	remaining := n - 2
+
+	switch t {
+	case msgp.ArrayType:
+		// Forward mode: [tag, [[time, record], ...], options]
+		count, err := r.ReadArrayHeader()
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < count; i++ {
+			if err := l.readEntry(r); err != nil {
+				return err
+			}
+		}
+
+	case msgp.StrType, msgp.BinType:
+		// PackedForward mode: [tag, stream of [time, record], options]
+		var packed []byte
+		if t == msgp.StrType {
+			packed, err = r.ReadStringAsBytes(nil)
+		} else {
+			packed, err = r.ReadBytes(nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		if remaining > 0 {
+			if options, err = readOptions(r); err != nil {
+				return err
+			}
+			remaining--
+		}
+
+		if err := l.readPacked(packed, options["compressed"] == "gzip"); err != nil {
+			return err
+		}
+
+	default:
+		// Message mode: [tag, time, record, options]
+		if remaining == 0 {
+			return fmt.Errorf("invalid forward message without record")
+		}
+		remaining--
+
+		if err := l.readTimeAndRecord(r); err != nil {
+			return err
+		}
+	}
+
+	if remaining > 0 && options == nil {
+		if options, err = readOptions(r); err != nil {
+			return err
+		}
+		remaining--
+	}
+	for ; remaining > 0; remaining-- {
+		if err := r.Skip(); err != nil {
+			return err
+		}
+	}
+
+	if chunk, ok := options["chunk"]; ok {
+		if err := w.WriteMapHeader(1); err != nil {
+			return err
+		}
+		if err := w.WriteString("ack"); err != nil {
+			return err
+		}
+		if err := w.WriteIntf(chunk); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+// readOptions reads the options of a message
+func readOptions(r *msgp.Reader) (map[string]interface{}, error) {
+	options, err := r.ReadIntf()
+	if err != nil {
+		return nil, err
+	}
+
+	m, _ := options.(map[string]interface{})
+	return m, nil
+}
+
+// readPacked reads the entries of a PackedForward message
+func (l *forwardListener) readPacked(packed []byte, compressed bool) error {
+	var stream io.Reader = bytes.NewReader(packed)
+	if compressed {
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stream = gz
+	}
+
+	r := msgp.NewReader(stream)
+	for {
+		if err := l.readEntry(r); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// readEntry reads a single [time, record] entry
+func (l *forwardListener) readEntry(r *msgp.Reader) error {
+	n, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if n != 2 {
+		return fmt.Errorf("invalid forward entry with %d elements", n)
+	}
+	return l.readTimeAndRecord(r)
+}
+
+// readTimeAndRecord reads the time and record of an event and emits its line
+func (l *forwardListener) readTimeAndRecord(r *msgp.Reader) error {
+	t, err := r.ReadIntf()
+	if err != nil {
+		return err
+	}
+
+	record, err := r.ReadIntf()
+	if err != nil {
+		return err
+	}
+
+	fields, ok := record.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid forward record of type %T", record)
+	}
+
+	line := tail.NewLine(l.recordLine(fields))
+	if ts, ok := eventTime(t); ok {
+		line.Time = ts
+	}
+
+	select {
+	case l.lines <- line:
+		return nil
+	case <-l.done:
+		return io.EOF
+	}
+}
+
+// recordLine returns the message field of record, or record as JSON object
+// if there is no such field
+func (l *forwardListener) recordLine(record map[string]interface{}) string {
+	for key, value := range record {
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+			record[key] = value
+		}
+	}
+
+	if msg, ok := record[l.messageKey].(string); ok {
+		return msg
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return ""
+	}
+	return string(line)
+}
+
+// eventTime converts the time of an event, which is either a Unix timestamp
+// or an EventTime extension with nanosecond precision
+func eventTime(t interface{}) (time.Time, bool) {
+	switch v := t.(type) {
+	case int64:
+		return time.Unix(v, 0), true
+	case uint64:
+		return time.Unix(int64(v), 0), true
+	case *msgp.RawExtension:
+		if v.Type != 0 || len(v.Data) != 8 {
+			return time.Time{}, false
+		}
+		sec := binary.BigEndian.Uint32(v.Data[:4])
+		nsec := binary.BigEndian.Uint32(v.Data[4:])
+		return time.Unix(int64(sec), int64(nsec)), true
+	}
+	return time.Time{}, false
+}
+
+func (l *forwardListener) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-l.errors:
+			cb(err)
+		case <-l.done:
+		}
+	}()
+}
+
+func (l *forwardListener) Lines() chan *tail.Line {
+	return l.lines
+}
+
+func (l *forwardListener) Stop() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.listener.Close()
+
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+	})
+	return err
+}
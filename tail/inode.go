@@ -0,0 +1,20 @@
+//go:build !windows
+
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+// alwaysPoll is set on platforms on which files are always polled for
+// changes
+const alwaysPoll = false
+
+// inode returns the inode of the file filename described by fi
+func inode(filename string, fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+// alwaysPoll is set on Windows, as the change notifications for a file are
+// delayed as long as nginx keeps it open, NTFS only updates the size in its
+// directory entry lazily
+const alwaysPoll = true
+
+// inode returns the file index of the file filename, which identifies it on
+// its volume like an inode, or 0 if it cannot be read. The file is opened
+// without access rights and shared for deletion, so that it can still be
+// rotated by renaming it.
+func inode(filename string, fi os.FileInfo) uint64 {
+	name, err := syscall.UTF16PtrFromString(filename)
+	if err != nil {
+		return 0
+	}
+
+	h, err := syscall.CreateFile(name, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0
+	}
+	defer syscall.CloseHandle(h)
+
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return 0
+	}
+	return uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)
+}
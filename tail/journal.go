@@ -0,0 +1,11 @@
+package tail
+
+// JournalConfig describes which entries of the systemd journal are followed
+type JournalConfig struct {
+	// Matches are journal matches like _SYSTEMD_UNIT=nginx.service, entries
+	// must satisfy all of them
+	Matches []string
+	// CursorFile is the file the position in the journal is persisted to, so
+	// that a restart continues where the last run stopped
+	CursorFile string
+}
@@ -0,0 +1,180 @@
+//go:build linux && journald
+// +build linux,journald
+
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/hpcloud/tail"
+)
+
+// cursorSaveInterval is the interval in which the journal cursor is persisted
+const cursorSaveInterval = 5 * time.Second
+
+type journalFollower struct {
+	config  JournalConfig
+	journal *sdjournal.Journal
+	lines   chan *tail.Line
+	errors  chan error
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewJournalFollower creates a Follower which emits the messages of the
+// systemd journal entries matching c. Without a persisted cursor it starts
+// with the entries written from now on.
+func NewJournalFollower(c JournalConfig) (Follower, error) {
+	j, err := sdjournal.NewJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range c.Matches {
+		if err := j.AddMatch(match); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+
+	if err := seekJournal(j, c.CursorFile); err != nil {
+		j.Close()
+		return nil, err
+	}
+
+	f := &journalFollower{
+		config:  c,
+		journal: j,
+		lines:   make(chan *tail.Line),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f, nil
+}
+
+// seekJournal moves to the entry at the persisted cursor or to the end of
+// the journal
+func seekJournal(j *sdjournal.Journal, cursorFile string) error {
+	if cursorFile != "" {
+		content, err := ioutil.ReadFile(cursorFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if cursor := strings.TrimSpace(string(content)); cursor != "" {
+			if err := j.SeekCursor(cursor); err != nil {
+				return err
+			}
+			// Move onto the entry at the cursor, which has already been read
+			_, err := j.Next()
+			return err
+		}
+	}
+
+	if err := j.SeekTail(); err != nil {
+		return err
+	}
+	_, err := j.Previous()
+	return err
+}
+
+func (f *journalFollower) run() {
+	defer close(f.lines)
+	defer f.journal.Close()
+	defer f.saveCursor()
+
+	lastSave := time.Now()
+	for {
+		select {
+		case <-f.done:
+			return
+		default:
+		}
+
+		n, err := f.journal.Next()
+		if err != nil {
+			f.fail(err)
+			return
+		}
+
+		if n == 0 {
+			f.journal.Wait(time.Second)
+			continue
+		}
+
+		msg, err := f.journal.GetDataValue(sdjournal.SD_JOURNAL_FIELD_MESSAGE)
+		if err != nil {
+			// Entries without a message are skipped
+			continue
+		}
+
+		select {
+		case f.lines <- tail.NewLine(msg):
+		case <-f.done:
+			return
+		}
+
+		if time.Since(lastSave) >= cursorSaveInterval {
+			f.saveCursor()
+			lastSave = time.Now()
+		}
+	}
+}
+
+// saveCursor persists the position in the journal to the cursor file
+func (f *journalFollower) saveCursor() {
+	if f.config.CursorFile == "" {
+		return
+	}
+
+	cursor, err := f.journal.GetCursor()
+	if err != nil {
+		return
+	}
+
+	tmp := f.config.CursorFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(cursor+"\n"), 0600); err != nil {
+		f.fail(err)
+		return
+	}
+	if err := os.Rename(tmp, filepath.Clean(f.config.CursorFile)); err != nil {
+		f.fail(err)
+	}
+}
+
+func (f *journalFollower) fail(err error) {
+	select {
+	case f.errors <- err:
+	default:
+	}
+}
+
+func (f *journalFollower) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-f.errors:
+			cb(err)
+		case <-f.done:
+		}
+	}()
+}
+
+func (f *journalFollower) Lines() chan *tail.Line {
+	return f.lines
+}
+
+func (f *journalFollower) Stop() error {
+	f.once.Do(func() {
+		close(f.done)
+	})
+	return nil
+}
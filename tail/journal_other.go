@@ -0,0 +1,12 @@
+//go:build !linux || !journald
+// +build !linux !journald
+
+package tail
+
+import "errors"
+
+// NewJournalFollower is only available on Linux in builds with the journald
+// tag, which requires cgo and the systemd headers
+func NewJournalFollower(c JournalConfig) (Follower, error) {
+	return nil, errors.New("journald support is not compiled in, build with -tags journald")
+}
@@ -0,0 +1,207 @@
+package tail
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaCommitInterval is the interval in which consumed offsets are committed
+const kafkaCommitInterval = time.Second
+
+// KafkaConfig describes the topic consumed by a Kafka consumer
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+
+	// TLS enables TLS, CAFile, CertFile and KeyFile are optional
+	TLS      bool
+	CAFile   string
+	CertFile string
+	KeyFile  string
+
+	// SASLMechanism is one of plain, scram-sha-256 or scram-sha-512, SASL is
+	// disabled if it is empty
+	SASLMechanism string
+	Username      string
+	Password      string
+}
+
+type kafkaConsumer struct {
+	reader *kafka.Reader
+	lines  chan *tail.Line
+	errors chan error
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewKafkaConsumer creates a Follower which emits the messages of a Kafka
+// topic as lines. Offsets are committed for the consumer group, so a restart
+// continues where the last run stopped.
+func NewKafkaConsumer(c KafkaConfig) (Follower, error) {
+	if len(c.Brokers) == 0 || c.Topic == "" {
+		return nil, fmt.Errorf("kafka input requires brokers and a topic")
+	}
+
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	if c.TLS {
+		tlsConfig, err := kafkaTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLS = tlsConfig
+	}
+
+	mechanism, err := kafkaSASLMechanism(c)
+	if err != nil {
+		return nil, err
+	}
+	dialer.SASLMechanism = mechanism
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        c.Brokers,
+		Topic:          c.Topic,
+		GroupID:        c.GroupID,
+		Dialer:         dialer,
+		CommitInterval: kafkaCommitInterval,
+		StartOffset:    kafka.LastOffset,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &kafkaConsumer{
+		reader: reader,
+		lines:  make(chan *tail.Line),
+		errors: make(chan error, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go k.run()
+
+	return k, nil
+}
+
+// kafkaTLSConfig creates the TLS configuration of c
+func kafkaTLSConfig(c KafkaConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if c.CAFile != "" {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in '%s'", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// kafkaSASLMechanism creates the SASL mechanism of c, or nil if SASL is
+// disabled
+func kafkaSASLMechanism(c KafkaConfig) (sasl.Mechanism, error) {
+	switch c.SASLMechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: c.Username, Password: c.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, c.Username, c.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, c.Username, c.Password)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism '%s'", c.SASLMechanism)
+	}
+}
+
+func (k *kafkaConsumer) run() {
+	defer close(k.lines)
+
+	for {
+		// The offset of a message is committed only once its line has been
+		// handed on, so a message still pending on shutdown is consumed again
+		// by the next run
+		msg, err := k.reader.FetchMessage(k.ctx)
+		if err != nil {
+			if k.ctx.Err() == nil {
+				select {
+				case k.errors <- err:
+				default:
+				}
+			}
+			return
+		}
+
+		line := tail.NewLine(string(msg.Value))
+		if !msg.Time.IsZero() {
+			line.Time = msg.Time
+		}
+
+		select {
+		case k.lines <- line:
+		case <-k.ctx.Done():
+			return
+		}
+
+		if k.reader.Config().GroupID == "" {
+			continue
+		}
+		if err := k.reader.CommitMessages(k.ctx, msg); err != nil && k.ctx.Err() == nil {
+			select {
+			case k.errors <- err:
+			default:
+			}
+			return
+		}
+	}
+}
+
+func (k *kafkaConsumer) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-k.errors:
+			cb(err)
+		case <-k.ctx.Done():
+		}
+	}()
+}
+
+func (k *kafkaConsumer) Lines() chan *tail.Line {
+	return k.lines
+}
+
+func (k *kafkaConsumer) Stop() error {
+	var err error
+	k.once.Do(func() {
+		k.cancel()
+		err = k.reader.Close()
+	})
+	return err
+}
@@ -0,0 +1,47 @@
+package tail
+
+import (
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+type pacedFollower struct {
+	Follower
+	rate  float64
+	lines chan *tail.Line
+}
+
+// NewPacedFollower creates a Follower which emits the lines of f at no more
+// than rate lines per second
+func NewPacedFollower(f Follower, rate float64) Follower {
+	p := &pacedFollower{
+		Follower: f,
+		rate:     rate,
+		lines:    make(chan *tail.Line),
+	}
+
+	go p.run()
+
+	return p
+}
+
+func (p *pacedFollower) run() {
+	defer close(p.lines)
+
+	start := time.Now()
+	n := 0
+	for line := range p.Follower.Lines() {
+		next := start.Add(time.Duration(float64(n) / p.rate * float64(time.Second)))
+		if d := time.Until(next); d > 0 {
+			time.Sleep(d)
+		}
+
+		p.lines <- line
+		n++
+	}
+}
+
+func (p *pacedFollower) Lines() chan *tail.Line {
+	return p.lines
+}
@@ -0,0 +1,202 @@
+package tail
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Position is the offset up to which a file has been read. Inode identifies
+// the file, so that a rotated file is not resumed at the offset of its
+// predecessor.
+type Position struct {
+	Offset int64  `yaml:"offset" json:"offset"`
+	Inode  uint64 `yaml:"inode" json:"inode"`
+}
+
+// positionsFile is the structure of the positions file
+type positionsFile struct {
+	Positions map[string]Position `yaml:"positions"`
+}
+
+// Positions persists the positions of the followed files, so that a restart
+// resumes every file where the last run stopped
+type Positions struct {
+	filename  string
+	mu        sync.Mutex
+	positions map[string]Position
+	trackers  map[string]func() (Position, bool)
+}
+
+// OpenPositions reads the positions file at filename. A missing file is
+// created on the first save.
+func OpenPositions(filename string) (*Positions, error) {
+	p := &Positions{
+		filename:  filename,
+		positions: make(map[string]Position),
+		trackers:  make(map[string]func() (Position, bool)),
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f positionsFile
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, err
+	}
+	for name, pos := range f.Positions {
+		p.positions[name] = pos
+	}
+
+	return p, nil
+}
+
+// Get returns the saved position of the file name
+func (p *Positions) Get(name string) (Position, bool) {
+	if p == nil {
+		return Position{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pos, ok := p.positions[name]
+	return pos, ok
+}
+
+// Current returns the current positions of all tracked files and the saved
+// positions of the files which are no longer followed
+func (p *Positions) Current() map[string]Position {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	positions := make(map[string]Position, len(p.positions))
+	for name, pos := range p.positions {
+		positions[name] = pos
+	}
+	for name, position := range p.trackers {
+		if pos, ok := position(); ok {
+			positions[name] = pos
+		}
+	}
+	return positions
+}
+
+// Begin saves the beginning of the file name as its position, unless it has
+// a saved position. A restart then resumes the file instead of considering
+// it unread, even if it stops before the file has been read at all.
+func (p *Positions) Begin(name string) error {
+	if p == nil {
+		return nil
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if _, ok := p.positions[name]; ok {
+		p.mu.Unlock()
+		return nil
+	}
+	p.positions[name] = Position{Inode: inode(name, fi)}
+	p.mu.Unlock()
+
+	return p.Save()
+}
+
+// track registers a function returning the current position of the file
+// name, which is queried on every save until untrack is called
+func (p *Positions) track(name string, position func() (Position, bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.trackers[name] = position
+}
+
+// untrack stores the final position of the file name and stops tracking
+// it. The position is forgotten if the file has been removed.
+func (p *Positions) untrack(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if position, ok := p.trackers[name]; ok {
+		if pos, ok := position(); ok {
+			p.positions[name] = pos
+		}
+		delete(p.trackers, name)
+	}
+
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		delete(p.positions, name)
+	}
+}
+
+// Save writes the current positions of all tracked files to the positions
+// file
+func (p *Positions) Save() error {
+	p.mu.Lock()
+	for name, position := range p.trackers {
+		if pos, ok := position(); ok {
+			p.positions[name] = pos
+		}
+	}
+
+	content, err := yaml.Marshal(positionsFile{Positions: p.positions})
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Write atomically, so that a crash does not leave a truncated file
+	tmp, err := ioutil.TempFile(filepath.Dir(p.filename), filepath.Base(p.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.filename)
+}
+
+// SyncEvery saves the positions in the given interval until ctx is done,
+// and a last time before it returns
+func (p *Positions) SyncEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := p.Save(); err != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+			if err := p.Save(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
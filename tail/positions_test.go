@@ -0,0 +1,89 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPositionsSyncEvery(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "positions.yaml")
+	p, err := OpenPositions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Position{Offset: 42, Inode: 7}
+	p.track("access.log", func() (Position, bool) {
+		return want, true
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.SyncEvery(ctx, time.Hour, func(err error) {
+			t.Error(err)
+		})
+	}()
+
+	// The positions are saved once more when the sync stops, long before
+	// the first tick
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync did not stop")
+	}
+
+	saved, err := OpenPositions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := saved.Get("access.log"); !ok || got != want {
+		t.Errorf("saved position %+v, want %+v", got, want)
+	}
+}
+
+func TestPositionsBegin(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "positions.yaml")
+	logFile := filepath.Join(dir, "access.log")
+	appendLines(t, logFile, "a1")
+
+	p, err := OpenPositions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Begin(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// The beginning is saved right away, a saved position is kept
+	saved, err := OpenPositions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Position{Offset: 0, Inode: inode(logFile, fi)}
+	if got, ok := saved.Get(logFile); !ok || got != want {
+		t.Errorf("saved position %+v, want %+v", got, want)
+	}
+
+	saved.positions[logFile] = Position{Offset: 3, Inode: want.Inode}
+	if err := saved.Begin(logFile); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := saved.Get(logFile); got.Offset != 3 {
+		t.Errorf("position %+v replaced by the beginning", got)
+	}
+
+	if err := p.Begin(filepath.Join(dir, "missing.log")); err == nil {
+		t.Error("beginning of a missing file saved")
+	}
+}
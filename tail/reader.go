@@ -0,0 +1,78 @@
+package tail
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/hpcloud/tail"
+)
+
+// maxLineLength is the maximum length of a line read by a reader follower
+const maxLineLength = 1024 * 1024
+
+type readerFollower struct {
+	r      io.Reader
+	lines  chan *tail.Line
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewReaderFollower creates a Follower which emits the lines read from r,
+// e.g. os.Stdin, until it reaches the end of r
+func NewReaderFollower(r io.Reader) Follower {
+	f := &readerFollower{
+		r:      r,
+		lines:  make(chan *tail.Line),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+
+	go f.run()
+
+	return f
+}
+
+func (f *readerFollower) run() {
+	defer close(f.lines)
+
+	s := bufio.NewScanner(f.r)
+	s.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	for s.Scan() {
+		select {
+		case f.lines <- tail.NewLine(s.Text()):
+		case <-f.done:
+			return
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		select {
+		case f.errors <- err:
+		default:
+		}
+	}
+}
+
+func (f *readerFollower) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-f.errors:
+			cb(err)
+		case <-f.done:
+		}
+	}()
+}
+
+func (f *readerFollower) Lines() chan *tail.Line {
+	return f.lines
+}
+
+func (f *readerFollower) Stop() error {
+	f.once.Do(func() {
+		close(f.done)
+	})
+	return nil
+}
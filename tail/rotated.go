@@ -0,0 +1,92 @@
+package tail
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotatedSuffix matches the suffixes logrotate appends to rotated files,
+// e.g. .1, .2.gz or -20240101.gz with dateext
+var rotatedSuffix = regexp.MustCompile(`^[.-][0-9-]+(\.gz)?$`)
+
+// RotatedFiles returns the rotated files of filename, e.g. access.log.1,
+// access.log.2.gz or access.log-20240101.gz, from the oldest to the newest
+// according to their modification time. Files modified longer than maxAge
+// ago are left out, unless maxAge is 0.
+func RotatedFiles(filename string, maxAge time.Duration) ([]string, error) {
+	var candidates []string
+	for _, pattern := range []string{filename + ".*", filename + "-*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, matches...)
+	}
+
+	type rotatedFile struct {
+		name string
+		fi   os.FileInfo
+	}
+
+	var files []rotatedFile
+	for _, name := range candidates {
+		if !rotatedSuffix.MatchString(strings.TrimPrefix(name, filename)) {
+			continue
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if maxAge > 0 && time.Since(fi.ModTime()) > maxAge {
+			continue
+		}
+		files = append(files, rotatedFile{name, fi})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].fi.ModTime().Before(files[j].fi.ModTime())
+	})
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// OpenRotated opens the rotated file name, which is decompressed if its
+// name ends with .gz
+func OpenRotated(name string) (io.ReadCloser, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(name, ".gz") {
+		return file, nil
+	}
+
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: r, file: file}, nil
+}
@@ -0,0 +1,56 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "access.log")
+
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"access.log":             0,
+		"access.log.1":           time.Hour,
+		"access.log.2.gz":        25 * time.Hour,
+		"access.log-20240101.gz": 49 * time.Hour,
+		"access.log.bak":         time.Hour,
+		"error.log.1":            time.Hour,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		maxAge time.Duration
+		want   []string
+	}{
+		{maxAge: 0, want: []string{"access.log-20240101.gz", "access.log.2.gz", "access.log.1"}},
+		{maxAge: 48 * time.Hour, want: []string{"access.log.2.gz", "access.log.1"}},
+		{maxAge: 24 * time.Hour, want: []string{"access.log.1"}},
+		{maxAge: time.Minute, want: []string{}},
+	}
+
+	for _, test := range tests {
+		files, err := RotatedFiles(filename, test.maxAge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, len(files))
+		for i, f := range files {
+			got[i] = filepath.Base(f)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("max age %s: files %q, want %q", test.maxAge, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package tail
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// maxSyslogMessage is the maximum size of a syslog message received via UDP
+const maxSyslogMessage = 64 * 1024
+
+type syslogListener struct {
+	udp    net.PacketConn
+	tcp    net.Listener
+	lines  chan *tail.Line
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	conns  map[net.Conn]bool
+}
+
+// NewSyslogListener creates a Follower which receives the lines as syslog
+// messages on address via UDP and TCP, as sent by nginx for access_log
+// syslog:server=address. Messages may be framed according to RFC3164 or
+// RFC5424, TCP streams may be newline delimited or use octet counting.
+func NewSyslogListener(address string) (Follower, error) {
+	udp, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	tcp, err := net.Listen("tcp", address)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+
+	l := &syslogListener{
+		udp:    udp,
+		tcp:    tcp,
+		lines:  make(chan *tail.Line),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+		conns:  make(map[net.Conn]bool),
+	}
+
+	l.wg.Add(2)
+	go l.receive()
+	go l.accept()
+
+	go func() {
+		l.wg.Wait()
+		close(l.lines)
+	}()
+
+	return l, nil
+}
+
+func (l *syslogListener) receive() {
+	defer l.wg.Done()
+
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, _, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			l.fail(err)
+			return
+		}
+
+		if !l.emit(string(buf[:n])) {
+			return
+		}
+	}
+}
+
+func (l *syslogListener) accept() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			l.fail(err)
+			return
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = true
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.read(conn)
+	}
+}
+
+// read receives the messages of a single TCP connection
+func (l *syslogListener) read(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	readFrame := readLine
+	if octetCounted(r) {
+		readFrame = readCounted
+	}
+	for {
+		msg, err := readFrame(r)
+		if msg != "" && !l.emit(msg) {
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// octetCounted tells whether a TCP stream uses octet counting, which is
+// decided once by its first frame. A frame with octet counting starts with
+// the length of the message and a space, followed by the priority of the
+// message, so a newline delimited message starting with a digit, like an
+// IP address, is no length.
+func octetCounted(r *bufio.Reader) bool {
+	maxDigits := len(strconv.Itoa(maxSyslogMessage))
+	for i := 1; i <= maxDigits+1; i++ {
+		b, err := r.Peek(i)
+		if err != nil {
+			return false
+		}
+
+		switch c := b[i-1]; {
+		case c >= '0' && c <= '9' && i <= maxDigits:
+		case c == ' ' && i > 1:
+			b, err := r.Peek(i + 1)
+			return err == nil && b[i] == '<'
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// readLine reads the next message of a newline delimited TCP stream
+func readLine(r *bufio.Reader) (string, error) {
+	msg, err := r.ReadString('\n')
+	if err == io.EOF && msg != "" {
+		err = nil
+	}
+	return msg, err
+}
+
+// readCounted reads the next message of a TCP stream using octet counting,
+// which is prefixed by its length
+func readCounted(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(prefix))
+	if err != nil || n <= 0 || n > maxSyslogMessage {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (l *syslogListener) emit(raw string) bool {
+	select {
+	case l.lines <- tail.NewLine(syslogMessage(raw)):
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *syslogListener) fail(err error) {
+	select {
+	case <-l.done:
+		// Errors caused by closing the listeners on Stop are expected
+		return
+	default:
+	}
+
+	select {
+	case l.errors <- err:
+	default:
+	}
+}
+
+// syslogMessage strips the RFC3164 or RFC5424 header from a syslog message.
+// Messages without a header are returned as they are.
+func syslogMessage(raw string) string {
+	msg := strings.TrimRight(raw, "\r\n\x00")
+
+	if !strings.HasPrefix(msg, "<") {
+		return msg
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return msg
+	}
+	if _, err := strconv.Atoi(msg[1:end]); err != nil {
+		return msg
+	}
+	msg = msg[end+1:]
+
+	// RFC5424: VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	if strings.HasPrefix(msg, "1 ") {
+		fields := strings.SplitN(msg, " ", 7)
+		if len(fields) < 7 {
+			return ""
+		}
+		return strings.TrimPrefix(skipStructuredData(fields[6]), "\xef\xbb\xbf")
+	}
+
+	// RFC3164: TIMESTAMP HOSTNAME TAG: MSG
+	if len(msg) > len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, msg[:len(time.Stamp)]); err == nil {
+			msg = msg[len(time.Stamp)+1:]
+			if i := strings.IndexByte(msg, ' '); i >= 0 {
+				msg = msg[i+1:]
+			}
+		}
+	}
+	if i := strings.Index(msg, ": "); i >= 0 && i < 48 && !strings.ContainsAny(msg[:i], " \"") {
+		msg = msg[i+2:]
+	}
+	return msg
+}
+
+// skipStructuredData removes the structured data of an RFC5424 message
+func skipStructuredData(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return strings.TrimPrefix(s[1:], " ")
+	}
+
+	for strings.HasPrefix(s, "[") {
+		escaped := false
+		i := 1
+		for ; i < len(s); i++ {
+			if escaped {
+				escaped = false
+			} else if s[i] == '\\' {
+				escaped = true
+			} else if s[i] == ']' {
+				break
+			}
+		}
+		if i >= len(s) {
+			return ""
+		}
+		s = s[i+1:]
+	}
+	return strings.TrimPrefix(s, " ")
+}
+
+func (l *syslogListener) OnError(cb func(error)) {
+	go func() {
+		select {
+		case err := <-l.errors:
+			cb(err)
+		case <-l.done:
+		}
+	}()
+}
+
+func (l *syslogListener) Lines() chan *tail.Line {
+	return l.lines
+}
+
+func (l *syslogListener) Stop() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.udp.Close()
+		if tcpErr := l.tcp.Close(); err == nil {
+			err = tcpErr
+		}
+
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+	})
+	return err
+}
@@ -0,0 +1,79 @@
+package tail
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyslogFraming(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{
+			name:   "newline delimited",
+			stream: "<190>Oct 15 10:00:00 web nginx: GET /a\n<190>Oct 15 10:00:01 web nginx: GET /b\n",
+			want:   []string{"GET /a", "GET /b"},
+		},
+		{
+			name:   "newline delimited starting with digits",
+			stream: "1.2.3.4 - - GET /a\n12 34\n",
+			want:   []string{"1.2.3.4 - - GET /a", "12 34"},
+		},
+		{
+			name:   "octet counting",
+			stream: "13 <190>nginx: a14 <190>nginx: bc",
+			want:   []string{"a", "bc"},
+		},
+		{
+			name:   "octet counting with newlines",
+			stream: "26 <190>1 - - - - - - GET /a\n",
+			want:   []string{"GET /a"},
+		},
+	}
+
+	for _, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.stream))
+		readFrame := readLine
+		if octetCounted(r) {
+			readFrame = readCounted
+		}
+
+		var got []string
+		for {
+			msg, err := readFrame(r)
+			if msg != "" {
+				got = append(got, syslogMessage(msg))
+			}
+			if err != nil {
+				break
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: read %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSyslogMessage(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"GET /a", "GET /a"},
+		{"<190>Oct 15 10:00:00 web nginx: GET /a\n", "GET /a"},
+		{"<190>nginx: GET /a", "GET /a"},
+		{"<190>1 2026-10-15T10:00:00Z web nginx - - - GET /a", "GET /a"},
+		{`<190>1 2026-10-15T10:00:00Z web nginx - - [x@1 a="\]"] GET /a`, "GET /a"},
+		{"<190>1 2026-10-15T10:00:00Z web nginx - - - \xef\xbb\xbfGET /a", "GET /a"},
+	}
+
+	for _, test := range tests {
+		if got := syslogMessage(test.raw); got != test.want {
+			t.Errorf("syslogMessage(%q) = %q, want %q", test.raw, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/denniswinter/nginx-log-exporter/exporter"
+	"github.com/denniswinter/nginx-log-exporter/tail"
+)
+
+// TestFormatCommand is a struct
+type TestFormatCommand struct {
+	Namespace string `long:"namespace" description:"Namespace of the configuration file whose format the lines are parsed with, defaults to the first one"`
+	Args      struct {
+		File string `positional-arg-name:"file" description:"File with sample lines, gzip compressed if its name ends with .gz, stdin if omitted or -"`
+	} `positional-args:"yes"`
+}
+
+// testFormat parses the sample lines of c with the format of e and prints
+// the fields of every line. It reports whether all lines were parsed.
+func testFormat(c *TestFormatCommand, e *exporter.Exporter) (bool, error) {
+	var r io.Reader = os.Stdin
+	if c.Args.File != "" && c.Args.File != "-" {
+		f, err := tail.OpenRotated(c.Args.File)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return e.TestFormat(os.Stdout, r, c.Namespace)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyUSR1 relays SIGUSR1 to c
+func notifyUSR1(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
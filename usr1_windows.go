@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// notifyUSR1 does nothing, as there is no SIGUSR1 on Windows
+func notifyUSR1(c chan<- os.Signal) {}
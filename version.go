@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Version and Revision describe the build, they are set at build time via
+// -ldflags "-X main.Version=... -X main.Revision=..."
+var (
+	Version  = "dev"
+	Revision = "unknown"
+)
+
+// newBuildInfo returns the metric describing the build
+func newBuildInfo() prometheus.Collector {
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "nginx_exporter",
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by the version, revision and Go version the exporter was built with",
+	}, []string{"version", "revision", "goversion"})
+
+	buildInfo.WithLabelValues(Version, Revision, runtime.Version()).Set(1)
+	return buildInfo
+}
+
+// versionString returns the version printed by --version
+func versionString() string {
+	return fmt.Sprintf("nginx-log-exporter, version %s (revision: %s)\n  go version: %s\n  platform: %s/%s",
+		Version, Revision, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// unixSocketPrefix is the prefix of listen addresses which are Unix domain
+// sockets
+const unixSocketPrefix = "unix://"
+
+// listeners returns the listeners of the web interface, which are the
+// sockets passed by systemd with SystemdSocket set or the listener on the
+// listen address of c otherwise
+func listeners(c ListenConfig) ([]net.Listener, error) {
+	if !c.SystemdSocket {
+		l, err := listen(c)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+
+	ls, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) == 0 {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	return ls, nil
+}
+
+// listen opens the listener of the web interface on the listen address of
+// c, which is a TCP address or a Unix domain socket like
+// unix:///run/nginx-log-exporter.sock
+func listen(c ListenConfig) (net.Listener, error) {
+	if !strings.HasPrefix(c.ListenAddress, unixSocketPrefix) {
+		return net.Listen("tcp", c.ListenAddress)
+	}
+
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode '%s': %s", c.SocketMode, err)
+	}
+
+	path := strings.TrimPrefix(c.ListenAddress, unixSocketPrefix)
+
+	// Remove the socket left behind by a previous run which did not exit
+	// cleanly, other files are left alone
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// serve serves srv on l until it is shut down, with TLS and basic auth as
+// configured by the web configuration file of c
+func serve(c ListenConfig, srv *http.Server, l net.Listener) error {
+	return web.Serve(l, srv, &web.FlagConfig{
+		WebListenAddresses: &[]string{c.ListenAddress},
+		WebSystemdSocket:   new(bool),
+		WebConfigFile:      &c.WebConfigFile,
+	}, slog.Default())
+}